@@ -2,15 +2,20 @@ package cerberus
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
+	"unicode"
 
+	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/registry"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/debug"
@@ -28,25 +33,60 @@ var Logger = log.New(os.Stdout, "Cerberus: ", 0)
 
 // InstallService installs a windows service with the given configuration.
 func InstallService(config SvcConfig) error {
+	return InstallServiceContext(context.Background(), config)
+}
+
+// InstallServiceContext installs a windows service with the given configuration. If the context
+// is done before the service is created, an error with ErrTimeout wrapping ctx.Err() is returned.
+func InstallServiceContext(ctx context.Context, config SvcConfig) error {
+	return defaultManager.installService(ctx, config, installOptions)
+}
+
+// ResolveInstallConfig returns the configuration InstallService would install, with the defaults filled
+// in and validated, without changing the system. The pre-install hook isn't run.
+func ResolveInstallConfig(config SvcConfig) (*SvcConfig, error) {
 	DebugLogger.Println("Open connection to service control manager...")
-	manager, err := mgr.Connect()
+	manager, err := defaultManager.connect()
 	if err != nil {
-		return newError(ErrSCMConnect, "failed to connect to service control manager: %v", err)
+		return nil, err
 	}
 	defer manager.Disconnect()
 
-	// Ensure all required properties are initialized.
-	if err := initConfiguration(&config); err != nil {
+	if err := defaultManager.prepareInstall(manager, &config, installOptions); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (m *Manager) installService(ctx context.Context, config SvcConfig, opts ValidateConfigOptions) (err error) {
+	ctx, end := traceOperation(ctx, "install", config.Name)
+	defer func() { end(err) }()
+
+	DebugLogger.Println("Open connection to service control manager...")
+	manager, err := m.connect()
+	if err != nil {
 		return err
 	}
-	// Validate all properties
-	if err := validateConfiguration(manager, &config); err != nil {
+	defer manager.Disconnect()
+
+	if err := m.prepareInstall(manager, &config, opts); err != nil {
 		return err
 	}
 
-	Logger.Printf("Installing service %v...\n", config.Name)
+	if err := checkContext(ctx, "installing service %v", config.Name); err != nil {
+		return err
+	}
+
+	Logf(Logger, "Installing service %v...\n", Field("service", config.Name))
+
+	if config.PreInstallCmd != "" {
+		Logf(Logger, "Running pre-install hook '%v'...\n", Field("hook", config.PreInstallCmd), Field("service", config.Name))
+		if err := runServiceHook(config.PreInstallCmd, config.PreInstallArgs, "CERBERUS_SVC_NAME="+config.Name, "CERBERUS_SVC_EXE="+config.ExePath); err != nil {
+			return newErrorW(ErrInstallService, "pre-install hook failed", err)
+		}
+	}
 
-	DebugLogger.Printf("Creating service %v...\n", config.Name)
+	Logf(DebugLogger, "Creating service %v...\n", Field("service", config.Name))
 	cerberusPath, _ := filepath.Abs(os.Args[0]) // Consideration: pass it as argument could be a better solution
 	s, err := manager.CreateService(config.Name, cerberusPath, mgr.Config{DisplayName: config.DisplayName, Description: config.Desc}, "run", config.Name)
 	if err != nil {
@@ -54,133 +94,262 @@ func InstallService(config SvcConfig) error {
 	}
 	defer s.Close()
 
-	DebugLogger.Printf("Creating eventlog %v...\n", config.Name)
-	if err := eventlog.InstallAsEventCreate(config.Name, eventlog.Error|eventlog.Info|eventlog.Warning); err != nil {
+	if err := setServiceEnvironment(s, config.Computer); err != nil {
+		s.Delete()
+		return newErrorW(ErrInstallService, "failed to set service environment", err)
+	}
+
+	Logf(DebugLogger, "Creating eventlog %v...\n", Field("service", config.Name))
+	if err := manager.InstallEventSource(config.Name); err != nil {
 		s.Delete()
 		return newErrorW(ErrInstallService, "failed to create eventlog %v", err, config.Name)
 	}
 
 	DebugLogger.Println("Write service configuration...")
-	if err := saveServiceCfg(config); err != nil {
+	if err := m.saveServiceCfg(config); err != nil {
 		s.Delete()
-		eventlog.Remove(config.Name)
+		manager.RemoveEventSource(config.Name)
 		return err
 	}
 
-	Logger.Printf("Successfully installed service %v...\n", config.Name)
+	// The service is installed, so a failed hook doesn't roll back the installation.
+	if config.PostInstallCmd != "" {
+		Logf(Logger, "Running post-install hook '%v'...\n", Field("hook", config.PostInstallCmd), Field("service", config.Name))
+		if err := runServiceHook(config.PostInstallCmd, config.PostInstallArgs, "CERBERUS_SVC_NAME="+config.Name,
+			"CERBERUS_SVC_EXE="+config.ExePath, "CERBERUS_SVC_DISPLAY_NAME="+config.DisplayName); err != nil {
+			Logf(Logger, "Warning: post-install hook failed: %v\n", Field("error", err), Field("service", config.Name))
+		}
+	}
+
+	Logf(Logger, "Successfully installed service %v...\n", Field("service", config.Name))
 	return nil
 }
 
+// CloneService installs a copy of the source service with the given name. The modify function,
+// if not nil, can change the copied configuration before it is installed. Passwords can't be
+// copied, a service user which requires a password must be set again by the modify function.
+func CloneService(source, name string, modify func(cfg *SvcConfig)) (*SvcConfig, error) {
+	DebugLogger.Println("Loading configuration...")
+	cfg, err := LoadServiceCfg(source)
+	if err != nil {
+		return nil, err
+	}
+
+	// The SCM doesn't allow duplicate display names.
+	cfg.Name = name
+	cfg.DisplayName = name
+	cfg.PreviousStartType = 0
+	if modify != nil {
+		modify(cfg)
+	}
+
+	// The copy runs the same executable by design.
+	opts := installOptions
+	opts.AllowDuplicateExePath = true
+	if err := defaultManager.installService(context.Background(), *cfg, opts); err != nil {
+		return nil, err
+	}
+
+	return LoadServiceCfg(name)
+}
+
 // UpdateService updates a cerberus service with the given configuration.
 func UpdateService(config SvcConfig) error {
+	return UpdateServiceContext(context.Background(), config)
+}
+
+// UpdateServiceContext updates a cerberus service with the given configuration, which replaces the
+// stored configuration as a whole, so it should be loaded with LoadServiceCfg and modified. If the context
+// is done before the configuration is saved, an error with ErrTimeout wrapping ctx.Err() is returned.
+func UpdateServiceContext(ctx context.Context, config SvcConfig) error {
+	return defaultManager.updateService(ctx, config)
+}
+
+func (m *Manager) updateService(ctx context.Context, config SvcConfig) (err error) {
+	ctx, end := traceOperation(ctx, "update", config.Name)
+	defer func() { end(err) }()
+
 	DebugLogger.Println("Open connection to service control manager...")
-	manager, err := mgr.Connect()
+	manager, err := m.connect()
 	if err != nil {
-		return newError(ErrSCMConnect, "failed to connect to service control manager: %v", err)
+		return err
 	}
 	defer manager.Disconnect()
 
 	DebugLogger.Println("Loading configuration...")
-	currentSvc, err := LoadServiceCfg(config.Name)
+	currentSvc, err := m.loadServiceCfg(manager, config.Name, nil)
 	if err != nil {
 		return err
 	}
 
-	Logger.Printf("Updating service %v...\n", config.Name)
+	Logf(Logger, "Updating service %v...\n", Field("service", config.Name))
 	trimArgs(config.Args)
-	currentSvc.Args = config.Args
-	currentSvc.Desc = config.Desc
-	currentSvc.DisplayName = config.DisplayName
-	currentSvc.Env = config.Env
-	currentSvc.RecoveryActions = config.RecoveryActions
-	currentSvc.WorkDir = config.WorkDir
+	config.Computer = currentSvc.Computer
 
 	// Validate all properties
-	if err := validateConfiguration(manager, &config); err != nil {
+	if err := m.validateConfiguration(manager, &config, installOptions); err != nil {
+		return err
+	}
+
+	if err := checkContext(ctx, "updating service %v", config.Name); err != nil {
 		return err
 	}
 
 	DebugLogger.Println("Write service configuration...")
-	if err := saveServiceCfg(config); err != nil {
+	if err := m.saveServiceCfg(config); err != nil {
 		return err
 	}
 
-	Logger.Printf("Successfully updated service %v...\n", config.Name)
+	Logf(Logger, "Successfully updated service %v...\n", Field("service", config.Name))
 	return nil
 }
 
 // RemoveService removes the service with the given name.
 // Stops the service first, can return a timeout error if it can't stop the service.
 func RemoveService(name string) error {
+	return RemoveServiceContext(context.Background(), name)
+}
+
+// RemoveServiceContext removes the service with the given name. Stops the service first, if
+// the context is done while waiting for the service to stop, an error with ErrTimeout wrapping
+// ctx.Err() is returned.
+func RemoveServiceContext(ctx context.Context, name string) error {
+	return RemoveServiceWithOptions(ctx, name, RemoveOptions{})
+}
+
+// RemoveOptions changes how RemoveServiceWithOptions removes a service.
+type RemoveOptions struct {
+	// SkipHooks doesn't run the pre-remove hook, ex. in an emergency if the hook fails.
+	SkipHooks bool
+	// Force kills the process tree of the service instead of stopping it gracefully, ex. if the
+	// service doesn't respond anymore. Services on a remote computer can't be force removed.
+	Force bool
+}
+
+// RemoveServiceWithOptions removes the service like RemoveServiceContext with the given options.
+func RemoveServiceWithOptions(ctx context.Context, name string, opts RemoveOptions) error {
+	res := defaultManager.removeService(ctx, name, opts)
+	logWarnings(res.Warnings)
+	return res.Err
+}
+
+// RemoveServiceResult removes the service like RemoveServiceContext and returns the configuration
+// of the removed service. Leftovers which couldn't be removed, like the event log, are returned as
+// warnings instead of being logged.
+func RemoveServiceResult(ctx context.Context, name string) Result[*SvcConfig] {
+	return defaultManager.removeService(ctx, name, RemoveOptions{})
+}
+
+func (m *Manager) removeService(ctx context.Context, name string, opts RemoveOptions) (res Result[*SvcConfig]) {
+	ctx, end := traceOperation(ctx, "remove", name)
+	defer func() { end(res.Err) }()
+
 	DebugLogger.Println("Open connection to service control manager...")
-	manager, err := mgr.Connect()
+	manager, err := m.connect()
 	if err != nil {
-		return newErrorW(ErrSCMConnect, "failed to connect to service control manager", err)
+		res.Err = err
+		return res
 	}
 	defer manager.Disconnect()
 
 	DebugLogger.Println("Loading configuration...")
-	config, err := LoadServiceCfg(name)
+	config, err := m.loadServiceCfg(manager, name, nil)
 	if err != nil {
-		return err
+		res.Err = err
+		return res
 	}
 
-	DebugLogger.Printf("Open service %v...\n", config.Name)
+	Logf(DebugLogger, "Open service %v...\n", Field("service", config.Name))
 	s, err := manager.OpenService(config.Name)
 	if err != nil {
-		return newErrorW(ErrRemoveService, "failed to open service", err)
+		res.Err = newErrorW(ErrRemoveService, "failed to open service", err)
+		return res
 	}
 	defer s.Close()
 
-	DebugLogger.Printf("Stopping service %v...\n", config.Name)
-	s.Control(svc.Stop)
-	timeout := time.Now().Add(30 * time.Second)
-	state, _ := s.Query()
-	for state.State != svc.Stopped {
-		if time.Now().After(timeout) {
-			return newError(ErrTimeout, "failed to stop service")
+	if config.PreRemoveCmd != "" && !opts.SkipHooks {
+		Logf(Logger, "Running pre-remove hook '%v'...\n", Field("hook", config.PreRemoveCmd), Field("service", config.Name))
+		if err := runServiceHook(config.PreRemoveCmd, config.PreRemoveArgs, "CERBERUS_SVC_NAME="+config.Name,
+			"CERBERUS_SVC_EXE="+config.ExePath, "CERBERUS_SVC_DISPLAY_NAME="+config.DisplayName); err != nil {
+			res.Err = newErrorW(ErrRemoveService, "pre-remove hook failed, use --skip-hooks to remove the service anyway", err)
+			return res
 		}
+	}
 
-		time.Sleep(200 * time.Millisecond)
-		state, _ = s.Query()
+	if opts.Force {
+		Logf(Logger, "Warning: force removing service %v, its process is killed without stopping it gracefully!\n", Field("service", config.Name))
+		if err := killServiceProcess(s); err != nil {
+			res.Err = newErrorW(ErrTimeout, "failed to kill service %v", err, config.Name)
+			return res
+		}
+	} else {
+		Logf(DebugLogger, "Stopping service %v...\n", Field("service", config.Name))
+		s.Control(svc.Stop)
+		if err := waitForStateContext(ctx, s, svc.Stopped, config.stopTimeout()); err != nil {
+			res.Err = err
+			return res
+		}
 	}
 
-	Logger.Printf("Removing service %v...\n", config.Name)
-	DebugLogger.Printf("Mark service %v for deletion...", config.Name)
+	Logf(Logger, "Removing service %v...\n", Field("service", config.Name))
+	Logf(DebugLogger, "Mark service %v for deletion...", Field("service", config.Name))
 	if err := s.Delete(); err != nil {
-		return newErrorW(ErrRemoveService, "failed to remove service %v", err, config.Name)
+		res.Err = newErrorW(ErrRemoveService, "failed to remove service %v", err, config.Name)
+		return res
 	}
 
-	DebugLogger.Printf("Removing eventlog %v...\n", config.Name)
-	if err := eventlog.Remove(config.Name); err != nil {
-		Logger.Printf("failed to remove eventlog, you might to try to remove it manually: %v\n", err)
+	Logf(DebugLogger, "Removing eventlog %v...\n", Field("service", config.Name))
+	if err := manager.RemoveEventSource(config.Name); err != nil {
+		res.Warnings = append(res.Warnings, newWarningW(ErrRemoveService, "failed to remove eventlog, you might to try to remove it manually", err))
 	}
 
-	if err := RemoveServiceCfg(config.Name); err != nil {
-		Logger.Printf("Failed to remove configuration, you might try to remove it manually: %v\n", err)
+	if err := m.storage().Delete(config.Name); err != nil {
+		res.Warnings = append(res.Warnings, newWarningW(ErrRemoveService, "failed to remove configuration, you might try to remove it manually", err))
 	}
 
-	Logger.Printf("Successfully removed service %v...\n", config.Name)
-	return nil
+	if config.Computer != "" {
+		if err := deleteRemoteCfg(config.Computer, config.Name); err != nil {
+			res.Warnings = append(res.Warnings, newWarningW(ErrRemoveService, "failed to remove configuration on %v, you might try to remove it manually", err, config.Computer))
+		}
+	}
+
+	if config.UseCredentialManager {
+		if err := DeleteServiceCredential(config.Name); err != nil {
+			res.Warnings = append(res.Warnings, newWarningW(ErrRemoveService, "failed to remove credential, you might try to remove it with 'cerberus credential del %v'", err, config.Name))
+		}
+	}
+
+	Logf(Logger, "Successfully removed service %v...\n", Field("service", config.Name))
+	res.Value = config
+	return res
 }
 
 // RunService runs the service with the given name.
 func RunService(name string) error {
+	return RunServiceContext(context.Background(), name)
+}
+
+// RunServiceContext runs the service with the given name. If the context is done, the service is
+// stopped like on a stop request and an error with ErrTimeout wrapping ctx.Err() is returned.
+func RunServiceContext(ctx context.Context, name string) (err error) {
+	ctx, end := traceOperation(ctx, "run", name)
+	defer func() { end(err) }()
+
 	isIntSess, err := svc.IsAnInteractiveSession()
 	if err != nil {
 		return newErrorW(ErrGeneric, "failed to determine if session is interactive", err)
 	}
 
 	DebugLogger.Println("Loading service configuration...")
-	svcCfg, err := loadSvcCfgRegistry(name)
+	svcCfg, err := loadStoredCfg(name)
 	if err != nil {
 		return err
 	}
 
 	run := svc.Run
-	cerb := cerberusSvc{cfg: *svcCfg}
+	cerb := cerberusSvc{cfg: *svcCfg, stored: *svcCfg, ctx: ctx}
 	if isIntSess {
-		cerb.log = debug.New(svcCfg.Name)
+		cerb.log = newServiceLog(svcCfg.Name)
 		run = debug.Run
 	} else {
 		cerb.log, err = eventlog.Open(svcCfg.Name)
@@ -190,17 +359,61 @@ func RunService(name string) error {
 	}
 	defer cerb.log.Close()
 
-	DebugLogger.Println(fmt.Sprintf("Starting service %v ...", svcCfg.Name))
+	Logf(DebugLogger, "Starting service %v ...\n", Field("service", svcCfg.Name))
 	cerb.log.Info(1, fmt.Sprintf("Starting service %v ...", svcCfg.Name))
 	if err := run(svcCfg.Name, &cerb); err != nil {
-		cerb.log.Error(5, fmt.Sprintf("Failed to run service: %v", err))
+		logServiceError(cerb.log, 5, "Failed to run service: %v", Field("error", err))
 		return err
 	}
 
-	return nil
+	return checkContext(ctx, "running service %v", svcCfg.Name)
+}
+
+// ValidateConfigOptions changes which checks ValidateConfigWithOptions runs.
+type ValidateConfigOptions struct {
+	// SkipDependencies doesn't require the dependencies to be installed.
+	SkipDependencies bool
+	// AllowUNCPaths doesn't require an executable on a network share (\\server\share\app.exe)
+	// to exist, the share may only be available when the service runs.
+	AllowUNCPaths bool
+	// AllowDuplicateExePath doesn't warn if the executable is already used by another service.
+	AllowDuplicateExePath bool
+}
+
+// installOptions are the validation options of InstallService and UpdateService, the path
+// of an executable on a network share is checked when the service starts.
+var installOptions = ValidateConfigOptions{AllowUNCPaths: true}
+
+// ValidateConfig validates the given configuration without changing the system.
+// If skipDependencies is true, the dependencies aren't required to be installed.
+func ValidateConfig(cfg SvcConfig, skipDependencies bool) error {
+	return ValidateConfigWithOptions(cfg, ValidateConfigOptions{SkipDependencies: skipDependencies})
+}
+
+// ValidateConfigWithOptions validates the given configuration like ValidateConfig with the given options.
+func ValidateConfigWithOptions(cfg SvcConfig, opts ValidateConfigOptions) error {
+	if opts.SkipDependencies {
+		return validateProperties(&cfg, opts)
+	}
+
+	DebugLogger.Println("Open connection to service control manager...")
+	manager, err := defaultManager.connect()
+	if err != nil {
+		return err
+	}
+	defer manager.Disconnect()
+
+	return defaultManager.validateConfiguration(manager, &cfg, opts)
+}
+
+func (m *Manager) validateConfiguration(manager SCMClient, cfg *SvcConfig, opts ValidateConfigOptions) error {
+	if err := validateProperties(cfg, opts); err != nil {
+		return err
+	}
+	return m.validateDependencies(manager, cfg)
 }
 
-func validateConfiguration(m *mgr.Mgr, cfg *SvcConfig) error {
+func validateProperties(cfg *SvcConfig, opts ValidateConfigOptions) error {
 	DebugLogger.Println("Validating configuration...")
 	if cfg.Name == "" {
 		return newError(ErrInvalidConfiguration, "service name can't be empty")
@@ -210,11 +423,177 @@ func validateConfiguration(m *mgr.Mgr, cfg *SvcConfig) error {
 		return newError(ErrInvalidConfiguration, "executable path can't be empty")
 	}
 
-	if fi, err := os.Stat(cfg.ExePath); err != nil || fi.IsDir() {
-		return newErrorW(ErrInvalidConfiguration, "executable path isn't a binary file", err)
+	if !cfg.NoExpandEnv {
+		for _, name := range unsetEnvVars(cfg) {
+			Logf(Logger, "Warning: environment variable %v isn't set, it's expanded when the service starts.\n", Field("variable", name), Field("service", cfg.Name))
+		}
+	}
+
+	for _, path := range []string{cfg.ExePath, cfg.WorkDir} {
+		if isUNCPath(cfg.expand(path)) {
+			Logf(Logger, "Warning: %v is on a network share, the service user requires access to it.\n", Field("path", path), Field("service", cfg.Name))
+		}
+	}
+
+	// Paths of a service on a remote computer can't be checked locally.
+	exePath := cfg.expand(cfg.ExePath)
+	if cfg.Computer == "" && !(opts.AllowUNCPaths && isUNCPath(exePath)) {
+		if fi, err := os.Stat(exePath); err != nil || fi.IsDir() {
+			return newErrorW(ErrInvalidConfiguration, "executable path isn't a binary file", err)
+		}
+	}
+
+	if cfg.WorkDirCreate {
+		if sysRoot := os.Getenv("SystemRoot"); sysRoot != "" && isSubPath(sysRoot, cfg.WorkDir) {
+			return newError(ErrInvalidConfiguration, "working directory can't be created in a system directory")
+		}
+	}
+
+	if cfg.ServiceACL != "" {
+		if _, err := parseServiceACL(cfg.ServiceACL); err != nil {
+			return err
+		}
+	}
+
+	if cfg.UseVirtualAccount {
+		if !supportsVirtualAccounts() {
+			return newError(ErrInvalidConfiguration, "virtual accounts require Windows 7 / Windows Server 2008 R2 or newer")
+		}
+		if cfg.UseCredentialManager {
+			return newError(ErrInvalidConfiguration, "virtual accounts have no password, the credential manager can't be used")
+		}
+	}
+
+	if cfg.UseGMSA {
+		if err := validateGMSA(cfg); err != nil {
+			return err
+		}
+	}
+
+	for i, name := range cfg.RequiredPrivileges {
+		p, ok := canonicalPrivilege(name)
+		if !ok {
+			return newError(ErrInvalidConfiguration, "unknown privilege '%v'", name)
+		}
+		cfg.RequiredPrivileges[i] = p
+	}
+	if len(cfg.RequiredPrivileges) > 0 && !cfg.UseVirtualAccount && isLocalSystem(cfg.ServiceUser) {
+		logWarnings([]Warning{newWarning(ErrInvalidConfiguration, "the service runs as LocalSystem, restricting its privileges doesn't limit its access to the system")})
+	}
+
+	for _, dep := range cfg.OptionalDependencies {
+		if strings.EqualFold(dep, cfg.Name) {
+			return newError(ErrInvalidConfiguration, "service can't depend on itself")
+		}
+		for _, d := range cfg.Dependencies {
+			if strings.EqualFold(dep, d) {
+				return newError(ErrInvalidConfiguration, "dependency %v can't be required and optional", dep)
+			}
+		}
+	}
+
+	if cfg.EnvFile != "" && cfg.Computer == "" {
+		if fi, err := os.Stat(cfg.EnvFile); err != nil || fi.IsDir() {
+			return newErrorW(ErrInvalidConfiguration, "env file doesn't exist", err)
+		}
+	}
+
+	if cfg.StopTimeout < 0 || cfg.StopTimeout > MaxStopTimeout {
+		return newError(ErrInvalidConfiguration, "stop timeout must be between 0 and %v", MaxStopTimeout)
+	}
+
+	if cfg.WatchdogInterval < 0 || cfg.WatchdogFailThreshold < 0 {
+		return newError(ErrInvalidConfiguration, "watchdog interval and fail threshold can't be negative")
+	}
+	if cfg.WatchdogURL != "" {
+		if u, err := url.Parse(cfg.WatchdogURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return newErrorW(ErrInvalidConfiguration, "watchdog url must be a http(s) url", err)
+		}
+	}
+	if cfg.WatchdogInterval > 0 && cfg.WatchdogURL == "" && !cfg.WatchdogCPU {
+		return newError(ErrInvalidConfiguration, "watchdog requires a watchdog url or the cpu check")
+	}
+
+	switch cfg.Priority {
+	case InheritPriority, NormalPriority, BelowNormalPriority, AboveNormalPriority:
+	case RealtimePriority:
+		Logf(Logger, "Warning: %v priority can make the system unresponsive, use it with care.\n", Field("priority", "realtime"), Field("service", cfg.Name))
+		if !windows.GetCurrentProcessToken().IsElevated() {
+			Logf(Logger, "Warning: %v priority requires administrator privileges, otherwise high priority is used.\n", Field("priority", "realtime"), Field("service", cfg.Name))
+		}
+	default:
+		return newError(ErrInvalidConfiguration, "unknown process priority: %#x", uint32(cfg.Priority))
+	}
+
+	if cfg.IOPriority > IOPriorityNormal {
+		return newError(ErrInvalidConfiguration, "unknown i/o priority: %v", uint32(cfg.IOPriority))
+	}
+
+	if cfg.PreStartCmd != "" {
+		if fi, err := os.Stat(cfg.PreStartCmd); err != nil || fi.IsDir() {
+			return newErrorW(ErrInvalidConfiguration, "pre-start hook path isn't a binary file", err)
+		}
+	}
+
+	if cfg.PostStopCmd != "" {
+		if fi, err := os.Stat(cfg.PostStopCmd); err != nil || fi.IsDir() {
+			return newErrorW(ErrInvalidConfiguration, "post-stop hook path isn't a binary file", err)
+		}
+	}
+
+	if cfg.PreInstallCmd != "" {
+		if fi, err := os.Stat(cfg.PreInstallCmd); err != nil || fi.IsDir() {
+			return newErrorW(ErrInvalidConfiguration, "pre-install hook path isn't a binary file", err)
+		}
+	}
+
+	if cfg.PostInstallCmd != "" {
+		if fi, err := os.Stat(cfg.PostInstallCmd); err != nil || fi.IsDir() {
+			return newErrorW(ErrInvalidConfiguration, "post-install hook path isn't a binary file", err)
+		}
+	}
+
+	if cfg.PreRemoveCmd != "" {
+		if fi, err := os.Stat(cfg.PreRemoveCmd); err != nil || fi.IsDir() {
+			return newErrorW(ErrInvalidConfiguration, "pre-remove hook path isn't a binary file", err)
+		}
+	}
+
+	if cfg.PreStartTimeout < 0 {
+		return newError(ErrInvalidConfiguration, "pre-start timeout can't be negative")
+	}
+
+	for k := range cfg.Labels {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			return newError(ErrInvalidConfiguration, "invalid label key '%v'", k)
+		}
+	}
+
+	if cfg.LogMaxBackups < 0 {
+		return newError(ErrInvalidConfiguration, "log max backups can't be negative")
+	}
+
+	if cfg.CPUAffinity != 0 {
+		sysMask, err := systemAffinityMask()
+		if err != nil {
+			return newErrorW(ErrGeneric, "failed to get system affinity mask", err)
+		}
+		if cfg.CPUAffinity&^sysMask != 0 {
+			return newError(ErrInvalidConfiguration, "cpu affinity mask %#x references processors not available on this system (%#x)", cfg.CPUAffinity, sysMask)
+		}
+	}
+
+	if cfg.JobObject.CPURatePercent > 100 {
+		return newError(ErrInvalidConfiguration, "job cpu rate must be between 1 and 100 percent")
 	}
 
 	for _, action := range cfg.RecoveryActions {
+		if action.BackoffMultiplier < 0 || action.MaxDelay < 0 || action.Jitter < 0 {
+			return newError(ErrInvalidConfiguration, "recovery action backoff multiplier, max delay and jitter can't be negative")
+		}
+		if action.CircuitBreakAfter < 0 || action.CircuitBreakDuration < 0 {
+			return newError(ErrInvalidConfiguration, "recovery action circuit breaker settings can't be negative")
+		}
 		if (action.Action & RunProgramAction) == RunProgramAction {
 			if action.Program == "" {
 				return newError(ErrInvalidConfiguration, "recovery action program path can't be empty")
@@ -223,10 +602,19 @@ func validateConfiguration(m *mgr.Mgr, cfg *SvcConfig) error {
 				return newErrorW(ErrInvalidConfiguration, "recovery action program path isn't a binary file", err)
 			}
 		}
+		if (action.Action & WebhookAction) == WebhookAction {
+			if u, err := url.Parse(action.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return newErrorW(ErrInvalidConfiguration, "recovery action webhook url must be a http(s) url", err)
+			}
+		}
 	}
 
+	return nil
+}
+
+func (m *Manager) validateDependencies(manager SCMClient, cfg *SvcConfig) error {
 	if len(cfg.Dependencies) > 0 {
-		services, err := m.ListServices()
+		services, err := manager.ListServices()
 		if err != nil {
 			return newErrorW(ErrGeneric, "failed to get service list", err)
 		}
@@ -242,17 +630,108 @@ func validateConfiguration(m *mgr.Mgr, cfg *SvcConfig) error {
 				return newError(ErrInvalidConfiguration, "couldn't find a dependency: "+cfg.Dependencies[i])
 			}
 		}
+
+		return m.validateDependencyCycles(manager, cfg)
 	}
 
 	return nil
 }
 
-func initConfiguration(cfg *SvcConfig) error {
-	DebugLogger.Println("Creating absolute path for ExePath...")
-	var err error
-	cfg.ExePath, err = filepath.Abs(cfg.ExePath)
+// validateDependencyCycles checks that the dependencies of the configuration together with the dependencies
+// of the other cerberus services don't form a cycle, the SCM refuses to start any service of a cycle.
+func (m *Manager) validateDependencyCycles(manager SCMClient, cfg *SvcConfig) error {
+	names, err := m.storage().List()
 	if err != nil {
-		return newErrorW(ErrInstallService, "failed to get absolute path", err)
+		DebugLogger.Println("skipping dependency cycle check:", err)
+		return nil
+	}
+
+	// Service names are case insensitive.
+	graph := map[string][]string{strings.ToLower(cfg.Name): cfg.Dependencies}
+	for _, name := range names {
+		if strings.EqualFold(name, cfg.Name) {
+			continue
+		}
+		s, err := manager.OpenService(name)
+		if err != nil {
+			DebugLogger.Println("skipping item", name, ":", err)
+			continue
+		}
+		scmCfg, err := s.Config()
+		s.Close()
+		if err != nil {
+			DebugLogger.Println("skipping item", name, ":", err)
+			continue
+		}
+		graph[strings.ToLower(name)] = scmCfg.Dependencies
+	}
+
+	if cycle := findCycle(graph, cfg.Name); cycle != nil {
+		return newError(ErrInvalidConfiguration, "circular dependency: %v", strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// findCycle searches the graph with a depth-first search starting at the given node, the keys of the
+// graph are lower case. It returns the path of the first cycle found or nil if there is no cycle.
+func findCycle(graph map[string][]string, start string) []string {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var path []string
+
+	var visit func(node string) []string
+	visit = func(node string) []string {
+		key := strings.ToLower(node)
+		state[key] = visiting
+		path = append(path, node)
+		for _, next := range graph[key] {
+			switch state[strings.ToLower(next)] {
+			case visiting:
+				for i := range path {
+					if strings.EqualFold(path[i], next) {
+						return append(append([]string(nil), path[i:]...), next)
+					}
+				}
+			case 0:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[key] = done
+		return nil
+	}
+	return visit(start)
+}
+
+// prepareInstall fills in the defaults of a configuration to install and validates it.
+func (m *Manager) prepareInstall(manager SCMClient, cfg *SvcConfig, opts ValidateConfigOptions) error {
+	cfg.Computer = scmComputer
+	if cfg.Computer != "" && currentScope() == UserScope {
+		return newError(ErrInstallService, "services on a remote computer can't be installed in the user scope")
+	}
+
+	// Ensure all required properties are initialized.
+	if err := m.initConfiguration(manager, cfg, opts); err != nil {
+		return err
+	}
+	// Validate all properties
+	return m.validateConfiguration(manager, cfg, opts)
+}
+
+func (m *Manager) initConfiguration(manager SCMClient, cfg *SvcConfig, opts ValidateConfigOptions) error {
+	DebugLogger.Println("Creating absolute path for ExePath...")
+	// A path starting with a ${VAR} reference is made absolute by the expansion.
+	if cfg.NoExpandEnv || !strings.HasPrefix(cfg.ExePath, "$") {
+		var err error
+		cfg.ExePath, err = filepath.Abs(cfg.ExePath)
+		if err != nil {
+			return newErrorW(ErrInstallService, "failed to get absolute path", err)
+		}
 	}
 
 	if cfg.Name == "" {
@@ -266,9 +745,19 @@ func initConfiguration(cfg *SvcConfig) error {
 	}
 
 	DebugLogger.Println("Loading configuration...")
-	if _, err := LoadServiceCfg(cfg.Name); err == nil {
+	if _, err := m.loadServiceCfg(manager, cfg.Name, nil); err == nil {
 		return newError(ErrInstallService, " already a service (%v) installed, try to remove it first", cfg.Name)
 	}
+	// The configurations of all computers are stored locally, so the names must be unique across them.
+	if stored, err := m.loadStoredCfg(cfg.Name); err == nil && !sameComputer(stored.Computer, scmComputer) {
+		return newError(ErrInstallService, "already a service (%v) installed on %v, try to remove it first", cfg.Name, computerName(stored.Computer))
+	}
+
+	if !opts.AllowDuplicateExePath {
+		if svcs := m.servicesUsingExePath(cfg.ExePath); len(svcs) > 0 {
+			Logf(Logger, "Warning: %v is already used by the service(s) %v.\n", Field("exe", cfg.ExePath), Field("services", strings.Join(svcs, ", ")))
+		}
+	}
 
 	trimArgs(cfg.Args)
 
@@ -282,30 +771,167 @@ func initConfiguration(cfg *SvcConfig) error {
 		cfg.WorkDir = filepath.Dir(cfg.ExePath)
 	}
 
-	cfg.StartType = ManualStartType
+	if cfg.StartType == 0 {
+		cfg.StartType = ManualStartType
+	}
 	return nil
 }
 
 // SvcConfig is the data required run the executable as a service.
 type SvcConfig struct {
 	// Base configuration
-	Name        string
-	Desc        string
-	DisplayName string
-	ExePath     string
-	WorkDir     string
-	Args        []string
-	Env         []string
+	Name          string
+	Desc          string
+	DisplayName   string
+	ExePath       string
+	WorkDir       string
+	WorkDirCreate bool
+	Args          []string
+	Env           []string
+	EnvFile       string
+	// InheritEnv are the names of the host environment variables passed to the executable, if
+	// empty only the variables required by most programs are passed (see DefaultInheritedEnv).
+	InheritEnv []string
+	// InheritEnvAll passes the whole host environment to the executable.
+	InheritEnvAll bool
+	// NoExpandEnv disables the expansion of ${VAR} references in ExePath, WorkDir, StdinFile, StdoutLog,
+	// StderrLog, Args and Env, which are otherwise expanded by the service host on every start.
+	NoExpandEnv bool
 
 	// Extended Configurations
 	RecoveryActions map[int]SvcRecoveryAction
 	StopSignal      StopSignal
+	StopTimeout     time.Duration
+	Priority        ProcessPriority
+	IOPriority      IOPriority
+	CPUAffinity     uint64
+	MemoryLimitMB   uint64
+	JobObject       JobObjectConfig
+	StdinFile       string
+	StdoutLog       string
+	StderrLog       string
+	LogMaxSizeMB    uint64
+	LogMaxBackups   int
+	Labels          map[string]string
+	Notes           string
+
+	// Watchdog to detect hung processes, disabled if the interval is zero. It calls the WatchdogURL
+	// and, if WatchdogCPU is set, considers the process hung if it hasn't used any cpu time since the
+	// last check. The cpu check also restarts healthy processes, which are idle, ex. waiting for requests.
+	WatchdogInterval      time.Duration
+	WatchdogURL           string
+	WatchdogCPU           bool
+	WatchdogFailThreshold int
+
+	// Hooks
+	PreStartCmd     string
+	PreStartArgs    []string
+	PreStartTimeout time.Duration
+	PostStopCmd     string
+	PostStopArgs    []string
+
+	// PreInstallCmd is run before the service is created, the installation is aborted if it exits with
+	// an error. It gets the service name and executable in CERBERUS_SVC_NAME and CERBERUS_SVC_EXE.
+	PreInstallCmd  string
+	PreInstallArgs []string
+
+	// PostInstallCmd is run after the service is installed, a failure is only logged. It gets the service name,
+	// executable and display name in CERBERUS_SVC_NAME, CERBERUS_SVC_EXE and CERBERUS_SVC_DISPLAY_NAME.
+	PostInstallCmd  string
+	PostInstallArgs []string
+
+	// PreRemoveCmd is run before the service is stopped for its removal, the removal is aborted if it exits
+	// with an error. It gets the same variables as PostInstallCmd.
+	PreRemoveCmd  string
+	PreRemoveArgs []string
 
 	// SCM Properties (Admin rights require to load this properties)
 	Dependencies []string
 	ServiceUser  string
-	Password     *string
+	Password     *string `json:"-"`
 	StartType    StartType
+
+	// UseCredentialManager reads the password of the service user from the Windows
+	// Credential Manager (target cerberus/<name>), see SetServiceCredential.
+	UseCredentialManager bool
+
+	// ServiceACL is the DACL of the service as SDDL string, which controls who is allowed to
+	// start, stop or configure the service. If empty, the DACL of the service isn't changed.
+	ServiceACL string
+
+	// RequiredPrivileges restricts the privileges of the service process to the listed
+	// privileges (ex. SeChangeNotifyPrivilege), see KnownPrivileges. Empty means no restriction.
+	RequiredPrivileges []string
+
+	// UseVirtualAccount runs the service as its virtual account NT SERVICE\<name>, which is managed
+	// by windows and requires no password. ServiceUser is ignored if set.
+	UseVirtualAccount bool
+
+	// UseGMSA marks ServiceUser as group managed service account (ex. DOMAIN\svc$),
+	// its password is managed by the active directory.
+	UseGMSA bool
+
+	// OptionalDependencies are services the service host waits for before the executable is started, if they
+	// are installed. The SCM doesn't support optional dependencies, so they are only stored by cerberus.
+	OptionalDependencies []string
+
+	// MetricsPort is the port the service host serves Prometheus metrics on localhost:<port>/metrics,
+	// disabled if zero.
+	MetricsPort uint16
+
+	// Group tags related services, so they can be started and stopped together (see StartGroup).
+	// It isn't related to the load order groups of the SCM.
+	Group string
+
+	// Computer is the computer the service is installed on, empty for the local computer. The configuration
+	// is stored on the local computer as reference and a copy is written to the registry of the remote computer.
+	Computer string
+
+	// PreviousStartType is the start type before the service was disabled.
+	PreviousStartType StartType
+
+	// SchemaVersion is the version of the configuration format, see CurrentSchemaVersion.
+	SchemaVersion int
+
+	// Scope is the scope the configuration was loaded from, it isn't stored.
+	Scope ConfigScope
+
+	// CumulativeRestarts and LastRestart are the restart statistics of all runs of the service,
+	// they are recorded by the service host and aren't stored with the configuration.
+	CumulativeRestarts int
+	LastRestart        time.Time
+
+	// FirstStart and LastStart are the times the service was started for the first and the last time.
+	// TotalRuntime is the time the service was running over all completed runs. They are recorded by
+	// the service host and aren't stored with the configuration.
+	FirstStart   time.Time
+	LastStart    time.Time
+	TotalRuntime time.Duration
+}
+
+// DefaultStopTimeout is used if no stop timeout is configured for a service.
+const DefaultStopTimeout = 30 * time.Second
+
+// MaxStopTimeout is the maximum stop timeout a service can be configured with,
+// the SCM itself doesn't wait much longer for a service to stop.
+const MaxStopTimeout = 125 * time.Second
+
+func (c SvcConfig) stopTimeout() time.Duration {
+	if c.StopTimeout <= 0 {
+		return DefaultStopTimeout
+	}
+	return c.StopTimeout
+}
+
+// DefaultPreStartTimeout is used if no pre-start timeout is configured for a service,
+// so a hanging pre-start hook doesn't block the start of the service indefinitely.
+const DefaultPreStartTimeout = 30 * time.Second
+
+func (c SvcConfig) preStartTimeout() time.Duration {
+	if c.PreStartTimeout <= 0 {
+		return DefaultPreStartTimeout
+	}
+	return c.PreStartTimeout
 }
 
 // StartType configures the startup type.
@@ -322,6 +948,36 @@ const (
 	DisabledStartType StartType = 4
 )
 
+// ProcessPriority is the priority class of the executable process.
+type ProcessPriority uint32
+
+const (
+	// InheritPriority doesn't change the priority class of the process.
+	InheritPriority ProcessPriority = 0
+	// NormalPriority mirrors NORMAL_PRIORITY_CLASS.
+	NormalPriority ProcessPriority = 0x00000020
+	// BelowNormalPriority mirrors BELOW_NORMAL_PRIORITY_CLASS.
+	BelowNormalPriority ProcessPriority = 0x00004000
+	// AboveNormalPriority mirrors ABOVE_NORMAL_PRIORITY_CLASS.
+	AboveNormalPriority ProcessPriority = 0x00008000
+	// RealtimePriority mirrors REALTIME_PRIORITY_CLASS.
+	RealtimePriority ProcessPriority = 0x00000100
+)
+
+// IOPriority is the i/o priority of the executable process.
+type IOPriority uint32
+
+const (
+	// IOPriorityInherit doesn't change the i/o priority of the process.
+	IOPriorityInherit IOPriority = iota
+	// IOPriorityVeryLow is used for background work like defragmentation.
+	IOPriorityVeryLow
+	// IOPriorityLow is used for low priority work like indexing.
+	IOPriorityLow
+	// IOPriorityNormal is the default i/o priority of processes.
+	IOPriorityNormal
+)
+
 // RecoveryAction defines what happens if a binary exits with error
 type RecoveryAction int
 
@@ -332,11 +988,54 @@ const (
 	RestartAction
 	// RunProgramAction will run the specified program.
 	RunProgramAction
+	// WebhookAction posts the failure to the specified webhook url.
+	WebhookAction
 
 	// RunAndRestartAction restarts the service and runs the specified program.
 	RunAndRestartAction = RestartAction | RunProgramAction
 )
 
+func (a RecoveryAction) String() string {
+	if a&(RestartAction|RunProgramAction|WebhookAction) == 0 {
+		return "NoAction"
+	}
+
+	var strs []string
+	if a&RunProgramAction == RunProgramAction {
+		strs = append(strs, "RunProgram")
+	}
+	if a&WebhookAction == WebhookAction {
+		strs = append(strs, "Webhook")
+	}
+	if a&RestartAction == RestartAction {
+		strs = append(strs, "Restart")
+	}
+	return strings.Join(strs, " | ")
+}
+
+// JobObjectConfig configures the resource budgets of the job object the executable is assigned to.
+// Zero values mean unlimited.
+type JobObjectConfig struct {
+	// CPURatePercent is a hard cap of the cpu usage in percent of all processors.
+	CPURatePercent uint32
+	// MaxProcesses limits the number of active processes in the job.
+	MaxProcesses uint32
+	// MaxHandles limits the number of open handles of the executable, job objects don't support
+	// a handle limit, so the handle count is polled and the executable is terminated if it exceeds it.
+	MaxHandles uint32
+	// KillOnJobClose terminates all processes of the job if the cerberus service host exits.
+	KillOnJobClose bool
+}
+
+// enabled reports whether any limit is configured, only then a job object is required.
+func (j JobObjectConfig) enabled() bool {
+	return j.CPURatePercent > 0 || j.MaxProcesses > 0 || j.KillOnJobClose
+}
+
+// AnyExitCode can be used as exit code for a recovery action which
+// applies to all exit codes without an explicit recovery action.
+const AnyExitCode = -1
+
 // SvcRecoveryAction defines what cerberus should do if a binary returns an error.
 type SvcRecoveryAction struct {
 	ExitCode    int
@@ -346,18 +1045,43 @@ type SvcRecoveryAction struct {
 	ResetAfter  time.Duration
 	Program     string
 	Arguments   []string
+	// ExtraEnv is added to the service environment for the program and the restarted executable.
+	ExtraEnv []string
+
+	// Exponential backoff, the delay is multiplied with BackoffMultiplier
+	// for every restart and capped at MaxDelay seconds.
+	ExponentialBackoff bool
+	BackoffMultiplier  float64
+	MaxDelay           int
+	// Jitter adds a random duration up to the given value to the restart delay.
+	Jitter time.Duration
+
+	// Circuit breaker, stops the service gracefully after CircuitBreakAfter
+	// restarts within CircuitBreakDuration.
+	CircuitBreakAfter    int
+	CircuitBreakDuration time.Duration
+
+	// Webhook settings, TLS certificates aren't verified if WebhookInsecure is set.
+	WebhookURL      string
+	WebhookTimeout  time.Duration
+	WebhookInsecure bool
 }
 
+// DefaultBackoffMultiplier is used if exponential backoff is enabled without a multiplier.
+const DefaultBackoffMultiplier = 2.0
+
 // StopSignal specifies a signal to send to a process
 // if the service has to stop.
 type StopSignal int
 
 // Signals to send to a process to gracefully terminate a process.
 // WmQuit and WmClose signal works only for application with a window.
+// Some console applications (ex. Java) only respond to Ctrl-Break.
 const (
 	CtrlCSignal StopSignal = 1 << iota
 	WmQuitSignal
 	WmCloseSignal
+	CtrlBreakSignal
 
 	NoSignal StopSignal = 0
 )
@@ -371,6 +1095,9 @@ func (s StopSignal) String() string {
 	if s&CtrlCSignal == CtrlCSignal {
 		strs = append(strs, "Ctrl-C")
 	}
+	if s&CtrlBreakSignal == CtrlBreakSignal {
+		strs = append(strs, "Ctrl-Break")
+	}
 	if s&WmCloseSignal == WmCloseSignal {
 		strs = append(strs, "WM_CLOSE")
 	}
@@ -381,7 +1108,107 @@ func (s StopSignal) String() string {
 	return strings.Join(strs, " | ")
 }
 
-const swRegBaseKey = "SOFTWARE\\go-sharp\\cerberus\\services"
+const defaultRegBaseKey = "SOFTWARE\\go-sharp\\cerberus\\services"
+
+// swRegBaseKey is the registry key below swRegRoot where the services are stored,
+// it can be changed with the CERBERUS_REGISTRY_KEY environment variable.
+// swRegRoot is HKLM, or HKCU if the user scope is enabled (see SetUserScope).
+var swRegRoot, swRegBaseKey = regScopeFromEnv()
+
+// ConfigScope is the scope the cerberus configuration of a service is stored in.
+type ConfigScope string
+
+const (
+	// SystemScope stores the configuration system-wide in HKLM.
+	SystemScope ConfigScope = "system"
+	// UserScope stores the configuration private to the user in HKCU.
+	UserScope ConfigScope = "user"
+)
+
+// regScopeFromEnv returns the registry root and base key selected by CERBERUS_USER_SCOPE. The
+// service process of a user-scoped service runs as a different account, so its environment
+// contains the SID of the installing user and the hive below HKEY_USERS is used instead.
+func regScopeFromEnv() (registry.Key, string) {
+	base := regBaseKeyFromEnv()
+	switch value := os.Getenv("CERBERUS_USER_SCOPE"); {
+	case value == "" || value == "0":
+		return registry.LOCAL_MACHINE, base
+	case strings.HasPrefix(value, "S-"):
+		return registry.USERS, value + "\\" + base
+	default:
+		return registry.CURRENT_USER, base
+	}
+}
+
+// SetUserScope selects whether the service configurations are stored private to the
+// current user instead of system-wide, it overrides the CERBERUS_USER_SCOPE variable.
+func SetUserScope(enabled bool) {
+	if enabled {
+		swRegRoot, swRegBaseKey = registry.CURRENT_USER, regBaseKeyFromEnv()
+	} else {
+		swRegRoot, swRegBaseKey = registry.LOCAL_MACHINE, regBaseKeyFromEnv()
+	}
+}
+
+func currentScope() ConfigScope {
+	if swRegRoot == registry.LOCAL_MACHINE {
+		return SystemScope
+	}
+	return UserScope
+}
+
+func regBaseKeyFromEnv() string {
+	key := os.Getenv("CERBERUS_REGISTRY_KEY")
+	if key == "" {
+		return defaultRegBaseKey
+	}
+
+	if !isValidRegistryPath(key) {
+		Logf(Logger, "Invalid CERBERUS_REGISTRY_KEY '%v', using the default key...\n", Field("value", key), Field("variable", "CERBERUS_REGISTRY_KEY"))
+		return defaultRegBaseKey
+	}
+	return key
+}
+
+// isValidRegistryPath reports whether path is a relative registry path like SOFTWARE\vendor\app.
+func isValidRegistryPath(path string) bool {
+	// Key names are limited to 255 characters and can't be empty.
+	for _, name := range strings.Split(path, "\\") {
+		if name == "" || len(name) > 255 || strings.TrimSpace(name) != name {
+			return false
+		}
+		for _, r := range name {
+			if r < 0x20 || r == '*' || r == '?' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// setServiceEnvironment passes the cerberus environment variables, which select where the
+// configuration is stored, to the service process started by the SCM.
+func setServiceEnvironment(s SCMService, computer string) error {
+	var env []string
+	for _, v := range []string{"CERBERUS_REGISTRY_KEY", "CERBERUS_STORAGE"} {
+		// The copy of the configuration on a remote computer is always stored in the registry.
+		if value := os.Getenv(v); value != "" && (computer == "" || v != "CERBERUS_STORAGE") {
+			env = append(env, v+"="+value)
+		}
+	}
+	if swRegRoot == registry.CURRENT_USER {
+		user, err := windows.GetCurrentProcessToken().GetTokenUser()
+		if err != nil {
+			return err
+		}
+		env = append(env, "CERBERUS_USER_SCOPE="+user.User.Sid.String())
+	}
+	if len(env) == 0 {
+		return nil
+	}
+
+	return s.SetEnvironment(env)
+}
 
 // RemoveServiceCfg removes the service configuration form the cerberus service db.
 // It returns a generic error if call fails.
@@ -390,23 +1217,14 @@ func RemoveServiceCfg(name string) error {
 		return newError(ErrGeneric, "empty service name is not allowed")
 	}
 
-	if err := registry.DeleteKey(registry.LOCAL_MACHINE, swRegBaseKey+"\\"+name); err != nil {
-		return newErrorW(ErrGeneric, "failed to remove service entry for service '%v'", err, name)
-	}
-
-	return nil
+	return ConfigStorage.Delete(name)
 }
 
 // LoadServicesCfg loads all configured services.
 func LoadServicesCfg() (svcs []*SvcConfig, err error) {
-	key, err := registry.OpenKey(registry.LOCAL_MACHINE, swRegBaseKey, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
-	if err != nil {
-		return nil, newError(ErrLoadServiceCfg, "couldn't find any services")
-	}
-
-	services, err := key.ReadSubKeyNames(-1)
+	services, err := ConfigStorage.List()
 	if err != nil {
-		return nil, newErrorW(ErrLoadServiceCfg, "failed to read services", err)
+		return nil, err
 	}
 
 	for i := range services {
@@ -420,29 +1238,146 @@ func LoadServicesCfg() (svcs []*SvcConfig, err error) {
 	return svcs, nil
 }
 
-// LoadServiceCfg loads a service configuration for a given service
-// from the cerberus service db.
-func LoadServiceCfg(name string) (cfg *SvcConfig, err error) {
-	DebugLogger.Println("Loading service configuration for " + name + "...")
-	if name == "" {
-		return nil, newError(ErrLoadServiceCfg, "empty service name is not allowed")
+// LoadAllServicesCfg loads the configuration of all services like LoadServicesCfg, but services
+// which can't be loaded aren't skipped silently. Their errors are returned as AggregateError,
+// the successfully loaded services are returned in any case.
+func LoadAllServicesCfg() ([]*SvcConfig, error) {
+	services, err := ConfigStorage.List()
+	if err != nil {
+		return nil, err
 	}
 
-	cfg, err = loadSvcCfgRegistry(name)
+	var svcs []*SvcConfig
+	var errs AggregateError
+	for _, name := range services {
+		c, err := LoadServiceCfg(name)
+		if err != nil {
+			errs.add(err, name)
+			continue
+		}
+		svcs = append(svcs, c)
+	}
+
+	return svcs, errs.errOrNil()
+}
+
+// InstallServices installs all given services. A failure doesn't stop the remaining
+// services from being installed, all failures are returned as AggregateError.
+func InstallServices(configs []SvcConfig) error {
+	var errs AggregateError
+	for _, cfg := range configs {
+		if err := InstallService(cfg); err != nil {
+			errs.add(err, "installing "+cfg.Name)
+		}
+	}
+	return errs.errOrNil()
+}
+
+// RemoveServices removes all services with the given names. A failure doesn't stop the
+// remaining services from being removed, all failures are returned as AggregateError.
+func RemoveServices(names []string) error {
+	var errs AggregateError
+	for _, name := range names {
+		if err := RemoveService(name); err != nil {
+			errs.add(err, "removing "+name)
+		}
+	}
+	return errs.errOrNil()
+}
+
+// ListRunningServices loads all configured services which are
+// currently running according to the SCM.
+func ListRunningServices() (svcs []*SvcConfig, err error) {
+	services, err := ConfigStorage.List()
 	if err != nil {
 		return nil, err
 	}
 
-	manager, err := mgr.Connect()
+	DebugLogger.Println("Open connection to service control manager...")
+	manager, err := defaultManager.connect()
 	if err != nil {
-		return nil, newErrorW(ErrSCMConnect, "failed to connect to service control manager", err)
+		return nil, err
 	}
 	defer manager.Disconnect()
 
+	for i := range services {
+		c, err := defaultManager.loadServiceCfg(manager, services[i], func(s SCMService) bool {
+			status, err := s.Query()
+			return err == nil && status.State == svc.Running
+		})
+		if err != nil {
+			DebugLogger.Println("skipping item", services[i], ":", err)
+			continue
+		}
+
+		if c != nil {
+			svcs = append(svcs, c)
+		}
+	}
+
+	return svcs, nil
+}
+
+func loadServiceNames() ([]string, error) {
+	key, err := registry.OpenKey(swRegRoot, swRegBaseKey, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil, newError(ErrLoadServiceCfg, "couldn't find any services")
+	}
+	defer key.Close()
+
+	keys, err := key.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to read services", err)
+	}
+
+	// Skip the keys of the atomic saves, unless only the previous configuration is left.
+	exists := map[string]bool{}
+	for _, k := range keys {
+		exists[k] = true
+	}
+
+	var services []string
+	for _, k := range keys {
+		switch {
+		case strings.HasSuffix(k, pendingKeySuffix):
+		case strings.HasSuffix(k, prevKeySuffix):
+			if name := strings.TrimSuffix(k, prevKeySuffix); !exists[name] {
+				services = append(services, name)
+			}
+		default:
+			services = append(services, k)
+		}
+	}
+
+	return services, nil
+}
+
+// LoadServiceCfg loads a service configuration for a given service
+// from the cerberus service db.
+func LoadServiceCfg(name string) (cfg *SvcConfig, err error) {
+	return defaultManager.LoadServiceCfg(name)
+}
+
+// loadServiceCfg loads the service configuration using an existing scm connection.
+// If filter is not nil and returns false for the opened service, nil is returned.
+func (m *Manager) loadServiceCfg(manager SCMClient, name string, filter func(s SCMService) bool) (cfg *SvcConfig, err error) {
+	cfg, err = m.loadStoredCfg(name)
+	if err != nil {
+		return nil, err
+	}
+	if !sameComputer(cfg.Computer, scmComputer) {
+		return nil, newError(ErrLoadServiceCfg, "service '%v' is installed on %v", name, computerName(cfg.Computer))
+	}
+
 	svc, err := manager.OpenService(name)
 	if err != nil {
 		return nil, newErrorW(ErrSaveServiceCfg, "failed to load serivce from scm", err)
 	}
+	defer svc.Close()
+
+	if filter != nil && !filter(svc) {
+		return nil, nil
+	}
 
 	scmCfg, err := svc.Config()
 	if err != nil {
@@ -450,8 +1385,21 @@ func LoadServiceCfg(name string) (cfg *SvcConfig, err error) {
 	}
 
 	cfg.ServiceUser = scmCfg.ServiceStartName
+	cfg.UseVirtualAccount = strings.EqualFold(scmCfg.ServiceStartName, VirtualAccountName(name))
+	cfg.UseGMSA = strings.HasSuffix(scmCfg.ServiceStartName, "$")
+	loadServiceStats(cfg)
 	cfg.Dependencies = scmCfg.Dependencies
 
+	// The security can only be queried by users with READ_CONTROL access, the configuration is still usable without it.
+	if cfg.ServiceACL, err = svc.DACL(); err != nil {
+		DebugLogger.Println(err)
+	}
+
+	// The privileges of a remote or restricted service may not be queryable either.
+	if cfg.RequiredPrivileges, err = svc.RequiredPrivileges(); err != nil {
+		DebugLogger.Println(err)
+	}
+
 	if scmCfg.DelayedAutoStart && StartType(scmCfg.StartType) == AutoStartType {
 		cfg.StartType = AutoDelayedStartType
 	} else {
@@ -463,10 +1411,15 @@ func LoadServiceCfg(name string) (cfg *SvcConfig, err error) {
 
 func loadSvcCfgRegistry(name string) (cfg *SvcConfig, err error) {
 	cfg = &SvcConfig{}
-	key, err := registry.OpenKey(registry.LOCAL_MACHINE, swRegBaseKey+"\\"+name, registry.QUERY_VALUE)
+	key, err := registry.OpenKey(swRegRoot, swRegBaseKey+"\\"+name, registry.QUERY_VALUE)
+	if err == registry.ErrNotExist {
+		// A save was interrupted while swapping the keys, the previous configuration is still complete.
+		key, err = registry.OpenKey(swRegRoot, swRegBaseKey+"\\"+name+prevKeySuffix, registry.QUERY_VALUE)
+	}
 	if err != nil {
 		return nil, newError(ErrLoadServiceCfg, "couldn't find service '%v'", name)
 	}
+	defer key.Close()
 
 	if cfg.Name, _, err = key.GetStringValue("Name"); err != nil {
 		return nil, newErrorW(ErrLoadServiceCfg, "failed to read name", err)
@@ -488,6 +1441,9 @@ func loadSvcCfgRegistry(name string) (cfg *SvcConfig, err error) {
 		return nil, newErrorW(ErrLoadServiceCfg, "failed to read workdir", err)
 	}
 
+	createWorkDir, _, _ := key.GetIntegerValue("WorkDirCreate")
+	cfg.WorkDirCreate = createWorkDir != 0
+
 	if cfg.Args, _, err = key.GetStringsValue("Args"); err != nil {
 		return nil, newErrorW(ErrLoadServiceCfg, "failed to read arguments", err)
 	}
@@ -496,9 +1452,90 @@ func loadSvcCfgRegistry(name string) (cfg *SvcConfig, err error) {
 		return nil, newErrorW(ErrLoadServiceCfg, "failed to read environment vars", err)
 	}
 
+	cfg.EnvFile, _, _ = key.GetStringValue("EnvFile")
+	cfg.InheritEnv, _, _ = key.GetStringsValue("InheritEnv")
+	cfg.OptionalDependencies, _, _ = key.GetStringsValue("OptionalDependencies")
+	inheritAll, _, _ := key.GetIntegerValue("InheritEnvAll")
+	cfg.InheritEnvAll = inheritAll != 0
+	noExpandEnv, _, _ := key.GetIntegerValue("NoExpandEnv")
+	cfg.NoExpandEnv = noExpandEnv != 0
+	useCredMan, _, _ := key.GetIntegerValue("UseCredentialManager")
+	cfg.UseCredentialManager = useCredMan != 0
+
 	signal, _, _ := key.GetIntegerValue("StopSignal")
 	cfg.StopSignal = StopSignal(signal)
 
+	priority, _, _ := key.GetIntegerValue("Priority")
+	cfg.Priority = ProcessPriority(priority)
+
+	ioPriority, _, _ := key.GetIntegerValue("IOPriority")
+	cfg.IOPriority = IOPriority(ioPriority)
+
+	cfg.CPUAffinity, _, _ = key.GetIntegerValue("CPUAffinity")
+	cfg.MemoryLimitMB, _, _ = key.GetIntegerValue("MemoryLimitMB")
+	cfg.StdinFile, _, _ = key.GetStringValue("StdinFile")
+	cfg.StdoutLog, _, _ = key.GetStringValue("StdoutLog")
+	cfg.StderrLog, _, _ = key.GetStringValue("StderrLog")
+	cfg.LogMaxSizeMB, _, _ = key.GetIntegerValue("LogMaxSizeMB")
+	backups, _, _ := key.GetIntegerValue("LogMaxBackups")
+	cfg.LogMaxBackups = int(backups)
+	metricsPort, _, _ := key.GetIntegerValue("MetricsPort")
+	cfg.MetricsPort = uint16(metricsPort)
+	cfg.Computer, _, _ = key.GetStringValue("Computer")
+	cfg.Group, _, _ = key.GetStringValue("Group")
+
+	labels, _, _ := key.GetStringsValue("Labels")
+	cfg.Labels = decodeLabels(labels)
+
+	notes, _, _ := key.GetStringValue("Notes")
+	cfg.Notes = strings.TrimRightFunc(notes, unicode.IsSpace)
+
+	previousStartType, _, _ := key.GetIntegerValue("PreviousStartType")
+	cfg.PreviousStartType = StartType(previousStartType)
+
+	schemaVersion, _, _ := key.GetIntegerValue("SchemaVersion")
+	cfg.SchemaVersion = int(schemaVersion)
+	cfg.Scope = currentScope()
+
+	cfg.PreStartCmd, _, _ = key.GetStringValue("PreStartCmd")
+	cfg.PreStartArgs, _, _ = key.GetStringsValue("PreStartArgs")
+	if timeout, _, err := key.GetStringValue("PreStartTimeout"); err == nil && timeout != "" {
+		if cfg.PreStartTimeout, err = time.ParseDuration(timeout); err != nil {
+			return nil, newErrorW(ErrLoadServiceCfg, "failed to read pre-start timeout", err)
+		}
+	}
+	cfg.PostStopCmd, _, _ = key.GetStringValue("PostStopCmd")
+	cfg.PostStopArgs, _, _ = key.GetStringsValue("PostStopArgs")
+	cfg.PreInstallCmd, _, _ = key.GetStringValue("PreInstallCmd")
+	cfg.PreInstallArgs, _, _ = key.GetStringsValue("PreInstallArgs")
+	cfg.PostInstallCmd, _, _ = key.GetStringValue("PostInstallCmd")
+	cfg.PostInstallArgs, _, _ = key.GetStringsValue("PostInstallArgs")
+	cfg.PreRemoveCmd, _, _ = key.GetStringValue("PreRemoveCmd")
+	cfg.PreRemoveArgs, _, _ = key.GetStringsValue("PreRemoveArgs")
+
+	if timeout, _, err := key.GetStringValue("StopTimeout"); err == nil && timeout != "" {
+		if cfg.StopTimeout, err = time.ParseDuration(timeout); err != nil {
+			return nil, newErrorW(ErrLoadServiceCfg, "failed to read stop timeout", err)
+		}
+	}
+
+	if interval, _, err := key.GetStringValue("WatchdogInterval"); err == nil && interval != "" {
+		if cfg.WatchdogInterval, err = time.ParseDuration(interval); err != nil {
+			return nil, newErrorW(ErrLoadServiceCfg, "failed to read watchdog interval", err)
+		}
+	}
+	cfg.WatchdogURL, _, _ = key.GetStringValue("WatchdogURL")
+	watchdogCPU, _, _ := key.GetIntegerValue("WatchdogCPU")
+	cfg.WatchdogCPU = watchdogCPU != 0
+	threshold, _, _ := key.GetIntegerValue("WatchdogFailThreshold")
+	cfg.WatchdogFailThreshold = int(threshold)
+
+	if data, _, err := key.GetBinaryValue("JobObject"); err == nil {
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&cfg.JobObject); err != nil {
+			return nil, newErrorW(ErrLoadServiceCfg, "failed to read job object configuration", err)
+		}
+	}
+
 	if data, _, err := key.GetBinaryValue("RecoveryActions"); err == nil {
 		dec := gob.NewDecoder(bytes.NewReader(data))
 		if err := dec.Decode(&cfg.RecoveryActions); err != nil {
@@ -511,11 +1548,11 @@ func loadSvcCfgRegistry(name string) (cfg *SvcConfig, err error) {
 	return cfg, nil
 }
 
-func updateSCMProperties(cfg *SvcConfig) error {
+func (m *Manager) updateSCMProperties(cfg *SvcConfig) error {
 	DebugLogger.Println("Updating SCM service properties...")
-	manager, err := mgr.Connect()
+	manager, err := m.connect()
 	if err != nil {
-		return newErrorW(ErrSCMConnect, "failed to connect to service control manager", err)
+		return err
 	}
 	defer manager.Disconnect()
 
@@ -534,6 +1571,7 @@ func updateSCMProperties(cfg *SvcConfig) error {
 		config.DelayedAutoStart = true
 	} else {
 		config.StartType = uint32(cfg.StartType)
+		config.DelayedAutoStart = false
 	}
 
 	config.Dependencies = cfg.Dependencies
@@ -541,13 +1579,32 @@ func updateSCMProperties(cfg *SvcConfig) error {
 		config.Dependencies = []string{"\x00"}
 	}
 
-	if cfg.ServiceUser == "" {
+	switch {
+	case cfg.UseVirtualAccount:
+		// Virtual accounts are managed by windows and have no password.
+		config.ServiceStartName = VirtualAccountName(cfg.Name)
+		config.Password = ""
+	case cfg.ServiceUser == "":
 		config.ServiceStartName = "LocalSystem"
-	} else {
+	default:
 		config.ServiceStartName = cfg.ServiceUser
 	}
 
-	if cfg.Password != nil {
+	if cfg.UseCredentialManager {
+		// A passed password is kept in the credential manager, it never reaches the cerberus configuration.
+		if cfg.Password != nil {
+			if err := writeCredential(CredentialTarget(cfg.Name), *cfg.Password); err != nil {
+				return err
+			}
+			config.Password = *cfg.Password
+		} else if !isLocalSystem(cfg.ServiceUser) {
+			password, err := readCredential(CredentialTarget(cfg.Name))
+			if err != nil {
+				return newErrorW(ErrSaveServiceCfg, "failed to read password of service user from credential manager, set it with 'cerberus credential set %v'", err, cfg.Name)
+			}
+			config.Password = password
+		}
+	} else if cfg.Password != nil && !cfg.UseVirtualAccount && !cfg.UseGMSA {
 		config.Password = *cfg.Password
 	}
 
@@ -558,23 +1615,53 @@ func updateSCMProperties(cfg *SvcConfig) error {
 		return newErrorW(ErrSaveServiceCfg, "failed to update scm properties", err)
 	}
 
+	if cfg.ServiceACL != "" {
+		if err := svc.SetDACL(cfg.ServiceACL); err != nil {
+			return err
+		}
+	}
+
+	if err := svc.SetRequiredPrivileges(cfg.RequiredPrivileges); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 // saveServiceCfg saves a given configuration in the cerberus service db.
 func saveServiceCfg(config SvcConfig) error {
+	return defaultManager.saveServiceCfg(config)
+}
+
+func (m *Manager) saveServiceCfg(config SvcConfig) error {
 	if config.Name == "" {
 		return newError(ErrSaveServiceCfg, "empty service name is not allowed")
 	}
 
 	// Save scm properties
-	if err := updateSCMProperties(&config); err != nil {
+	if err := m.updateSCMProperties(&config); err != nil {
 		return err
 	}
 
-	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, swRegBaseKey+"\\"+config.Name, registry.CREATE_SUB_KEY|registry.WRITE)
-	if err != nil {
-		return newErrorW(ErrSaveServiceCfg, "failed to create registry entry", err)
+	config.SchemaVersion = CurrentSchemaVersion
+	if err := m.storage().Save(config); err != nil {
+		return err
+	}
+
+	if config.Computer != "" {
+		return saveRemoteCfg(config)
+	}
+	return nil
+}
+
+// writeSvcCfgRegistry writes the cerberus specific properties to the given registry key.
+func writeSvcCfgRegistry(key registry.Key, config SvcConfig) error {
+	if err := key.SetDWordValue("SvcConfigVersion", svcConfigVersion); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set config version", err)
+	}
+
+	if err := key.SetDWordValue("SchemaVersion", uint32(config.SchemaVersion)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set schema version", err)
 	}
 
 	if err := key.SetStringValue("Name", config.Name); err != nil {
@@ -597,6 +1684,10 @@ func saveServiceCfg(config SvcConfig) error {
 		return newErrorW(ErrSaveServiceCfg, "failed to set workdir", err)
 	}
 
+	if err := key.SetDWordValue("WorkDirCreate", boolToDWord(config.WorkDirCreate)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set create workdir", err)
+	}
+
 	if err := key.SetStringsValue("Args", config.Args); err != nil {
 		return newErrorW(ErrSaveServiceCfg, "failed to set arguments", err)
 	}
@@ -605,10 +1696,166 @@ func saveServiceCfg(config SvcConfig) error {
 		return newErrorW(ErrSaveServiceCfg, "failed to set environment vars", err)
 	}
 
+	if err := key.SetStringsValue("InheritEnv", config.InheritEnv); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set inherited environment vars", err)
+	}
+
+	if err := key.SetStringsValue("OptionalDependencies", config.OptionalDependencies); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set optional dependencies", err)
+	}
+
+	if err := key.SetDWordValue("InheritEnvAll", boolToDWord(config.InheritEnvAll)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set inherit all environment vars", err)
+	}
+
+	if err := key.SetDWordValue("NoExpandEnv", boolToDWord(config.NoExpandEnv)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set no expand environment vars", err)
+	}
+
+	if err := key.SetDWordValue("UseCredentialManager", boolToDWord(config.UseCredentialManager)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set use credential manager", err)
+	}
+
+	if err := key.SetStringValue("EnvFile", config.EnvFile); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set env file", err)
+	}
+
 	if err := key.SetDWordValue("StopSignal", uint32(config.StopSignal)); err != nil {
 		return newErrorW(ErrSaveServiceCfg, "failed to set stop signal", err)
 	}
 
+	if err := key.SetStringValue("StopTimeout", config.StopTimeout.String()); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set stop timeout", err)
+	}
+
+	if err := key.SetStringValue("WatchdogInterval", config.WatchdogInterval.String()); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set watchdog interval", err)
+	}
+
+	if err := key.SetStringValue("WatchdogURL", config.WatchdogURL); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set watchdog url", err)
+	}
+
+	if err := key.SetDWordValue("WatchdogCPU", boolToDWord(config.WatchdogCPU)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set watchdog cpu check", err)
+	}
+
+	if err := key.SetDWordValue("WatchdogFailThreshold", uint32(config.WatchdogFailThreshold)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set watchdog fail threshold", err)
+	}
+
+	if err := key.SetDWordValue("Priority", uint32(config.Priority)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set priority", err)
+	}
+
+	if err := key.SetDWordValue("IOPriority", uint32(config.IOPriority)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set i/o priority", err)
+	}
+
+	if err := key.SetQWordValue("CPUAffinity", config.CPUAffinity); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set cpu affinity", err)
+	}
+
+	if err := key.SetQWordValue("MemoryLimitMB", config.MemoryLimitMB); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set memory limit", err)
+	}
+
+	if err := key.SetStringValue("StdinFile", config.StdinFile); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set stdin file", err)
+	}
+
+	if err := key.SetStringValue("StdoutLog", config.StdoutLog); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set stdout log", err)
+	}
+
+	if err := key.SetStringValue("StderrLog", config.StderrLog); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set stderr log", err)
+	}
+
+	if err := key.SetQWordValue("LogMaxSizeMB", config.LogMaxSizeMB); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set log max size", err)
+	}
+
+	if err := key.SetDWordValue("LogMaxBackups", uint32(config.LogMaxBackups)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set log max backups", err)
+	}
+
+	if err := key.SetDWordValue("MetricsPort", uint32(config.MetricsPort)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set metrics port", err)
+	}
+
+	if err := key.SetStringValue("Computer", config.Computer); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set computer", err)
+	}
+
+	if err := key.SetStringValue("Group", config.Group); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set group", err)
+	}
+
+	if err := key.SetStringsValue("Labels", encodeLabels(config.Labels)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set labels", err)
+	}
+
+	if err := key.SetStringValue("Notes", config.Notes); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set notes", err)
+	}
+
+	if err := key.SetDWordValue("PreviousStartType", uint32(config.PreviousStartType)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set previous start type", err)
+	}
+
+	if err := key.SetStringValue("PreStartCmd", config.PreStartCmd); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set pre-start hook", err)
+	}
+
+	if err := key.SetStringsValue("PreStartArgs", config.PreStartArgs); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set pre-start hook arguments", err)
+	}
+
+	if err := key.SetStringValue("PreStartTimeout", config.PreStartTimeout.String()); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set pre-start timeout", err)
+	}
+
+	if err := key.SetStringValue("PostStopCmd", config.PostStopCmd); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set post-stop hook", err)
+	}
+
+	if err := key.SetStringsValue("PostStopArgs", config.PostStopArgs); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set post-stop hook arguments", err)
+	}
+
+	if err := key.SetStringValue("PreInstallCmd", config.PreInstallCmd); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set pre-install hook", err)
+	}
+
+	if err := key.SetStringsValue("PreInstallArgs", config.PreInstallArgs); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set pre-install hook arguments", err)
+	}
+
+	if err := key.SetStringValue("PostInstallCmd", config.PostInstallCmd); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set post-install hook", err)
+	}
+
+	if err := key.SetStringsValue("PostInstallArgs", config.PostInstallArgs); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set post-install hook arguments", err)
+	}
+
+	if err := key.SetStringValue("PreRemoveCmd", config.PreRemoveCmd); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set pre-remove hook", err)
+	}
+
+	if err := key.SetStringsValue("PreRemoveArgs", config.PreRemoveArgs); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set pre-remove hook arguments", err)
+	}
+
+	var job bytes.Buffer
+	if err := gob.NewEncoder(&job).Encode(config.JobObject); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to serialize job object configuration", err)
+	}
+	if err := key.SetBinaryValue("JobObject", job.Bytes()); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set job object configuration", err)
+	}
+
 	if config.RecoveryActions != nil {
 		var buf bytes.Buffer
 		if err := gob.NewEncoder(&buf).Encode(config.RecoveryActions); err != nil {
@@ -623,6 +1870,67 @@ func saveServiceCfg(config SvcConfig) error {
 	return nil
 }
 
+func boolToDWord(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// isSubPath reports whether path is equal to or located inside of base.
+func isSubPath(base, path string) bool {
+	base = strings.ToLower(filepath.Clean(base)) + string(filepath.Separator)
+	path = strings.ToLower(filepath.Clean(path)) + string(filepath.Separator)
+	return strings.HasPrefix(path, base)
+}
+
+// servicesUsingExePath returns the names of the services running the executable.
+func (m *Manager) servicesUsingExePath(exePath string) []string {
+	names, err := m.storage().List()
+	if err != nil {
+		return nil
+	}
+
+	var svcs []string
+	for _, name := range names {
+		cfg, err := m.loadStoredCfg(name)
+		if err == nil && strings.EqualFold(filepath.Clean(cfg.ExePath), filepath.Clean(exePath)) {
+			svcs = append(svcs, cfg.Name)
+		}
+	}
+	return svcs
+}
+
+// isUNCPath reports whether the path is located on a network share (\\server\share or \\?\UNC\server\share).
+func isUNCPath(path string) bool {
+	path = strings.ReplaceAll(path, "/", `\`)
+	if strings.HasPrefix(path, `\\?\`) || strings.HasPrefix(path, `\\.\`) {
+		return strings.HasPrefix(strings.ToUpper(path[4:]), `UNC\`)
+	}
+	return strings.HasPrefix(path, `\\`)
+}
+
+// encodeLabels converts the labels into a sorted list of key=value pairs.
+func encodeLabels(labels map[string]string) []string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// decodeLabels converts a list of key=value pairs into a label map.
+func decodeLabels(pairs []string) map[string]string {
+	labels := map[string]string{}
+	for _, p := range pairs {
+		if idx := strings.Index(p, "="); idx > 0 {
+			labels[p[:idx]] = p[idx+1:]
+		}
+	}
+	return labels
+}
+
 func trimArgs(args []string) {
 	if len(args) > 0 {
 		DebugLogger.Println("Removing leading/trailing quotes from arguments...")
@@ -0,0 +1,180 @@
+//go:build integration
+
+package cerberus_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-sharp/cerberus/v2"
+	"github.com/go-sharp/cerberus/v2/cerberustest"
+)
+
+// The services of the integration tests are prefixed, so leftovers can be removed safely.
+const testServicePrefix = "cerberus-it-"
+
+const helloWorldSource = `package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func main() {
+	for {
+		fmt.Println("hello world")
+		time.Sleep(time.Second)
+	}
+}
+`
+
+// helloWorldPath is the executable the services of the tests run, it is built by TestMain.
+var helloWorldPath string
+
+func TestMain(m *testing.M) {
+	// The services run the test binary with the run command, like cerberus itself.
+	if len(os.Args) == 3 && os.Args[1] == "run" {
+		if err := cerberus.RunService(os.Args[2]); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if !cerberustest.IsAdmin() {
+		fmt.Println("skipping integration tests: administrator rights are required")
+		os.Exit(0)
+	}
+
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "cerberus-it")
+	if err != nil {
+		fmt.Println("failed to create temporary directory:", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	if helloWorldPath, err = buildHelloWorld(dir); err != nil {
+		fmt.Println("failed to build hello world binary:", err)
+		return 1
+	}
+
+	// Removes the services of tests which didn't clean up, even if a test panicked.
+	defer removeLeftovers()
+	return m.Run()
+}
+
+func buildHelloWorld(dir string) (string, error) {
+	src := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(src, []byte(helloWorldSource), 0o644); err != nil {
+		return "", err
+	}
+
+	exe := filepath.Join(dir, "hello.exe")
+	cmd := exec.Command("go", "build", "-o", exe, src)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("%v: %s", err, output)
+	}
+	return exe, nil
+}
+
+func removeLeftovers() {
+	svcs, err := cerberus.LoadServicesCfg()
+	if err != nil {
+		return
+	}
+	for _, svc := range svcs {
+		if strings.HasPrefix(svc.Name, testServicePrefix) {
+			if err := cerberus.RemoveService(svc.Name); err != nil {
+				fmt.Printf("failed to remove leftover service %v: %v\n", svc.Name, err)
+			}
+		}
+	}
+}
+
+func testConfig(t *testing.T) cerberus.SvcConfig {
+	return cerberus.SvcConfig{
+		Name:    testServicePrefix + strings.ToLower(strings.ReplaceAll(t.Name(), "/", "-")),
+		ExePath: helloWorldPath,
+		Desc:    "cerberus integration test",
+	}
+}
+
+func TestInstallUpdateRemove(t *testing.T) {
+	cfg := testConfig(t)
+	installed := cerberustest.InstallService(t, cfg)
+	if installed.ExePath != helloWorldPath {
+		t.Errorf("ExePath = %v, want %v", installed.ExePath, helloWorldPath)
+	}
+	if installed.StartType != cerberus.ManualStartType {
+		t.Errorf("StartType = %v, want %v", installed.StartType, cerberus.ManualStartType)
+	}
+
+	installed.Desc = "updated description"
+	installed.Args = []string{"--verbose"}
+	installed.StartType = cerberus.AutoStartType
+	if err := cerberus.UpdateService(*installed); err != nil {
+		t.Fatalf("failed to update service %v: %v", cfg.Name, err)
+	}
+
+	updated, err := cerberus.LoadServiceCfg(cfg.Name)
+	if err != nil {
+		t.Fatalf("failed to load service %v: %v", cfg.Name, err)
+	}
+	if updated.Desc != "updated description" {
+		t.Errorf("Desc = %v, want %v", updated.Desc, "updated description")
+	}
+	if len(updated.Args) != 1 || updated.Args[0] != "--verbose" {
+		t.Errorf("Args = %v, want [--verbose]", updated.Args)
+	}
+	if updated.StartType != cerberus.AutoStartType {
+		t.Errorf("StartType = %v, want %v", updated.StartType, cerberus.AutoStartType)
+	}
+
+	if err := cerberus.RemoveService(cfg.Name); err != nil {
+		t.Fatalf("failed to remove service %v: %v", cfg.Name, err)
+	}
+	cerberustest.AssertRemoved(t, cfg.Name)
+}
+
+func TestInstallRemoveCycles(t *testing.T) {
+	cfg := testConfig(t)
+	for i := 0; i < 3; i++ {
+		cerberustest.InstallService(t, cfg)
+		if err := cerberus.RemoveService(cfg.Name); err != nil {
+			t.Fatalf("cycle %v: failed to remove service %v: %v", i, cfg.Name, err)
+		}
+		cerberustest.AssertRemoved(t, cfg.Name)
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	cfg := testConfig(t)
+	cerberustest.InstallService(t, cfg)
+
+	if err := cerberus.StartService(cfg.Name); err != nil {
+		t.Fatalf("failed to start service %v: %v", cfg.Name, err)
+	}
+	if state, err := cerberus.GetServiceStatus(cfg.Name); err != nil || state != cerberus.RunningState {
+		t.Errorf("service %v is %v (%v), want %v", cfg.Name, state, err, cerberus.RunningState)
+	}
+
+	if err := cerberus.StopService(cfg.Name, 0); err != nil {
+		t.Fatalf("failed to stop service %v: %v", cfg.Name, err)
+	}
+	if state, err := cerberus.GetServiceStatus(cfg.Name); err != nil || state != cerberus.StoppedState {
+		t.Errorf("service %v is %v (%v), want %v", cfg.Name, state, err, cerberus.StoppedState)
+	}
+
+	if err := cerberus.RemoveService(cfg.Name); err != nil {
+		t.Fatalf("failed to remove service %v: %v", cfg.Name, err)
+	}
+	cerberustest.AssertRemoved(t, cfg.Name)
+}
@@ -0,0 +1,354 @@
+/*
+Package cerberustest provides helpers to test code using cerberus without a real service control manager.
+*/
+package cerberustest
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sharp/cerberus/v2"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// DefaultDACL is the DACL a service gets on creation, it allows administrators and
+// the local system full access and authenticated users to query the service.
+const DefaultDACL = "D:(A;;CCLCSWRPWPDTLOCRRC;;;SY)(A;;CCDCLCSWRPWPDTLOCRSDRCWDWO;;;BA)(A;;CCLCSWLOCRRC;;;AU)"
+
+// FakeSCMClient is an in-memory cerberus.SCMClient, use it as client of a cerberus.Manager.
+// Started and stopped services pass the pending states like with the real SCM, the time
+// they stay pending is configured with StartDelay and StopDelay.
+type FakeSCMClient struct {
+	// StartDelay is the time a started service stays in the StartPending state.
+	StartDelay time.Duration
+	// StopDelay is the time a stopped service stays in the StopPending state.
+	StopDelay time.Duration
+
+	mu           sync.Mutex
+	services     map[string]*fakeService
+	eventSources map[string]bool
+	calls        []Call
+}
+
+// Call is a recorded call of the FakeSCMClient or one of its services.
+type Call struct {
+	Method  string
+	Service string
+	Args    []string
+}
+
+// Calls returns all recorded calls in the order they were made.
+func (f *FakeSCMClient) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// CallCount returns how often the method was called for the service.
+func (f *FakeSCMClient) CallCount(method, service string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, c := range f.calls {
+		if c.Method == method && c.Service == service {
+			n++
+		}
+	}
+	return n
+}
+
+// record adds a call, it must be called with the client locked.
+func (f *FakeSCMClient) record(method, service string, args ...string) {
+	f.calls = append(f.calls, Call{Method: method, Service: service, Args: args})
+}
+
+// NewFakeSCMClient returns a fake service control manager without any services.
+func NewFakeSCMClient() *FakeSCMClient {
+	return &FakeSCMClient{
+		services:     map[string]*fakeService{},
+		eventSources: map[string]bool{},
+	}
+}
+
+// Connect returns the fake itself, it matches the signature of cerberus.SCMConnector.
+func (f *FakeSCMClient) Connect() (cerberus.SCMClient, error) {
+	return f, nil
+}
+
+// CreateService implements the cerberus.SCMClient interface.
+func (f *FakeSCMClient) CreateService(name, exepath string, c mgr.Config, args ...string) (cerberus.SCMService, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.record("CreateService", name, args...)
+	if _, ok := f.services[name]; ok {
+		return nil, windows.ERROR_SERVICE_EXISTS
+	}
+
+	c.BinaryPathName = exepath
+	if c.StartType == 0 {
+		c.StartType = mgr.StartManual
+	}
+	if c.ServiceStartName == "" {
+		c.ServiceStartName = "LocalSystem"
+	}
+
+	s := &fakeService{client: f, name: name, args: args, config: c, dacl: DefaultDACL, state: svc.Stopped}
+	f.services[name] = s
+	return s, nil
+}
+
+// OpenService implements the cerberus.SCMClient interface.
+func (f *FakeSCMClient) OpenService(name string) (cerberus.SCMService, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.record("OpenService", name)
+	s, ok := f.services[name]
+	if !ok {
+		return nil, windows.ERROR_SERVICE_DOES_NOT_EXIST
+	}
+	return s, nil
+}
+
+// ListServices implements the cerberus.SCMClient interface.
+func (f *FakeSCMClient) ListServices() ([]string, error) {
+	return f.Services(), nil
+}
+
+// Disconnect implements the cerberus.SCMClient interface.
+func (f *FakeSCMClient) Disconnect() error {
+	return nil
+}
+
+// InstallEventSource implements the cerberus.SCMClient interface.
+func (f *FakeSCMClient) InstallEventSource(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.record("InstallEventSource", name)
+	if f.eventSources[name] {
+		return windows.ERROR_ALREADY_EXISTS
+	}
+	f.eventSources[name] = true
+	return nil
+}
+
+// RemoveEventSource implements the cerberus.SCMClient interface.
+func (f *FakeSCMClient) RemoveEventSource(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.record("RemoveEventSource", name)
+	if !f.eventSources[name] {
+		return windows.ERROR_FILE_NOT_FOUND
+	}
+	delete(f.eventSources, name)
+	return nil
+}
+
+// Services returns the sorted names of all services.
+func (f *FakeSCMClient) Services() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := make([]string, 0, len(f.services))
+	for name := range f.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// State returns the state of the service, false if the service doesn't exist.
+func (f *FakeSCMClient) State(name string) (svc.State, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.services[name]
+	if !ok {
+		return 0, false
+	}
+	s.update()
+	return s.state, true
+}
+
+// HasEventSource reports whether the event log source of the service is registered.
+func (f *FakeSCMClient) HasEventSource(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.eventSources[name]
+}
+
+// fakeService is a service of the FakeSCMClient, all fields are guarded by the mutex of the client.
+type fakeService struct {
+	client     *FakeSCMClient
+	name       string
+	args       []string
+	config     mgr.Config
+	dacl       string
+	privileges []string
+	env        []string
+	state      svc.State
+	pid        uint32
+	// pendingUntil is the time the service leaves the current pending state.
+	pendingUntil time.Time
+}
+
+// update completes a pending state transition whose delay has expired.
+func (s *fakeService) update() {
+	if time.Now().Before(s.pendingUntil) {
+		return
+	}
+	switch s.state {
+	case svc.StartPending:
+		s.state = svc.Running
+	case svc.StopPending:
+		s.state, s.pid = svc.Stopped, 0
+	}
+}
+
+// transition moves the service into the pending state, which is left after the delay.
+func (s *fakeService) transition(pending svc.State, delay time.Duration) {
+	s.state = pending
+	s.pendingUntil = time.Now().Add(delay)
+	s.update()
+}
+
+func (s *fakeService) Name() string {
+	return s.name
+}
+
+func (s *fakeService) Config() (mgr.Config, error) {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	return s.config, nil
+}
+
+func (s *fakeService) UpdateConfig(c mgr.Config) error {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+
+	s.client.record("UpdateConfig", s.name)
+	// Like the SCM, an empty password keeps the current one.
+	if c.Password == "" {
+		c.Password = s.config.Password
+	}
+	// A single empty dependency removes all dependencies.
+	if len(c.Dependencies) == 1 && c.Dependencies[0] == "\x00" {
+		c.Dependencies = nil
+	}
+	s.config = c
+	return nil
+}
+
+func (s *fakeService) Query() (svc.Status, error) {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+
+	s.update()
+	return svc.Status{State: s.state, ProcessId: s.pid}, nil
+}
+
+func (s *fakeService) Control(c svc.Cmd) (svc.Status, error) {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+
+	s.client.record("Control", s.name)
+	s.update()
+	switch c {
+	case svc.Stop:
+		if s.state == svc.Stopped {
+			return svc.Status{State: s.state}, windows.ERROR_SERVICE_NOT_ACTIVE
+		}
+		if s.state == svc.StopPending {
+			return svc.Status{State: s.state, ProcessId: s.pid}, windows.ERROR_SERVICE_CANNOT_ACCEPT_CTRL
+		}
+		s.transition(svc.StopPending, s.client.StopDelay)
+	case svc.Interrogate:
+	default:
+		return svc.Status{State: s.state, ProcessId: s.pid}, windows.ERROR_INVALID_SERVICE_CONTROL
+	}
+	return svc.Status{State: s.state, ProcessId: s.pid}, nil
+}
+
+func (s *fakeService) Start(args ...string) error {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+
+	s.client.record("Start", s.name, args...)
+	s.update()
+	if s.config.StartType == mgr.StartDisabled {
+		return windows.ERROR_SERVICE_DISABLED
+	}
+	if s.state != svc.Stopped {
+		return windows.ERROR_SERVICE_ALREADY_RUNNING
+	}
+	s.pid = nextPID()
+	s.transition(svc.StartPending, s.client.StartDelay)
+	return nil
+}
+
+func (s *fakeService) Delete() error {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+
+	s.client.record("Delete", s.name)
+	if _, ok := s.client.services[s.name]; !ok {
+		return windows.ERROR_SERVICE_MARKED_FOR_DELETE
+	}
+	delete(s.client.services, s.name)
+	return nil
+}
+
+func (s *fakeService) Close() error {
+	return nil
+}
+
+func (s *fakeService) DACL() (string, error) {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	return s.dacl, nil
+}
+
+func (s *fakeService) SetDACL(sddl string) error {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	s.client.record("SetDACL", s.name, sddl)
+	s.dacl = sddl
+	return nil
+}
+
+func (s *fakeService) RequiredPrivileges() ([]string, error) {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	return append([]string(nil), s.privileges...), nil
+}
+
+func (s *fakeService) SetRequiredPrivileges(privileges []string) error {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	s.client.record("SetRequiredPrivileges", s.name, privileges...)
+	s.privileges = append([]string(nil), privileges...)
+	return nil
+}
+
+func (s *fakeService) SetEnvironment(env []string) error {
+	s.client.mu.Lock()
+	defer s.client.mu.Unlock()
+	s.client.record("SetEnvironment", s.name, env...)
+	s.env = append([]string(nil), env...)
+	return nil
+}
+
+var lastPID uint32 = 1000
+
+// nextPID returns a unique process id for a started service.
+func nextPID() uint32 {
+	return atomic.AddUint32(&lastPID, 4)
+}
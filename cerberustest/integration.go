@@ -0,0 +1,93 @@
+package cerberustest
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/go-sharp/cerberus/v2"
+	"golang.org/x/sys/windows"
+)
+
+// IsAdmin reports whether the process has the SeDebugPrivilege, which only administrators have.
+// Integration tests against the windows service control manager require it.
+func IsAdmin() bool {
+	var token windows.Token
+	if err := windows.OpenProcessToken(windows.CurrentProcess(), windows.TOKEN_QUERY, &token); err != nil {
+		return false
+	}
+	defer token.Close()
+
+	var debug windows.LUID
+	if err := windows.LookupPrivilegeValue(nil, windows.StringToUTF16Ptr("SeDebugPrivilege"), &debug); err != nil {
+		return false
+	}
+
+	var n uint32
+	windows.GetTokenInformation(token, windows.TokenPrivileges, nil, 0, &n)
+	if n == 0 {
+		return false
+	}
+	buf := make([]byte, n)
+	if err := windows.GetTokenInformation(token, windows.TokenPrivileges, &buf[0], n, &n); err != nil {
+		return false
+	}
+
+	privileges := (*windows.Tokenprivileges)(unsafe.Pointer(&buf[0]))
+	for _, p := range unsafe.Slice(&privileges.Privileges[0], privileges.PrivilegeCount) {
+		if p.Luid == debug {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireAdmin skips the test if the process has no administrator rights.
+func RequireAdmin(t testing.TB) {
+	t.Helper()
+	if !IsAdmin() {
+		t.Skip("administrator rights are required to access the service control manager")
+	}
+}
+
+// InstallService installs the service with the windows service control manager and removes it
+// when the test finishes, even if the test panics. The service runs the test binary with the run
+// command, like cerberus itself. The test is skipped without administrator rights.
+func InstallService(t testing.TB, cfg cerberus.SvcConfig) *cerberus.SvcConfig {
+	t.Helper()
+	RequireAdmin(t)
+
+	t.Cleanup(func() {
+		if _, err := cerberus.LoadServiceCfg(cfg.Name); err != nil {
+			return
+		}
+		if err := cerberus.RemoveService(cfg.Name); err != nil {
+			t.Errorf("failed to remove service %v: %v", cfg.Name, err)
+		}
+	})
+
+	if err := cerberus.InstallService(cfg); err != nil {
+		t.Fatalf("failed to install service %v: %v", cfg.Name, err)
+	}
+
+	installed, err := cerberus.LoadServiceCfg(cfg.Name)
+	if err != nil {
+		t.Fatalf("failed to load service %v: %v", cfg.Name, err)
+	}
+	return installed
+}
+
+// AssertRemoved fails the test if the service is still known by the windows service control
+// manager or cerberus has still a configuration of it.
+func AssertRemoved(t testing.TB, name string) {
+	t.Helper()
+	if _, err := cerberus.LoadServiceCfg(name); err == nil {
+		t.Errorf("service %v is still installed", name)
+	}
+	if names, err := cerberus.ConfigStorage.List(); err == nil {
+		for _, n := range names {
+			if n == name {
+				t.Errorf("configuration of service %v wasn't removed", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package cerberustest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-sharp/cerberus/v2"
+	"golang.org/x/sys/windows/svc"
+)
+
+// FakeManager is a cerberus.Manager with a FakeSCMClient and a FileStorage, see NewFakeManager.
+type FakeManager struct {
+	*FakeSCMClient
+	// Manager installs, updates, removes, loads and controls services with the fake client and the storage.
+	Manager *cerberus.Manager
+	// Storage stores the cerberus configurations in a temporary directory of the test.
+	Storage cerberus.FileStorage
+}
+
+// NewFakeManager returns a manager with a FakeSCMClient and a FileStorage in a temporary directory
+// of the test. The package level functions of cerberus aren't affected, so tests using it can run
+// in parallel. If the test fails, the calls of the fake are logged on cleanup.
+func NewFakeManager(t testing.TB) *FakeManager {
+	t.Helper()
+
+	m := &FakeManager{
+		FakeSCMClient: NewFakeSCMClient(),
+		Storage:       cerberus.FileStorage{Dir: t.TempDir()},
+	}
+	m.Manager = cerberus.NewManager(m.FakeSCMClient, m.Storage)
+	t.Cleanup(func() {
+		if !t.Failed() {
+			return
+		}
+		for _, c := range m.Calls() {
+			t.Logf("call: %v(%v) %v", c.Method, c.Service, c.Args)
+		}
+	})
+	return m
+}
+
+// AssertInstalled fails the test if the service doesn't exist.
+func (f *FakeSCMClient) AssertInstalled(t testing.TB, name string) {
+	t.Helper()
+	if _, ok := f.State(name); !ok {
+		t.Errorf("service %v isn't installed", name)
+	}
+}
+
+// AssertNotInstalled fails the test if the service exists.
+func (f *FakeSCMClient) AssertNotInstalled(t testing.TB, name string) {
+	t.Helper()
+	if _, ok := f.State(name); ok {
+		t.Errorf("service %v is installed", name)
+	}
+}
+
+// AssertState fails the test if the service isn't in the given state.
+func (f *FakeSCMClient) AssertState(t testing.TB, name string, state svc.State) {
+	t.Helper()
+	current, ok := f.State(name)
+	if !ok {
+		t.Errorf("service %v isn't installed", name)
+		return
+	}
+	if current != state {
+		t.Errorf("service %v is %v, expected %v", name, cerberus.ServiceState(current), cerberus.ServiceState(state))
+	}
+}
+
+// AssertStarted fails the test if the service isn't running or starting.
+func (f *FakeSCMClient) AssertStarted(t testing.TB, name string) {
+	t.Helper()
+	if current, _ := f.State(name); current != svc.StartPending {
+		f.AssertState(t, name, svc.Running)
+	}
+}
+
+// AssertStopped fails the test if the service isn't stopped or stopping.
+func (f *FakeSCMClient) AssertStopped(t testing.TB, name string) {
+	t.Helper()
+	if current, _ := f.State(name); current != svc.StopPending {
+		f.AssertState(t, name, svc.Stopped)
+	}
+}
+
+// AssertCalled fails the test if the method wasn't called for the service.
+func (f *FakeSCMClient) AssertCalled(t testing.TB, method, name string) {
+	t.Helper()
+	if f.CallCount(method, name) == 0 {
+		t.Errorf("%v wasn't called for service %v", method, name)
+	}
+}
+
+// WaitForState waits until the service reaches the given state and fails the test
+// if it doesn't within the timeout.
+func (f *FakeSCMClient) WaitForState(t testing.TB, name string, state svc.State, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		if current, _ := f.State(name); current == state {
+			return
+		}
+		if time.Now().After(deadline) {
+			f.AssertState(t, name, state)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
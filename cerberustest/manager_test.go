@@ -0,0 +1,223 @@
+package cerberustest_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-sharp/cerberus/v2"
+	"github.com/go-sharp/cerberus/v2/cerberustest"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// installFake installs a service running the test binary with the manager.
+func installFake(t *testing.T, m *cerberustest.FakeManager, name string) cerberus.SvcConfig {
+	t.Helper()
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failed to get test executable: %v", err)
+	}
+	cfg := cerberus.SvcConfig{Name: name, ExePath: exe, Desc: "fake service"}
+	if err := m.Manager.InstallService(context.Background(), cfg); err != nil {
+		t.Fatalf("failed to install service %v: %v", name, err)
+	}
+	return cfg
+}
+
+func TestManagerInstallUpdateRemove(t *testing.T) {
+	t.Parallel()
+	m := cerberustest.NewFakeManager(t)
+	cfg := installFake(t, m, "app")
+
+	m.AssertInstalled(t, "app")
+	m.AssertState(t, "app", svc.Stopped)
+	m.AssertCalled(t, "CreateService", "app")
+	m.AssertCalled(t, "InstallEventSource", "app")
+	if !m.HasEventSource("app") {
+		t.Errorf("event source of service app isn't registered")
+	}
+
+	installed, err := m.Manager.LoadServiceCfg("app")
+	if err != nil {
+		t.Fatalf("failed to load service app: %v", err)
+	}
+	if installed.ExePath != cfg.ExePath || installed.Desc != cfg.Desc {
+		t.Errorf("loaded ExePath = %v, Desc = %v, want %v, %v", installed.ExePath, installed.Desc, cfg.ExePath, cfg.Desc)
+	}
+	if installed.StartType != cerberus.ManualStartType {
+		t.Errorf("StartType = %v, want %v", installed.StartType, cerberus.ManualStartType)
+	}
+
+	installed.Args = []string{"--verbose"}
+	installed.StartType = cerberus.AutoStartType
+	if err := m.Manager.UpdateService(context.Background(), *installed); err != nil {
+		t.Fatalf("failed to update service app: %v", err)
+	}
+	m.AssertCalled(t, "UpdateConfig", "app")
+
+	updated, err := m.Manager.LoadServiceCfg("app")
+	if err != nil {
+		t.Fatalf("failed to load service app: %v", err)
+	}
+	if len(updated.Args) != 1 || updated.Args[0] != "--verbose" {
+		t.Errorf("Args = %v, want [--verbose]", updated.Args)
+	}
+	if updated.StartType != cerberus.AutoStartType {
+		t.Errorf("StartType = %v, want %v", updated.StartType, cerberus.AutoStartType)
+	}
+
+	if err := m.Manager.RemoveService(context.Background(), "app", cerberus.RemoveOptions{}); err != nil {
+		t.Fatalf("failed to remove service app: %v", err)
+	}
+	m.AssertNotInstalled(t, "app")
+	if m.HasEventSource("app") {
+		t.Errorf("event source of service app is still registered")
+	}
+	if _, err := m.Manager.LoadServiceCfg("app"); err == nil {
+		t.Errorf("loading removed service app succeeded")
+	}
+}
+
+func TestManagerInstallDuplicate(t *testing.T) {
+	t.Parallel()
+	m := cerberustest.NewFakeManager(t)
+	cfg := installFake(t, m, "app")
+
+	if err := m.Manager.InstallService(context.Background(), cfg); err == nil {
+		t.Errorf("installing service app twice succeeded")
+	}
+	if n := m.CallCount("CreateService", "app"); n != 1 {
+		t.Errorf("CreateService called %v times, want 1", n)
+	}
+}
+
+func TestManagerStartStop(t *testing.T) {
+	t.Parallel()
+	m := cerberustest.NewFakeManager(t)
+	m.StartDelay = 100 * time.Millisecond
+	m.StopDelay = 100 * time.Millisecond
+	installFake(t, m, "app")
+
+	if err := m.Manager.StartService("app", time.Second); err != nil {
+		t.Fatalf("failed to start service app: %v", err)
+	}
+	m.AssertState(t, "app", svc.Running)
+	if state, err := m.Manager.GetServiceStatus("app"); err != nil || state != cerberus.RunningState {
+		t.Errorf("GetServiceStatus() = %v, %v, want %v", state, err, cerberus.RunningState)
+	}
+	if pid, err := m.Manager.GetServicePID("app"); err != nil || pid == 0 {
+		t.Errorf("GetServicePID() = %v, %v, want a process id", pid, err)
+	}
+	if err := m.Manager.StartService("app", time.Second); !errors.Is(err, cerberus.ErrAlreadyRunning) {
+		t.Errorf("starting running service app returned %v, want %v", err, cerberus.ErrAlreadyRunning)
+	}
+
+	if err := m.Manager.StopService("app", time.Second); err != nil {
+		t.Fatalf("failed to stop service app: %v", err)
+	}
+	m.AssertState(t, "app", svc.Stopped)
+	if pid, err := m.Manager.GetServicePID("app"); err != nil || pid != 0 {
+		t.Errorf("GetServicePID() = %v, %v, want 0", pid, err)
+	}
+}
+
+func TestManagerStartTimeout(t *testing.T) {
+	t.Parallel()
+	m := cerberustest.NewFakeManager(t)
+	m.StartDelay = time.Hour
+	installFake(t, m, "app")
+
+	if err := m.Manager.StartService("app", 100*time.Millisecond); !errors.Is(err, cerberus.ErrTimeout) {
+		t.Errorf("StartService() = %v, want %v", err, cerberus.ErrTimeout)
+	}
+	m.AssertStarted(t, "app")
+	m.AssertState(t, "app", svc.StartPending)
+}
+
+func TestManagerStatusNotInstalled(t *testing.T) {
+	t.Parallel()
+	m := cerberustest.NewFakeManager(t)
+
+	if _, err := m.Manager.GetServiceStatus("missing"); !errors.Is(err, cerberus.ErrNotInstalled) {
+		t.Errorf("GetServiceStatus() = %v, want %v", err, cerberus.ErrNotInstalled)
+	}
+	states, err := m.Manager.GetServicesStatus([]string{"missing"})
+	if err != nil || states["missing"] != cerberus.UnknownState {
+		t.Errorf("GetServicesStatus() = %v, %v, want missing service unknown", states, err)
+	}
+}
+
+func TestManagerDisableEnable(t *testing.T) {
+	t.Parallel()
+	m := cerberustest.NewFakeManager(t)
+	installFake(t, m, "app")
+
+	old, err := m.Manager.DisableService("app")
+	if err != nil {
+		t.Fatalf("failed to disable service app: %v", err)
+	}
+	if old != cerberus.ManualStartType {
+		t.Errorf("DisableService() = %v, want %v", old, cerberus.ManualStartType)
+	}
+	if err := m.Manager.StartService("app", time.Second); err == nil {
+		t.Errorf("starting disabled service app succeeded")
+	}
+	m.AssertCalled(t, "Start", "app")
+	m.AssertState(t, "app", svc.Stopped)
+
+	if old, err = m.Manager.EnableService("app", 0); err != nil {
+		t.Fatalf("failed to enable service app: %v", err)
+	}
+	if old != cerberus.DisabledStartType {
+		t.Errorf("EnableService() = %v, want %v", old, cerberus.DisabledStartType)
+	}
+	cfg, err := m.Manager.LoadServiceCfg("app")
+	if err != nil {
+		t.Fatalf("failed to load service app: %v", err)
+	}
+	if cfg.StartType != cerberus.ManualStartType {
+		t.Errorf("StartType = %v, want %v", cfg.StartType, cerberus.ManualStartType)
+	}
+}
+
+func TestFakeStopPending(t *testing.T) {
+	t.Parallel()
+	f := cerberustest.NewFakeSCMClient()
+	f.StopDelay = time.Hour
+
+	s, err := f.CreateService("app", `C:\cerberus.exe`, mgr.Config{}, "run", "app")
+	if err != nil {
+		t.Fatalf("failed to create service app: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start service app: %v", err)
+	}
+	f.AssertState(t, "app", svc.Running)
+
+	if _, err := s.Control(svc.Stop); err != nil {
+		t.Fatalf("failed to stop service app: %v", err)
+	}
+	f.AssertStopped(t, "app")
+	f.AssertState(t, "app", svc.StopPending)
+	if _, err := s.Control(svc.Stop); err == nil {
+		t.Errorf("stopping service app twice succeeded")
+	}
+
+	calls := f.Calls()
+	want := []string{"CreateService", "Start", "Control", "Control"}
+	if len(calls) != len(want) {
+		t.Fatalf("Calls() = %v, want methods %v", calls, want)
+	}
+	for i, c := range calls {
+		if c.Method != want[i] || c.Service != "app" {
+			t.Errorf("call %v = %v(%v), want %v(app)", i, c.Method, c.Service, want[i])
+		}
+	}
+	if args := calls[0].Args; len(args) != 2 || args[0] != "run" || args[1] != "app" {
+		t.Errorf("CreateService args = %v, want [run app]", args)
+	}
+}
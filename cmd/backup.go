@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// BackupCommand writes the configuration of all services to a file.
+type BackupCommand struct {
+	RootCommand
+	Output string `long:"output" short:"o" description:"File to write the backup to. (default: cerberus-backup-<datetime>.json)"`
+}
+
+// Execute will backup all services. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (b *BackupCommand) Execute(args []string) error {
+	if err := b.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	now := time.Now()
+	output := b.Output
+	if output == "" {
+		output = "cerberus-backup-" + now.Format("20060102-150405") + ".json"
+	}
+
+	// Services which can't be loaded don't prevent the backup of the others.
+	svcs, err := cerberus.LoadAllServicesCfg()
+	var loadErrs cerberus.AggregateError
+	if errors.As(err, &loadErrs) {
+		for _, e := range loadErrs.Errors {
+			errLogger.Println("Skipping service:", e)
+		}
+	} else if err != nil {
+		fatal(err)
+	}
+
+	data, err := cerberus.ExportBackup(cerberus.Backup{Version: version, Timestamp: now, Services: svcs})
+	if err != nil {
+		fatal(err)
+	}
+
+	if err := ioutil.WriteFile(output, data, 0644); err != nil {
+		fatal(err)
+	}
+
+	cerberus.Logger.Printf("Saved %v services to %v\n", len(svcs), output)
+	if len(loadErrs.Errors) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
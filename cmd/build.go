@@ -59,7 +59,25 @@ const templ = `
 
 var versionRe = regexp.MustCompile(`v([0-9]+)[.]([0-9]+)[.]([0-9]+)`)
 
+// targets are the architectures to build binaries for, flags are the goversioninfo
+// flags to generate the resource file for the architecture.
+var targets = []struct {
+	name, desc, arch string
+	env              []string
+	flags            []string
+}{
+	{"cerberus_32.exe", "32-bit", "386", nil, nil},
+	{"cerberus_64.exe", "64-bit", "amd64", nil, []string{"-64"}},
+	{"cerberus_arm.exe", "ARM", "arm", []string{"GOARM=7"}, []string{"-arm"}},
+	{"cerberus_arm64.exe", "ARM64", "arm64", nil, []string{"-arm", "-64"}},
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "test-integration" {
+		testIntegration()
+		return
+	}
+
 	cmd := exec.Command("git", "describe", "--tags", "--abbrev=0")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -77,14 +95,36 @@ func main() {
 }
 
 func build(version string) {
-	fmt.Println("Building 32-bit cerberus binaries...")
-	c := createCommand("cerberus_32.exe", version, []string{"GOARCH=386"})
-	if err := c.Run(); err != nil {
-		log.Fatalln(err)
+	// The resource.syso of go generate would be linked in addition to the per-architecture files.
+	os.Remove("resource.syso")
+	for _, t := range targets {
+		fmt.Printf("Building %v cerberus binaries...\n", t.desc)
+		generateResource(t.arch, t.flags)
+		c := createCommand(t.name, version, append([]string{"GOARCH=" + t.arch}, t.env...))
+		if err := c.Run(); err != nil {
+			log.Fatalln(err)
+		}
 	}
-	fmt.Println("Building 64-bit cerberus binaries...")
-	c = createCommand("cerberus_64.exe", version, []string{"GOARCH=amd64"})
-	if err := c.Run(); err != nil {
+}
+
+// generateResource generates the resource file with the version info for the architecture, the
+// file name suffix restricts it to builds of the architecture.
+func generateResource(arch string, flags []string) {
+	name := fmt.Sprintf("resource_windows_%v.syso", arch)
+	args := append([]string{"-icon=cerberus.ico", "-o", name}, flags...)
+	if output, err := exec.Command("goversioninfo", args...).CombinedOutput(); err != nil {
+		log.Fatalln("Failed to generate "+name+":", err, string(output))
+	}
+}
+
+// testIntegration runs the tests tagged with integration, they install real services
+// and require administrator rights.
+func testIntegration() {
+	fmt.Println("Running integration tests...")
+	cmd := exec.Command("go", "test", "-tags", "integration", "-count", "1", "../...")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
 		log.Fatalln(err)
 	}
 }
@@ -114,10 +154,6 @@ func generate(major, minor, bugfix, version string) {
 	if err := t.Execute(fs, data); err != nil {
 		log.Fatalln(err)
 	}
-
-	if err := exec.Command("go", "generate").Run(); err != nil {
-		log.Fatalln("Failed to generate resource.syso:", err)
-	}
 }
 
 func createCommand(name, version string, env []string) *exec.Cmd {
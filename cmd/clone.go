@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// CloneCommand installs a copy of an installed service.
+type CloneCommand struct {
+	RootCommand
+	editFlags
+	Args struct {
+		Source string `positional-arg-name:"SOURCE_NAME" description:"Name of the service to clone."`
+		Dest   string `positional-arg-name:"DEST_NAME" description:"Name of the new service."`
+	} `positional-args:"yes" required:"2"`
+}
+
+// Execute will clone the service and apply the passed flags to the new service.
+// The args parameter is not used and is only to fullfil the go-flags commander interface.
+func (c *CloneCommand) Execute(args []string) error {
+	if err := c.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	svc, err := cerberus.CloneService(c.Args.Source, c.Args.Dest, c.apply)
+	if err != nil {
+		fatal(err)
+	}
+
+	state, err := cerberus.GetServiceStatus(svc.Name)
+	if err != nil {
+		cerberus.DebugLogger.Println("failed to get status of", svc.Name, ":", err)
+	}
+
+	p := keyValuePrinter{indentSize: 5}
+	printService(&p, svc, state)
+	p.writeTo(os.Stdout)
+	return nil
+}
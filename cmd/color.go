@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// ANSI escape sequences used to colorize the output.
+const (
+	colorReset  = "\033[0m"
+	colorBold   = "\033[1m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+var useColor = false
+
+// colorize wraps the text with the given escape sequence if colors are enabled.
+func colorize(color, text string) string {
+	if !useColor || color == "" {
+		return text
+	}
+	return color + text + colorReset
+}
+
+// detectColor reports whether the terminal supports colors, it follows
+// the no-color.org standard and enables VT processing on Windows 10+ consoles.
+func detectColor() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+
+	return supportsVT()
+}
+
+// supportsVT reports whether the terminal understands VT escape sequences.
+func supportsVT() bool {
+	term := os.Getenv("TERM")
+	if term == "dumb" {
+		return false
+	}
+
+	var mode uint32
+	h := windows.Handle(os.Stdout.Fd())
+	if err := windows.GetConsoleMode(h, &mode); err != nil {
+		// Not a console, but terminals like mintty set TERM.
+		return term != ""
+	}
+
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+		return true
+	}
+
+	// Older Windows versions don't support VT sequences and will refuse the mode.
+	return windows.SetConsoleMode(h, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
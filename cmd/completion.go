@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-sharp/cerberus/v2"
+	"github.com/jessevdk/go-flags"
+)
+
+// CompletionCommand prints a shell completion script.
+type CompletionCommand struct {
+	Args struct {
+		Shell string `positional-arg-name:"SHELL" description:"Shell to generate the script for. One of [bash|powershell|zsh]" required:"yes"`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will print the completion script for the given shell. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (c *CompletionCommand) Execute(args []string) error {
+	cmds := completionCommands(parser.Command)
+	switch c.Args.Shell {
+	case "bash":
+		fmt.Print(bashCompletion(cmds))
+	case "zsh":
+		fmt.Print(zshCompletion(cmds))
+	case "powershell":
+		fmt.Print(powershellCompletion(cmds))
+	default:
+		errLogger.Fatalln("Invalid shell passed: one of (bash|powershell|zsh) is required.")
+	}
+	return nil
+}
+
+// completionCommand describes a command for the completion scripts, nested
+// commands are joined with a space (ex. "recovery set").
+type completionCommand struct {
+	name  string
+	flags []string
+	subs  []string
+}
+
+func completionCommands(root *flags.Command) []completionCommand {
+	var cmds []completionCommand
+	var walk func(prefix string, c *flags.Command)
+	walk = func(prefix string, c *flags.Command) {
+		for _, sub := range c.Commands() {
+			cmd := completionCommand{name: strings.TrimSpace(prefix + " " + sub.Name), flags: []string{"--help"}}
+			collectFlags(sub.Group, &cmd.flags)
+			sort.Strings(cmd.flags)
+			for _, s := range sub.Commands() {
+				cmd.subs = append(cmd.subs, s.Name)
+			}
+			cmds = append(cmds, cmd)
+			walk(cmd.name, sub)
+		}
+	}
+	walk("", root)
+	return cmds
+}
+
+func collectFlags(g *flags.Group, names *[]string) {
+	for _, o := range g.Options() {
+		if o.LongName != "" {
+			*names = append(*names, "--"+o.LongName)
+		}
+	}
+	for _, sub := range g.Groups() {
+		collectFlags(sub, names)
+	}
+}
+
+// Values of flags which can be completed.
+var completionValues = map[string]string{
+	"--start-type":  "manual autostart delayed disabled",
+	"--priority":    "inherit normal below-normal above-normal realtime",
+	"--io-priority": "inherit very-low low normal",
+	"--format":      "text json csv reg winsw sc powershell",
+	"--action":      "none run restart run-restart webhook webhook-restart",
+	"--privilege":   strings.Join(cerberus.KnownPrivileges, " "),
+}
+
+// Service names are read from the csv output, the name is the first quoted field.
+const serviceNamesCmd = `cerberus list --format csv 2>/dev/null | tail -n +2 | cut -d, -f1 | tr -d '"\r'`
+
+func bashCompletion(cmds []completionCommand) string {
+	var b strings.Builder
+	var top []string
+	for _, c := range cmds {
+		if !strings.Contains(c.name, " ") {
+			top = append(top, c.name)
+		}
+	}
+
+	b.WriteString("# bash completion for cerberus, load it with: source <(cerberus completion bash)\n")
+	b.WriteString("_cerberus() {\n")
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	fmt.Fprintf(&b, "    if [ \"$COMP_CWORD\" -eq 1 ]; then\n        COMPREPLY=( $(compgen -W \"%v\" -- \"$cur\") )\n        return\n    fi\n\n", strings.Join(top, " "))
+
+	b.WriteString("    case \"$prev\" in\n")
+	for _, k := range sortedKeys(completionValues) {
+		fmt.Fprintf(&b, "        %v) COMPREPLY=( $(compgen -W \"%v\" -- \"$cur\") ); return ;;\n", k, completionValues[k])
+	}
+	b.WriteString("    esac\n\n")
+
+	b.WriteString("    local words=\"\"\n")
+	b.WriteString("    case \"${COMP_WORDS[1]} ${COMP_WORDS[2]}\" in\n")
+	for _, c := range completionOrder(cmds) {
+		if len(c.subs) > 0 {
+			fmt.Fprintf(&b, "        \"%v \"*) if [ \"$COMP_CWORD\" -eq 2 ]; then COMPREPLY=( $(compgen -W \"%v\" -- \"$cur\") ); return; fi ;;\n", c.name, strings.Join(c.subs, " "))
+		} else {
+			fmt.Fprintf(&b, "        %v) words=\"%v\" ;;\n", completionPattern(c.name), strings.Join(c.flags, " "))
+		}
+	}
+	b.WriteString("    esac\n\n")
+
+	b.WriteString("    if [[ \"$cur\" == -* ]]; then\n        COMPREPLY=( $(compgen -W \"$words\" -- \"$cur\") )\n        return\n    fi\n")
+	fmt.Fprintf(&b, "    COMPREPLY=( $(compgen -W \"$(%v)\" -- \"$cur\") )\n", serviceNamesCmd)
+	b.WriteString("}\ncomplete -F _cerberus cerberus cerberus.exe\n")
+	return b.String()
+}
+
+func zshCompletion(cmds []completionCommand) string {
+	var b strings.Builder
+	b.WriteString("#compdef cerberus cerberus.exe\n")
+	b.WriteString("# zsh completion for cerberus, load it with: source <(cerberus completion zsh)\n")
+	b.WriteString("_cerberus() {\n    local -a commands services flags\n")
+	b.WriteString("    if (( CURRENT == 2 )); then\n        commands=(")
+	for _, c := range cmds {
+		if !strings.Contains(c.name, " ") {
+			fmt.Fprintf(&b, "%v ", c.name)
+		}
+	}
+	b.WriteString(")\n        compadd -a commands\n        return\n    fi\n\n")
+
+	b.WriteString("    case \"$words[CURRENT-1]\" in\n")
+	for _, k := range sortedKeys(completionValues) {
+		fmt.Fprintf(&b, "        %v) compadd %v; return ;;\n", k, completionValues[k])
+	}
+	b.WriteString("    esac\n\n")
+
+	b.WriteString("    case \"$words[2] $words[3]\" in\n")
+	for _, c := range completionOrder(cmds) {
+		if len(c.subs) > 0 {
+			fmt.Fprintf(&b, "        \"%v \"*) if (( CURRENT == 3 )); then compadd %v; return; fi ;;\n", c.name, strings.Join(c.subs, " "))
+		} else {
+			fmt.Fprintf(&b, "        %v) flags=(%v) ;;\n", completionPattern(c.name), strings.Join(c.flags, " "))
+		}
+	}
+	b.WriteString("    esac\n\n")
+
+	b.WriteString("    if [[ \"$PREFIX\" == -* ]]; then\n        compadd -a flags\n        return\n    fi\n")
+	fmt.Fprintf(&b, "    services=(${(f)\"$(%v)\"})\n", serviceNamesCmd)
+	b.WriteString("    compadd -a services\n}\ncompdef _cerberus cerberus cerberus.exe\n")
+	return b.String()
+}
+
+func powershellCompletion(cmds []completionCommand) string {
+	var b strings.Builder
+	b.WriteString("# PowerShell completion for cerberus, load it with: cerberus completion powershell | Out-String | Invoke-Expression\n")
+	b.WriteString("Register-ArgumentCompleter -Native -CommandName cerberus, cerberus.exe -ScriptBlock {\n")
+	b.WriteString("    param($wordToComplete, $commandAst, $cursorPosition)\n\n")
+
+	b.WriteString("    $commands = @{\n")
+	for _, c := range cmds {
+		fmt.Fprintf(&b, "        '%v' = @(%v)\n", c.name, psList(append(append([]string{}, c.subs...), c.flags...)))
+	}
+	b.WriteString("    }\n    $values = @{\n")
+	for _, k := range sortedKeys(completionValues) {
+		fmt.Fprintf(&b, "        '%v' = @(%v)\n", k, psList(strings.Fields(completionValues[k])))
+	}
+	b.WriteString("    }\n\n")
+
+	b.WriteString(`    $complete = { param($items) $items | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    } }
+
+    $elements = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+    if ($wordToComplete) { $elements = $elements[0..($elements.Count - 2)] }
+    if ($elements.Count -le 1) {
+        & $complete ($commands.Keys | Where-Object { $_ -notlike '* *' } | Sort-Object)
+        return
+    }
+
+    $previous = $elements[-1]
+    if ($values.ContainsKey($previous)) {
+        & $complete $values[$previous]
+        return
+    }
+
+    $cmd = $elements[1]
+    if ($elements.Count -ge 3 -and $commands.ContainsKey("$cmd $($elements[2])")) { $cmd = "$cmd $($elements[2])" }
+    if ($wordToComplete -like '-*' -or ($elements.Count -eq 2 -and $commands[$cmd] -and $commands[$cmd][0] -notlike '-*')) {
+        & $complete $commands[$cmd]
+        return
+    }
+
+    $services = cerberus list --format json 2>$null | ConvertFrom-Json
+    & $complete ($services | ForEach-Object { $_.Name })
+}
+`)
+	return b.String()
+}
+
+// completionOrder returns the commands with the nested commands first,
+// so they are matched before their parent command.
+func completionOrder(cmds []completionCommand) []completionCommand {
+	ordered := make([]completionCommand, 0, len(cmds))
+	for _, c := range cmds {
+		if strings.Contains(c.name, " ") {
+			ordered = append(ordered, c)
+		}
+	}
+	for _, c := range cmds {
+		if !strings.Contains(c.name, " ") {
+			ordered = append(ordered, c)
+		}
+	}
+	return ordered
+}
+
+// completionPattern returns the case pattern matching the first two words of the command line.
+func completionPattern(name string) string {
+	if strings.Contains(name, " ") {
+		return "\"" + name + "\""
+	}
+	return "\"" + name + " \"*"
+}
+
+func psList(items []string) string {
+	quoted := make([]string, len(items))
+	for i := range items {
+		quoted[i] = "'" + items[i] + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
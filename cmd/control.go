@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// StartCommand starts an installed service using the SCM.
+type StartCommand struct {
+	RootCommand
+	remoteFlags
+	Timeout    time.Duration `short:"t" long:"timeout" description:"Time to wait for the service to be running." default:"30s"`
+	WithDeps   bool          `long:"with-dependencies" description:"Start the stopped dependencies of the service first."`
+	DepTimeout time.Duration `long:"dependency-timeout" description:"Time to wait for each dependency to be running." default:"30s"`
+	Args       struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service to start." required:"yes"`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will start an installed service. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (s *StartCommand) Execute(args []string) error {
+	if err := s.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+	cerberus.SetComputer(s.Computer)
+
+	start := cerberus.StartServiceTimeout
+	if s.WithDeps {
+		start = func(name string, timeout time.Duration) error {
+			return cerberus.StartServiceWithDependencies(name, timeout, s.DepTimeout)
+		}
+	}
+
+	if err := start(s.Args.Name, s.Timeout); err != nil {
+		if errors.Is(err, cerberus.ErrAlreadyRunning) {
+			cerberus.Logger.Println("Warning:", err)
+			return nil
+		}
+		fatal(err)
+	}
+
+	return nil
+}
+
+// StopCommand stops an installed service using the SCM.
+type StopCommand struct {
+	RootCommand
+	remoteFlags
+	Timeout time.Duration `short:"t" long:"timeout" description:"Time to wait for the service to stop. (default: configured stop timeout or 30s)"`
+	Force   bool          `long:"force" description:"Kill the service process immediately without sending any signals."`
+	Args    struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service to stop." required:"yes"`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will stop an installed service. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (s *StopCommand) Execute(args []string) error {
+	if err := s.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+	cerberus.SetComputer(s.Computer)
+
+	stop := cerberus.StopService
+	if s.Force {
+		stop = cerberus.KillService
+	}
+
+	if err := stop(s.Args.Name, s.Timeout); err != nil {
+		fatal(err)
+	}
+
+	return nil
+}
+
+// RestartCommand stops and starts an installed service using the SCM.
+type RestartCommand struct {
+	RootCommand
+	Timeout      time.Duration `short:"t" long:"timeout" description:"Time to wait for the service to stop. (default: configured stop timeout or 30s)"`
+	StartTimeout time.Duration `long:"start-timeout" description:"Time to wait for the service to be running." default:"30s"`
+	Force        bool          `long:"force" description:"Kill the service process immediately without sending any signals."`
+	Args         struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service to restart." required:"yes"`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will restart an installed service. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (r *RestartCommand) Execute(args []string) error {
+	if err := r.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	stop := cerberus.StopService
+	if r.Force {
+		stop = cerberus.KillService
+	}
+
+	if err := stop(r.Args.Name, r.Timeout); err != nil {
+		fatal(err)
+	}
+
+	if err := cerberus.StartServiceTimeout(r.Args.Name, r.StartTimeout); err != nil {
+		fatal(err)
+	}
+
+	return nil
+}
+
+// Exit codes of the status command, matching the systemctl conventions.
+const (
+	statusRunning      = 0
+	statusStopped      = 1
+	statusNotInstalled = 2
+	statusError        = 3
+)
+
+// StatusCommand shows the current state of an installed service.
+type StatusCommand struct {
+	RootCommand
+	Format string `long:"format" short:"F" description:"Output format. One of [text|json]" default:"text"`
+	Args   struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service." required:"yes"`
+	} `positional-args:"yes" required:"1"`
+}
+
+type serviceStatus struct {
+	Name      string     `json:"name"`
+	Status    string     `json:"status"`
+	PID       uint32     `json:"pid,omitempty"`
+	User      string     `json:"user,omitempty"`
+	LastStart *time.Time `json:"last_start,omitempty"`
+	Restarts  int        `json:"restarts"`
+}
+
+// Execute will show the state of an installed service and exit with 0 if the service is running,
+// 1 if it is stopped, 2 if it is not installed and 3 for any other error. The args parameter
+// is not used and is only to fullfil the go-flags commander interface.
+func (s *StatusCommand) Execute(args []string) error {
+	if err := s.RootCommand.Execute(args); err != nil {
+		cerberus.LogError(errLogger, err)
+		os.Exit(statusError)
+	}
+
+	switch s.Format {
+	case "text", "json":
+	default:
+		errLogger.Println("Invalid format passed: one of (text|json) is required.")
+		os.Exit(statusError)
+	}
+
+	state, err := cerberus.GetServiceStatus(s.Args.Name)
+	if err != nil {
+		cerberus.LogError(errLogger, err)
+		if errors.Is(err, cerberus.ErrNotInstalled) {
+			os.Exit(statusNotInstalled)
+		}
+		os.Exit(statusError)
+	}
+
+	status := serviceStatus{Name: s.Args.Name, Status: state.String()}
+	if state == cerberus.RunningState {
+		if status.PID, err = cerberus.GetServicePID(s.Args.Name); err != nil {
+			cerberus.DebugLogger.Println("failed to get process id:", err)
+		}
+	}
+	if cfg, err := cerberus.LoadServiceCfg(s.Args.Name); err == nil {
+		status.User = cfg.ServiceUser
+		status.Restarts = cfg.CumulativeRestarts
+		if !cfg.LastStart.IsZero() {
+			status.LastStart = &cfg.LastStart
+		}
+	} else {
+		cerberus.DebugLogger.Println("failed to load configuration:", err)
+	}
+
+	if s.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(status); err != nil {
+			cerberus.LogError(errLogger, err)
+			os.Exit(statusError)
+		}
+	} else {
+		p := keyValuePrinter{indentSize: 5}
+		p.printlnColor("Name", status.Name, colorBold)
+		p.printlnColor("Status", state, stateColor(state))
+		if status.PID != 0 {
+			p.println("PID", status.PID)
+		}
+		if status.User != "" {
+			p.println("Service User", status.User)
+		}
+		if status.LastStart != nil {
+			p.println("Last Start", formatTime(*status.LastStart))
+		}
+		p.println("Restarts", status.Restarts)
+		p.writeTo(os.Stdout)
+	}
+
+	if state != cerberus.RunningState {
+		os.Exit(statusStopped)
+	}
+	os.Exit(statusRunning)
+	return nil
+}
+
+// EnableCommand enables a disabled service.
+type EnableCommand struct {
+	RootCommand
+	StartType string `long:"start-type" short:"s" description:"Start type to enable the service with. One of [manual|autostart|delayed] (default: start type before the service was disabled)"`
+	Args      struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service to enable." required:"yes"`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will enable an installed service. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (e *EnableCommand) Execute(args []string) error {
+	if err := e.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	var startType cerberus.StartType
+	switch e.StartType {
+	case "":
+	case "manual":
+		startType = cerberus.ManualStartType
+	case "autostart":
+		startType = cerberus.AutoStartType
+	case "delayed":
+		startType = cerberus.AutoDelayedStartType
+	default:
+		errLogger.Fatalln("Invalid start type passed: one of (manual|autostart|delayed) is required.")
+	}
+
+	old, err := cerberus.EnableService(e.Args.Name, startType)
+	if err != nil {
+		fatal(err)
+	}
+
+	printStartTypeChange(e.Args.Name, old)
+	return nil
+}
+
+// DisableCommand disables an installed service.
+type DisableCommand struct {
+	RootCommand
+	Args struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service to disable." required:"yes"`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will disable an installed service. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (d *DisableCommand) Execute(args []string) error {
+	if err := d.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	old, err := cerberus.DisableService(d.Args.Name)
+	if err != nil {
+		fatal(err)
+	}
+
+	printStartTypeChange(d.Args.Name, old)
+	return nil
+}
+
+func printStartTypeChange(name string, old cerberus.StartType) {
+	cfg, err := cerberus.LoadServiceCfg(name)
+	if err != nil {
+		fatal(err)
+	}
+
+	cerberus.Logf(cerberus.Logger, "Changed start type of service %v: %v -> %v\n", cerberus.Field("service", name), cerberus.Field("old_start_type", startTypeMapping[old]), cerberus.Field("start_type", startTypeMapping[cfg.StartType]))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-sharp/cerberus/v2"
+	"golang.org/x/sys/windows"
+)
+
+// CredentialSetCommand stores the password of a service user in the Windows Credential Manager.
+type CredentialSetCommand struct {
+	RootCommand
+	Password string `long:"password" short:"p" description:"Password for the service user, if not specified it is read from the console."`
+	Args     struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service to store the password for."`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will store the password in the credential manager. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (c *CredentialSetCommand) Execute(args []string) error {
+	if err := c.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	password := c.Password
+	if password == "" {
+		var err error
+		if password, err = readPassword(fmt.Sprintf("Password for service %v: ", c.Args.Name)); err != nil {
+			fatal(err)
+		}
+	}
+
+	if err := cerberus.SetServiceCredential(c.Args.Name, password); err != nil {
+		fatal(err)
+	}
+
+	cerberus.Logger.Printf("Stored password as %v\n", cerberus.CredentialTarget(c.Args.Name))
+	return nil
+}
+
+// CredentialDelCommand removes the password of a service user from the Windows Credential Manager.
+type CredentialDelCommand struct {
+	RootCommand
+	Args struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service to remove the password for."`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will remove the password from the credential manager. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (c *CredentialDelCommand) Execute(args []string) error {
+	if err := c.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	if err := cerberus.DeleteServiceCredential(c.Args.Name); err != nil {
+		fatal(err)
+	}
+
+	cerberus.Logger.Printf("Removed %v\n", cerberus.CredentialTarget(c.Args.Name))
+	return nil
+}
+
+// readPassword reads a line from the console without echoing the input.
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	stdin := windows.Handle(os.Stdin.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(stdin, &mode); err == nil {
+		windows.SetConsoleMode(stdin, mode&^windows.ENABLE_ECHO_INPUT)
+		defer func() {
+			windows.SetConsoleMode(stdin, mode)
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read password: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
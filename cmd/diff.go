@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// DiffCommand shows the differences between an installed service and a configuration file.
+type DiffCommand struct {
+	RootCommand
+	Args struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the installed service." required:"yes"`
+		File string `positional-arg-name:"FILE" description:"JSON file with the proposed configuration." required:"yes"`
+	} `positional-args:"yes" required:"2"`
+}
+
+// Execute will print the changed fields and exits with 1 if there are any differences.
+// The args parameter is not used and is only to fullfil the go-flags commander interface.
+func (d *DiffCommand) Execute(args []string) error {
+	if err := d.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	current, err := cerberus.LoadServiceCfg(d.Args.Name)
+	if err != nil {
+		fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(d.Args.File)
+	if err != nil {
+		fatal(err)
+	}
+
+	svcs, err := cerberus.ImportConfig(data)
+	if err != nil {
+		fatal(err)
+	}
+
+	var proposed *cerberus.SvcConfig
+	for _, svc := range svcs {
+		if svc.Name == d.Args.Name || len(svcs) == 1 {
+			proposed = svc
+			break
+		}
+	}
+	if proposed == nil {
+		errLogger.Fatalf("Service %v not found in %v\n", d.Args.Name, d.Args.File)
+	}
+
+	// Statistics are recorded by the service host, they can't be changed by a configuration.
+	proposed.CumulativeRestarts, proposed.LastRestart = current.CumulativeRestarts, current.LastRestart
+	proposed.FirstStart, proposed.LastStart, proposed.TotalRuntime = current.FirstStart, current.LastStart, current.TotalRuntime
+
+	// An empty ACL keeps the DACL of the installed service.
+	if proposed.ServiceACL == "" {
+		proposed.ServiceACL = current.ServiceACL
+	}
+
+	oldFields, err := toJSONMap(current)
+	if err != nil {
+		fatal(err)
+	}
+	newFields, err := toJSONMap(proposed)
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("--- %v (installed)\n", d.Args.Name)
+	fmt.Printf("+++ %v\n", d.Args.File)
+	changed := printDiff(oldFields, newFields)
+
+	// Passwords are never shown, it isn't possible to read them from the SCM anyway.
+	if proposed.Password != nil {
+		fmt.Println(colorize(colorYellow, "~ Password: [changed]"))
+		changed = true
+	} else {
+		fmt.Println("  Password: [unchanged]")
+	}
+
+	if changed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// printDiff prints all fields with a +/- prefix for added, removed and changed values
+// and reports whether there are any differences.
+func printDiff(oldFields, newFields map[string]interface{}) bool {
+	keys := make([]string, 0, len(oldFields))
+	for k := range oldFields {
+		keys = append(keys, k)
+	}
+	for k := range newFields {
+		if _, ok := oldFields[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	changed := false
+	for _, k := range keys {
+		oldValue, inOld := oldFields[k]
+		newValue, inNew := newFields[k]
+		if inOld && inNew && reflect.DeepEqual(oldValue, newValue) {
+			fmt.Printf("  %v: %v\n", k, formatDiffValue(oldValue))
+			continue
+		}
+
+		changed = true
+		if inOld {
+			fmt.Println(colorize(colorRed, fmt.Sprintf("- %v: %v", k, formatDiffValue(oldValue))))
+		}
+		if inNew {
+			fmt.Println(colorize(colorGreen, fmt.Sprintf("+ %v: %v", k, formatDiffValue(newValue))))
+		}
+	}
+	return changed
+}
+
+func formatDiffValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
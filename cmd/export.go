@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// ExportCommand exports service configurations as JSON, .reg file, sc.exe batch or PowerShell script.
+type ExportCommand struct {
+	RootCommand
+	Output string `long:"output" short:"o" description:"Write the configuration to the given file instead of stdout."`
+	All    bool   `long:"all" short:"a" description:"Export all cerberus services as JSON array."`
+	Format string `long:"format" description:"Output format, a reg file contains only the cerberus registry entries, a sc batch script only the SCM properties." choice:"json" choice:"reg" choice:"sc" choice:"powershell" default:"json"`
+	Args   struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service to export."`
+	} `positional-args:"yes"`
+}
+
+// Execute will export the configuration of one or all services. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (e *ExportCommand) Execute(args []string) error {
+	if err := e.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	if e.All == (e.Args.Name != "") {
+		errLogger.Fatalln("Either a service name or --all is required.")
+	}
+
+	var data []byte
+	if e.Format == "sc" || e.Format == "powershell" {
+		svcs, err := e.load()
+		if err != nil {
+			fatal(err)
+		}
+
+		export := cerberus.ExportSCScript
+		if e.Format == "powershell" {
+			export = cerberus.ExportPowerShellScript
+		}
+		var buf bytes.Buffer
+		if err := export(svcs, &buf); err != nil {
+			fatal(err)
+		}
+		data = buf.Bytes()
+	} else if e.Format == "reg" {
+		names := []string{e.Args.Name}
+		if e.All {
+			svcs, err := cerberus.LoadServicesCfg()
+			if err != nil {
+				fatal(err)
+			}
+			names = names[:0]
+			for _, svc := range svcs {
+				names = append(names, svc.Name)
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := cerberus.ExportRegFile(names, &buf); err != nil {
+			fatal(err)
+		}
+		data = buf.Bytes()
+	} else if e.All {
+		svcs, err := cerberus.LoadServicesCfg()
+		if err != nil {
+			fatal(err)
+		}
+		if data, err = cerberus.ExportConfigs(svcs); err != nil {
+			fatal(err)
+		}
+	} else {
+		svc, err := cerberus.LoadServiceCfg(e.Args.Name)
+		if err != nil {
+			fatal(err)
+		}
+		if data, err = cerberus.ExportConfig(svc); err != nil {
+			fatal(err)
+		}
+	}
+
+	if e.Output == "" {
+		if _, err := os.Stdout.Write(data); err != nil {
+			fatal(err)
+		}
+		return nil
+	}
+
+	if err := ioutil.WriteFile(e.Output, data, 0644); err != nil {
+		fatal(err)
+	}
+	cerberus.Logger.Printf("Exported configuration to %v\n", e.Output)
+	return nil
+}
+
+// load returns the configuration of the service or of all services if --all is set.
+func (e *ExportCommand) load() ([]*cerberus.SvcConfig, error) {
+	if e.All {
+		return cerberus.LoadServicesCfg()
+	}
+
+	svc, err := cerberus.LoadServiceCfg(e.Args.Name)
+	if err != nil {
+		return nil, err
+	}
+	return []*cerberus.SvcConfig{svc}, nil
+}
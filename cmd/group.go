@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// GroupStartCommand starts all services of a group.
+type GroupStartCommand struct {
+	RootCommand
+	Timeout time.Duration `short:"t" long:"timeout" description:"Time to wait for each service to be running." default:"30s"`
+	Args    struct {
+		Group string `positional-arg-name:"GROUP_NAME" description:"Name of the group to start."`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will start all services of the group. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (g *GroupStartCommand) Execute(args []string) error {
+	if err := g.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	if err := cerberus.StartGroup(g.Args.Group, g.Timeout); err != nil {
+		fatal(err)
+	}
+	return nil
+}
+
+// GroupStopCommand stops all services of a group.
+type GroupStopCommand struct {
+	RootCommand
+	Timeout time.Duration `short:"t" long:"timeout" description:"Time to wait for each service to stop. (default: configured stop timeout or 30s)"`
+	Args    struct {
+		Group string `positional-arg-name:"GROUP_NAME" description:"Name of the group to stop."`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will stop all services of the group. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (g *GroupStopCommand) Execute(args []string) error {
+	if err := g.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	if err := cerberus.StopGroup(g.Args.Group, g.Timeout); err != nil {
+		fatal(err)
+	}
+	return nil
+}
+
+// GroupListCommand shows all groups and their services.
+type GroupListCommand struct {
+	RootCommand
+}
+
+// Execute will print all groups with their services. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (g *GroupListCommand) Execute(args []string) error {
+	if err := g.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	groups, err := cerberus.ListGroups()
+	if err != nil {
+		fatal(err)
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("\nCerberus groups:\n")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, name := range names {
+		fmt.Printf("%v: %v\n", name, strings.Join(groups[name], ", "))
+	}
+	return nil
+}
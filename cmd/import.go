@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// Results of importing a service.
+const (
+	resultInstalled = "installed"
+	resultUpdated   = "updated"
+	resultSkipped   = "skipped"
+	resultFailed    = "failed"
+)
+
+type importResult struct {
+	name   string
+	result string
+	err    error
+}
+
+// ImportCommand installs services from a JSON file created by the export command, a WinSW configuration
+// or from a service managed by NSSM.
+type ImportCommand struct {
+	RootCommand
+	Update   bool   `long:"update-if-exists" short:"u" description:"Update existing services instead of skipping them."`
+	DryRun   bool   `long:"dry-run" short:"n" description:"Only validate the configurations, nothing is installed or updated."`
+	FromNSSM string `long:"from-nssm" description:"Import the service managed by NSSM with the given name, it must be removed with 'nssm remove' before it can be installed."`
+	Format   string `long:"format" description:"Format of the file, winsw imports a WinSW xml configuration. One of [json|winsw]" default:"json"`
+	Args     struct {
+		File string `positional-arg-name:"FILE" description:"JSON file created by the export command or WinSW xml configuration."`
+	} `positional-args:"yes"`
+}
+
+// Execute will install or update all services from the given file. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (i *ImportCommand) Execute(args []string) error {
+	if err := i.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	if (i.FromNSSM == "") == (i.Args.File == "") {
+		errLogger.Fatalln("Either a file or --from-nssm is required.")
+	}
+
+	switch strings.ToLower(i.Format) {
+	case "json", "winsw":
+	default:
+		errLogger.Fatalln("Invalid format passed: one of (json|winsw) is required.")
+	}
+
+	svcs, err := i.load()
+	if err != nil {
+		fatal(err)
+	}
+
+	results := applyConfigs(svcs, i.Update, i.DryRun)
+	printResults("Import summary", results, i.DryRun)
+	if hasFailures(results) {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// load returns the configurations to import.
+func (i *ImportCommand) load() ([]*cerberus.SvcConfig, error) {
+	if i.FromNSSM != "" {
+		svc, err := cerberus.ImportFromNSSM(i.FromNSSM)
+		if err != nil {
+			return nil, err
+		}
+		return []*cerberus.SvcConfig{svc}, nil
+	}
+
+	if strings.EqualFold(i.Format, "winsw") {
+		f, err := os.Open(i.Args.File)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		svc, err := cerberus.ImportFromWinSW(f)
+		if err != nil {
+			return nil, err
+		}
+		return []*cerberus.SvcConfig{svc}, nil
+	}
+
+	data, err := ioutil.ReadFile(i.Args.File)
+	if err != nil {
+		return nil, err
+	}
+	return cerberus.ImportConfig(data)
+}
+
+// applyConfigs installs the given services or updates existing ones if update is true.
+// Failures don't stop the remaining services from being applied, they are reported in the results.
+func applyConfigs(svcs []*cerberus.SvcConfig, update, dryRun bool) []importResult {
+	var results []importResult
+	for _, svc := range svcs {
+		_, err := cerberus.LoadServiceCfg(svc.Name)
+		exists := err == nil
+
+		var result string
+		switch {
+		case exists && !update:
+			cerberus.Logf(cerberus.Logger, "Service %v already exists, skipping...\n", cerberus.Field("service", svc.Name))
+			result = resultSkipped
+		case dryRun:
+			err = cerberus.ValidateConfig(*svc, false)
+			result = resultInstalled
+			if exists {
+				result = resultUpdated
+			}
+		case exists:
+			err = cerberus.UpdateService(*svc)
+			result = resultUpdated
+		default:
+			err = cerberus.InstallService(*svc)
+			result = resultInstalled
+		}
+
+		if result != resultSkipped && err != nil {
+			result = resultFailed
+		} else {
+			err = nil
+		}
+		results = append(results, importResult{name: svc.Name, result: result, err: err})
+	}
+	return results
+}
+
+func printResults(title string, results []importResult, dryRun bool) {
+	if dryRun {
+		title += " (dry run)"
+	}
+	fmt.Printf("\n%v:\n", title)
+	fmt.Println(strings.Repeat("-", 80))
+
+	p := keyValuePrinter{indentSize: 5}
+	for _, r := range results {
+		color := colorGreen
+		switch r.result {
+		case resultSkipped:
+			color = colorYellow
+		case resultFailed:
+			color = colorRed
+		}
+		p.printlnColor(r.name, r.result, color)
+	}
+	p.writeTo(os.Stdout)
+
+	for _, r := range results {
+		if r.err != nil {
+			errLogger.Printf("Failed to apply service %v: %v\n", r.name, r.err)
+		}
+	}
+}
+
+func hasFailures(results []importResult) bool {
+	for _, r := range results {
+		if r.result == resultFailed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// ListCommand shows all cerberus installed services.
+type ListCommand struct {
+	RootCommand
+	remoteFlags
+	Query    string        `long:"filter" short:"f" description:"Only show services whose name contains the filter word. Filters with regex characters or --regex are used as case-insensitive regular expression matching name, display name or description."`
+	Regex    bool          `long:"regex" description:"Always use the filter as regular expression."`
+	Running  bool          `long:"running" short:"r" description:"Only show services which are currently running."`
+	Labels   []string      `long:"label" short:"l" description:"Only show services with the label, either key or key=value. (ex. -l env=prod -l team)"`
+	Format   string        `long:"format" short:"F" description:"Output format. One of [text|json|csv]" default:"text"`
+	Status   string        `long:"filter-status" description:"Only show services with the given state. One of [running|stopped|paused]"`
+	SortBy   string        `long:"sort-by" description:"Sort the services by the given field. One of [name|display-name|start-type|exe-path]" default:"name"`
+	SortDesc bool          `long:"sort-desc" description:"Sort the services in descending order."`
+	Output   string        `long:"output" short:"o" description:"Write the list to the given file instead of stdout."`
+	Watch    bool          `long:"watch" short:"W" description:"Refresh the output periodically until Ctrl-C is pressed."`
+	Interval time.Duration `long:"interval" description:"Refresh interval in watch mode." default:"2s"`
+
+	filterRe *regexp.Regexp
+}
+
+// Execute will list all with cerberus installed services. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (r *ListCommand) Execute(args []string) (err error) {
+	if err := r.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+	cerberus.SetComputer(r.Computer)
+
+	if r.Query != "" && (r.Regex || strings.ContainsAny(r.Query, `\^$.|?*+()[]{}`)) {
+		if r.filterRe, err = regexp.Compile("(?i)" + r.Query); err != nil {
+			errLogger.Fatalln("Invalid filter passed:", err)
+		}
+	}
+
+	switch r.SortBy {
+	case "name", "display-name", "start-type", "exe-path":
+	default:
+		errLogger.Fatalln("Invalid sort field passed: one of (name|display-name|start-type|exe-path) is required.")
+	}
+
+	switch strings.ToLower(r.Status) {
+	case "", "running", "stopped", "paused":
+	default:
+		errLogger.Fatalln("Invalid status filter passed: one of (running|stopped|paused) is required.")
+	}
+
+	switch r.Format {
+	case "text", "json", "csv":
+	default:
+		errLogger.Fatalln("Invalid format passed: one of (text|json|csv) is required.")
+	}
+
+	// Escape sequences don't belong into files.
+	if r.Output != "" {
+		useColor = false
+	}
+
+	if !r.Watch {
+		if err := r.run(); err != nil {
+			fatal(err)
+		}
+		return nil
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	clearScreen := r.Output == "" && supportsVT()
+	for {
+		if clearScreen {
+			os.Stdout.Write([]byte("\033[H\033[2J"))
+		} else if r.Output == "" {
+			fmt.Println(strings.Repeat("---", 26))
+		}
+		if err := r.run(); err != nil {
+			fatal(err)
+		}
+
+		select {
+		case <-sigs:
+			return nil
+		case <-time.After(r.Interval):
+		}
+	}
+}
+
+// run writes the list to the output file or to stdout if no file is specified.
+func (r *ListCommand) run() error {
+	if r.Output == "" {
+		return r.list(os.Stdout)
+	}
+
+	f, err := os.Create(r.Output)
+	if err != nil {
+		return err
+	}
+
+	if err := r.list(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (r *ListCommand) list(w io.Writer) error {
+	loadSvcs := cerberus.LoadServicesCfg
+	if r.Running {
+		loadSvcs = cerberus.ListRunningServices
+	}
+
+	svcs, err := loadSvcs()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(svcs))
+	for i := range svcs {
+		names[i] = svcs[i].Name
+	}
+
+	// If the SCM isn't reachable all services are shown with an unknown state.
+	states, err := cerberus.GetServicesStatus(names)
+	if err != nil {
+		cerberus.DebugLogger.Println(err)
+		states = map[string]cerberus.ServiceState{}
+	}
+	svcs = r.filter(svcs, states)
+	r.sort(svcs)
+
+	switch r.Format {
+	case "json":
+		return writeServicesJSON(w, svcs, states)
+	case "csv":
+		return writeServicesCSV(w, svcs, states)
+	default:
+		printServices(w, svcs, states)
+		return nil
+	}
+}
+
+func (r *ListCommand) filter(svcs []*cerberus.SvcConfig, states map[string]cerberus.ServiceState) []*cerberus.SvcConfig {
+	var filtered []*cerberus.SvcConfig
+	for _, s := range svcs {
+		if r.Status != "" && !strings.EqualFold(states[s.Name].String(), r.Status) {
+			continue
+		}
+		if r.filterRe != nil {
+			if !r.filterRe.MatchString(s.Name) && !r.filterRe.MatchString(s.DisplayName) && !r.filterRe.MatchString(s.Desc) {
+				continue
+			}
+		} else if r.Query != "" {
+			if !strings.Contains(strings.ToLower(s.Name), strings.ToLower(r.Query)) {
+				continue
+			}
+		}
+		if !matchLabels(s.Labels, r.Labels) {
+			continue
+		}
+		filtered = append(filtered, s)
+	}
+	return filtered
+}
+
+var startTypeOrder = map[cerberus.StartType]int{
+	cerberus.AutoStartType:        0,
+	cerberus.AutoDelayedStartType: 1,
+	cerberus.ManualStartType:      2,
+	cerberus.DisabledStartType:    3,
+}
+
+func (r *ListCommand) sort(svcs []*cerberus.SvcConfig) {
+	less := func(a, b *cerberus.SvcConfig) bool {
+		switch r.SortBy {
+		case "display-name":
+			return strings.ToLower(a.DisplayName) < strings.ToLower(b.DisplayName)
+		case "start-type":
+			return startTypeOrder[a.StartType] < startTypeOrder[b.StartType]
+		case "exe-path":
+			return strings.ToLower(a.ExePath) < strings.ToLower(b.ExePath)
+		default:
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		}
+	}
+
+	sort.SliceStable(svcs, func(i, j int) bool {
+		if r.SortDesc {
+			return less(svcs[j], svcs[i])
+		}
+		return less(svcs[i], svcs[j])
+	})
+}
+
+func printServices(w io.Writer, svcs []*cerberus.SvcConfig, states map[string]cerberus.ServiceState) {
+	fmt.Fprintf(w, "\nCerberus installed services:\n")
+	fmt.Fprintln(w, strings.Repeat("-", 80))
+
+	p := keyValuePrinter{indentSize: 5}
+	for _, s := range svcs {
+		printService(&p, s, states[s.Name])
+		p.writeTo(w)
+		fmt.Fprintf(w, "%v\n", strings.Repeat("-", 80))
+	}
+}
+
+// printService adds the configuration and the state of the service to the printer.
+func printService(p *keyValuePrinter, s *cerberus.SvcConfig, state cerberus.ServiceState) {
+	p.printlnColor("Name", s.Name, colorBold)
+	p.printlnColor("Status", state, stateColor(state))
+	p.println("Display Name", s.DisplayName)
+	p.println("Description", s.Desc)
+	p.println("Executable Path", s.ExePath)
+	if s.Scope != "" {
+		p.println("Scope", s.Scope)
+	}
+	if s.CumulativeRestarts > 0 {
+		p.println("Restarts", fmt.Sprintf("%v (last %v)", s.CumulativeRestarts, formatTime(s.LastRestart)))
+	}
+	p.println("Working Directory", s.WorkDir)
+	if s.WorkDirCreate {
+		p.println("Create Working Directory", s.WorkDirCreate)
+	}
+	if len(s.Args) > 0 {
+		p.println("Arguments", strings.Join(s.Args, " "))
+	}
+	if len(s.Env) > 0 {
+		p.println("Environment Variables", strings.Join(s.Env, " "))
+	}
+	if s.EnvFile != "" {
+		p.println("Environment File", s.EnvFile)
+	}
+	if s.InheritEnvAll {
+		p.println("Inherited Environment", "all")
+	} else if len(s.InheritEnv) > 0 {
+		p.println("Inherited Environment", strings.Join(s.InheritEnv, " "))
+	}
+	if s.NoExpandEnv {
+		p.println("Expand Environment", false)
+	}
+	p.println("Start Type", startTypeMapping[s.StartType])
+	if s.StopSignal != cerberus.NoSignal {
+		p.println("Stop Signal", s.StopSignal)
+	}
+	if s.StopTimeout > 0 {
+		p.println("Stop Timeout", s.StopTimeout)
+	}
+	if s.WatchdogInterval > 0 {
+		target := s.WatchdogURL
+		if s.WatchdogCPU {
+			if target != "" {
+				target += " and "
+			}
+			target += "cpu time"
+		}
+		p.println("Watchdog", fmt.Sprintf("%v every %v", target, s.WatchdogInterval))
+		if s.WatchdogFailThreshold > 0 {
+			p.println("Watchdog Threshold", s.WatchdogFailThreshold)
+		}
+	}
+	if s.Priority == cerberus.RealtimePriority {
+		p.printlnColor("Priority", priorityMapping[s.Priority], colorYellow)
+	} else if s.Priority != cerberus.InheritPriority {
+		p.println("Priority", priorityMapping[s.Priority])
+	}
+	if s.IOPriority != cerberus.IOPriorityInherit {
+		p.println("I/O Priority", ioPriorityMapping[s.IOPriority])
+	}
+	if s.CPUAffinity != 0 {
+		p.println("CPU Affinity", fmt.Sprintf("%#x", s.CPUAffinity))
+	}
+	if s.MemoryLimitMB > 0 {
+		p.println("Memory Limit", fmt.Sprintf("%v MB", s.MemoryLimitMB))
+	}
+	if s.JobObject.CPURatePercent > 0 {
+		p.println("CPU Rate Limit", fmt.Sprintf("%v %%", s.JobObject.CPURatePercent))
+	}
+	if s.JobObject.MaxProcesses > 0 {
+		p.println("Process Limit", s.JobObject.MaxProcesses)
+	}
+	if s.JobObject.MaxHandles > 0 {
+		p.println("Handle Limit", s.JobObject.MaxHandles)
+	}
+	if s.JobObject.KillOnJobClose {
+		p.println("Kill On Job Close", s.JobObject.KillOnJobClose)
+	}
+	if s.StdinFile != "" {
+		p.println("Stdin File", s.StdinFile)
+	}
+	if s.StdoutLog != "" {
+		p.println("Stdout Log", s.StdoutLog)
+	}
+	if s.StderrLog != "" {
+		p.println("Stderr Log", s.StderrLog)
+	}
+	if s.LogMaxSizeMB > 0 {
+		p.println("Log Max Size", fmt.Sprintf("%v MB", s.LogMaxSizeMB))
+		p.println("Log Max Backups", s.LogMaxBackups)
+	}
+	if s.MetricsPort != 0 {
+		p.println("Metrics", fmt.Sprintf("http://localhost:%v/metrics", s.MetricsPort))
+	}
+	if s.Computer != "" {
+		p.println("Computer", s.Computer)
+	}
+	if s.Group != "" {
+		p.println("Group", s.Group)
+	}
+	if len(s.Labels) > 0 {
+		p.println("Labels", formatLabels(s.Labels))
+	}
+	if s.Notes != "" {
+		p.println("Notes", s.Notes)
+	}
+	if s.PreStartCmd != "" {
+		p.println("Pre-Start Hook", fmt.Sprintf("%v [%v]", s.PreStartCmd, concatArgs(s.PreStartArgs)))
+		if s.PreStartTimeout > 0 {
+			p.println("Pre-Start Timeout", s.PreStartTimeout)
+		}
+	}
+	if s.PostStopCmd != "" {
+		p.println("Post-Stop Hook", fmt.Sprintf("%v [%v]", s.PostStopCmd, concatArgs(s.PostStopArgs)))
+	}
+	if s.PreInstallCmd != "" {
+		p.println("Pre-Install Hook", fmt.Sprintf("%v [%v]", s.PreInstallCmd, concatArgs(s.PreInstallArgs)))
+	}
+	if s.PostInstallCmd != "" {
+		p.println("Post-Install Hook", fmt.Sprintf("%v [%v]", s.PostInstallCmd, concatArgs(s.PostInstallArgs)))
+	}
+	if s.PreRemoveCmd != "" {
+		p.println("Pre-Remove Hook", fmt.Sprintf("%v [%v]", s.PreRemoveCmd, concatArgs(s.PreRemoveArgs)))
+	}
+	p.println("Service User", s.ServiceUser)
+	if s.UseCredentialManager {
+		p.println("Password", "credential manager ("+cerberus.CredentialTarget(s.Name)+")")
+	}
+	if len(s.RequiredPrivileges) > 0 {
+		p.println("Required Privileges", strings.Join(s.RequiredPrivileges, " "))
+	}
+	if s.ServiceACL != "" {
+		p.println("Service ACL", s.ServiceACL)
+	}
+	if len(s.Dependencies) > 0 {
+		p.println("Dependencies", strings.Join(s.Dependencies, " | "))
+	}
+	if len(s.OptionalDependencies) > 0 {
+		p.println("Optional Dependencies", strings.Join(s.OptionalDependencies, " | "))
+	}
+	var actlng = len(s.RecoveryActions)
+	if actlng > 0 {
+		p.println("Recovery Actions", "")
+		p.indent()
+		for _, action := range s.RecoveryActions {
+			if action.ExitCode == cerberus.AnyExitCode {
+				p.println("Error Code", "any")
+			} else if action.ExitCode == cerberus.WatchdogExitCode {
+				p.println("Error Code", "watchdog")
+			} else {
+				p.println("Error Code", action.ExitCode)
+			}
+			p.println("Action", mapAction(action.Action))
+			if action.Action&cerberus.RestartAction == cerberus.RestartAction {
+				p.println("Delay", action.Delay)
+				if action.ExponentialBackoff {
+					p.println("Backoff Multiplier", action.BackoffMultiplier)
+				}
+				if action.MaxDelay > 0 {
+					p.println("Max Delay", action.MaxDelay)
+				}
+				if action.Jitter > 0 {
+					p.println("Jitter", action.Jitter)
+				}
+				if action.CircuitBreakAfter > 0 {
+					p.println("Circuit Break", fmt.Sprintf("%v restarts within %v", action.CircuitBreakAfter, action.CircuitBreakDuration))
+				}
+				p.println("Max Restarts", action.MaxRestarts)
+				p.println("Reset After", action.ResetAfter)
+			}
+			if action.Action&cerberus.RunProgramAction == cerberus.RunProgramAction {
+				p.println("Program", action.Program)
+				p.println("Arguments", fmt.Sprintf("[%v]", concatArgs(action.Arguments)))
+			}
+			if action.Action&cerberus.WebhookAction == cerberus.WebhookAction {
+				p.println("Webhook URL", action.WebhookURL)
+			}
+			if len(action.ExtraEnv) > 0 {
+				p.println("Environment Variables", strings.Join(action.ExtraEnv, " "))
+			}
+			if actlng > 1 {
+				p.println("-", nil)
+			}
+			actlng--
+		}
+		p.unindent()
+	}
+}
+
+// writeServicesJSON writes the services with their current status as JSON array.
+// The services are converted into maps, so the keys are sorted and the output is stable.
+func writeServicesJSON(w io.Writer, svcs []*cerberus.SvcConfig, states map[string]cerberus.ServiceState) error {
+	items := make([]map[string]interface{}, 0, len(svcs))
+	for _, s := range svcs {
+		item, err := toJSONMap(s)
+		if err != nil {
+			return err
+		}
+
+		item["Status"] = states[s.Name].String()
+		items = append(items, item)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(items)
+}
+
+var csvHeader = []string{"Name", "DisplayName", "ExePath", "WorkDir", "StartType", "ServiceUser", "Status",
+	"Desc", "Args", "Env", "Dependencies", "Notes", "Scope"}
+
+// writeServicesCSV writes the services as RFC 4180 CSV, all fields are quoted
+// and multi-value fields are joined with ';'.
+func writeServicesCSV(w io.Writer, svcs []*cerberus.SvcConfig, states map[string]cerberus.ServiceState) error {
+	if err := writeCSVRecord(w, csvHeader); err != nil {
+		return err
+	}
+
+	for _, s := range svcs {
+		record := []string{s.Name, s.DisplayName, s.ExePath, s.WorkDir, startTypeMapping[s.StartType], s.ServiceUser,
+			states[s.Name].String(), s.Desc, strings.Join(s.Args, ";"), strings.Join(s.Env, ";"),
+			strings.Join(s.Dependencies, ";"), s.Notes, string(s.Scope)}
+		if err := writeCSVRecord(w, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCSVRecord(w io.Writer, fields []string) error {
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		quoted[i] = `"` + strings.Replace(f, `"`, `""`, -1) + `"`
+	}
+	_, err := io.WriteString(w, strings.Join(quoted, ",")+"\r\n")
+	return err
+}
+
+func stateColor(state cerberus.ServiceState) string {
+	switch state {
+	case cerberus.RunningState:
+		return colorGreen
+	case cerberus.StoppedState:
+		return colorRed
+	default:
+		return colorYellow
+	}
+}
+
+func toJSONMap(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
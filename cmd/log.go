@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// LogCommand shows the event log entries of a service.
+type LogCommand struct {
+	RootCommand
+	Lines  int    `long:"lines" short:"n" description:"Number of entries to show." default:"50"`
+	Follow bool   `long:"follow" short:"f" description:"Wait for new entries and show them as they are written."`
+	Format string `long:"format" short:"F" description:"Output format. One of [text|json]" default:"text"`
+	Args   struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service." required:"yes"`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will print the latest event log entries of the service. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (l *LogCommand) Execute(args []string) error {
+	if err := l.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	switch l.Format {
+	case "text", "json":
+	default:
+		errLogger.Fatalln("Invalid format passed: one of (text|json) is required.")
+	}
+
+	entries, err := cerberus.QueryEventLog(l.Args.Name, l.Lines)
+	if err != nil {
+		fatal(err)
+	}
+
+	var last uint32
+	for _, e := range cerberus.ParseEventLog(entries) {
+		l.print(e)
+		last = e.Record
+	}
+
+	if !l.Follow {
+		return nil
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	for {
+		select {
+		case <-sigs:
+			return nil
+		case <-time.After(time.Second):
+		}
+
+		entries, err := cerberus.QueryEventLogSince(l.Args.Name, last)
+		if err != nil {
+			fatal(err)
+		}
+		for _, e := range cerberus.ParseEventLog(entries) {
+			l.print(e)
+			last = e.Record
+		}
+	}
+}
+
+// print prints the entry, the json format includes the category and the extracted fields.
+func (l *LogCommand) print(e cerberus.ParsedEvent) {
+	if l.Format == "json" {
+		data, err := json.Marshal(e)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	level := strings.ToUpper(e.Level)
+	switch e.Level {
+	case "error":
+		level = colorize(colorRed, level)
+	case "warning":
+		level = colorize(colorYellow, level)
+	}
+	fmt.Printf("%v [%v] %v\n", e.Time.Format("2006-01-02 15:04:05"), level, e.Message)
+}
@@ -3,12 +3,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/go-sharp/cerberus/v2"
 	"github.com/jessevdk/go-flags"
@@ -29,32 +34,116 @@ var startTypeMapping = map[cerberus.StartType]string{
 	cerberus.DisabledStartType:    "disabled",
 }
 
+var priorityMapping = map[cerberus.ProcessPriority]string{
+	cerberus.NormalPriority:      "normal",
+	cerberus.BelowNormalPriority: "below-normal",
+	cerberus.AboveNormalPriority: "above-normal",
+	cerberus.RealtimePriority:    "realtime",
+}
+
+var ioPriorityMapping = map[cerberus.IOPriority]string{
+	cerberus.IOPriorityVeryLow: "very-low",
+	cerberus.IOPriorityLow:     "low",
+	cerberus.IOPriorityNormal:  "normal",
+}
+
 var writer io.Writer = os.Stdout
 
+// errLogger is used for errors, so they are still visible if cerberus.Logger is muted.
+var errLogger = log.New(writer, "Cerberus: ", 0)
+
+var jsonLogs = false
+
 func init() {
 	parser.AddCommand("version", "Show version", "Show version", CommandFunc(showVersion))
 	parser.AddCommand("list", "Show cerberus installed services", "Show cerberus installed services", &listCommand)
 	parser.AddCommand("install", "Install a binary as service", "Install a binary as service", &installCommand)
 	parser.AddCommand("run", "Runs a configured service", "Runs a configured service", &runCommand)
 	parser.AddCommand("remove", "Removes an installed service", "Removes an installed service", &removeCommand)
+	parser.AddCommand("start", "Starts an installed service", "Starts an installed service", &StartCommand{})
+	parser.AddCommand("stop", "Stops an installed service", "Stops an installed service", &StopCommand{})
+	parser.AddCommand("restart", "Restarts an installed service", "Restarts an installed service", &RestartCommand{})
+	parser.AddCommand("status", "Shows the state of an installed service", "Shows the state of an installed service", &StatusCommand{})
+	parser.AddCommand("enable", "Enables a disabled service", "Enables a disabled service", &EnableCommand{})
+	parser.AddCommand("disable", "Disables an installed service", "Disables an installed service", &DisableCommand{})
+	parser.AddCommand("export", "Exports service configurations", "Exports service configurations as JSON, reg file, sc.exe batch or PowerShell script", &ExportCommand{})
+	parser.AddCommand("import", "Installs services from a JSON file, WinSW or NSSM", "Installs services from a JSON file created by export, a WinSW configuration or a service managed by NSSM", &ImportCommand{})
+	parser.AddCommand("validate", "Validates services from a JSON file", "Validates services from a JSON file", &ValidateCommand{})
+	parser.AddCommand("diff", "Shows the changes a JSON file would apply to a service", "Shows the changes a JSON file would apply to a service", &DiffCommand{})
+	parser.AddCommand("clone", "Installs a copy of an installed service", "Installs a copy of an installed service", &CloneCommand{})
+	parser.AddCommand("backup", "Saves all services to a backup file", "Saves all services to a backup file", &BackupCommand{})
+	parser.AddCommand("restore", "Reinstalls all services from a backup file", "Reinstalls all services from a backup file", &RestoreCommand{})
+	parser.AddCommand("log", "Shows the event log entries of a service", "Shows the event log entries of a service", &LogCommand{})
+	parser.AddCommand("stats", "Shows the operational metrics of a service", "Shows the operational metrics of a service", &StatsCommand{})
+	parser.AddCommand("upgrade", "Replaces the executable of an installed service", "Replaces the executable of an installed service", &UpgradeCommand{})
+	parser.AddCommand("completion", "Prints a shell completion script", "Prints a shell completion script", &CompletionCommand{})
+	tmplCmd, _ := parser.AddCommand("template",
+		"Managing reusable service templates",
+		"Managing reusable service templates",
+		CommandFunc(nil))
+	tmplCmd.AddCommand("save", "Saves an installed service as template", "Saves an installed service as template", &TemplateSaveCommand{})
+	tmplCmd.AddCommand("list", "Shows all templates", "Shows all templates", &TemplateListCommand{})
+	tmplCmd.AddCommand("del", "Deletes a template", "Deletes a template", &TemplateDelCommand{})
+	tmplCmd.AddCommand("apply", "Installs a service from a template", "Installs a service from a template", &TemplateApplyCommand{})
 	recCmd, _ := parser.AddCommand("recovery",
 		"Editing recovery actions for an installed service",
 		"Editing recovery actions for an installed service",
 		CommandFunc(nil))
 	recCmd.AddCommand("set", "Sets a recovery action for an installed service", "Set a recovery action for an installed service", &RecoverySetCommand{})
 	recCmd.AddCommand("del", "Deletes a recovery action for an installed service", "Deletes a recovery action for an installed service", &RecoveryDelCommand{})
+	groupCmd, _ := parser.AddCommand("group",
+		"Starting and stopping groups of related services",
+		"Starting and stopping groups of related services",
+		CommandFunc(nil))
+	groupCmd.AddCommand("start", "Starts all services of a group", "Starts all services of a group in parallel", &GroupStartCommand{})
+	groupCmd.AddCommand("stop", "Stops all services of a group", "Stops all services of a group, dependent services first", &GroupStopCommand{})
+	groupCmd.AddCommand("list", "Shows all groups and their services", "Shows all groups and their services", &GroupListCommand{})
+	credCmd, _ := parser.AddCommand("credential",
+		"Managing service user passwords in the Windows Credential Manager",
+		"Managing service user passwords in the Windows Credential Manager",
+		CommandFunc(nil))
+	credCmd.AddCommand("set", "Stores the password of a service user", "Stores the password of a service user", &CredentialSetCommand{})
+	credCmd.AddCommand("del", "Deletes the password of a service user", "Deletes the password of a service user", &CredentialDelCommand{})
 
 	parser.AddCommand("edit", "Editing an installed service", "Editing an installed service", &EditCommand{})
+	parser.AddCommand("migrate", "Upgrades all service configurations to the current schema", "Upgrades all service configurations to the current schema", &MigrateCommand{})
 
 	// Enable logging to a file, required to debug service errors while executing the run command.
 	logpath := os.Getenv("CERBERUS_LOGGER")
 	if logpath != "" {
-		fs, err := os.OpenFile(logpath, os.O_CREATE|os.O_APPEND, 0666)
+		var maxSize uint64
+		if v := os.Getenv("CERBERUS_LOG_MAX_SIZE_MB"); v != "" {
+			size, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				errLogger.Fatalln("invalid CERBERUS_LOG_MAX_SIZE_MB:", err)
+			}
+			maxSize = size
+		}
+
+		var maxBackups int
+		if v := os.Getenv("CERBERUS_LOG_MAX_BACKUPS"); v != "" {
+			backups, err := strconv.Atoi(v)
+			if err != nil || backups < 0 {
+				errLogger.Fatalln("invalid CERBERUS_LOG_MAX_BACKUPS:", v)
+			}
+			maxBackups = backups
+		}
+
+		fs, err := cerberus.NewRotatingWriter(logpath, maxSize, maxBackups)
 		if err != nil {
-			cerberus.Logger.Fatalln(err)
+			fatal(err)
 		}
 		writer = io.MultiWriter(fs, os.Stdout)
 		cerberus.Logger = log.New(writer, "Cerberus: ", 0)
+		errLogger = log.New(writer, "Cerberus: ", 0)
+	}
+
+	// Emit structured logs for log aggregation pipelines.
+	if os.Getenv("CERBERUS_LOG_FORMAT") == "json" {
+		jsonLogs = true
+		cerberus.Logger = log.New(cerberus.NewJSONLogWriter(writer, "info"), "", 0)
+		cerberus.DebugLogger.SetPrefix("")
+		errLogger = log.New(cerberus.NewJSONLogWriter(writer, "error"), "", 0)
 	}
 }
 
@@ -66,6 +155,12 @@ func main() {
 	os.Exit(0)
 }
 
+// fatal logs the error and exits, JSON logs contain the error and its code as separate keys.
+func fatal(err error) {
+	cerberus.LogError(errLogger, err)
+	os.Exit(1)
+}
+
 func showVersion(args []string) error {
 	fmt.Println("Cerberus: ", version)
 	return nil
@@ -74,6 +169,11 @@ func showVersion(args []string) error {
 // RootCommand used for all subcommands
 type RootCommand struct {
 	Verbose bool `long:"verbose" short:"v" description:"Verbose output"`
+	Quiet   bool `long:"quiet" short:"q" description:"Suppress all output except errors, takes precedence over verbose output for non-error output."`
+	Color   bool `long:"color" description:"Force colored output, per default colors are used if the terminal supports them."`
+	NoColor bool `long:"no-color" description:"Disable colored output."`
+	// UserScope can also be enabled with CERBERUS_USER_SCOPE=1.
+	UserScope bool `long:"user-scope" description:"Store the cerberus configuration of the services private to the current user (HKCU)."`
 }
 
 // Execute will setup root command properly. The args parameter is not used
@@ -81,85 +181,28 @@ type RootCommand struct {
 func (r *RootCommand) Execute(args []string) (err error) {
 	_, verbose := os.LookupEnv("CERBERUS_VERBOSE")
 	if r.Verbose || verbose {
-		cerberus.DebugLogger.SetOutput(writer)
+		if jsonLogs {
+			cerberus.DebugLogger.SetOutput(cerberus.NewJSONLogWriter(writer, "debug"))
+		} else {
+			cerberus.DebugLogger.SetOutput(writer)
+		}
 	}
 
-	return nil
-}
-
-// ListCommand shows all cerberus installed services.
-type ListCommand struct {
-	RootCommand
-	Query string `long:"filter" short:"f" description:"Only show services whose name contains the filter word."`
-}
-
-// Execute will list all with cerberus installed services. The args parameter is not used
-// and is only to fullfil the go-flags commander interface.
-func (r *ListCommand) Execute(args []string) (err error) {
-	if err := r.RootCommand.Execute(args); err != nil {
-		cerberus.Logger.Fatalln(err)
+	if r.Quiet {
+		cerberus.Logger = log.New(ioutil.Discard, "Cerberus: ", 0)
 	}
 
-	svcs, err := cerberus.LoadServicesCfg()
-	if err != nil {
-		cerberus.DebugLogger.Fatalln(err)
+	if r.UserScope {
+		cerberus.SetUserScope(true)
 	}
 
-	fmt.Printf("\nCerberus installed services:\n")
-	fmt.Println(strings.Repeat("-", 80))
-
-	p := keyValuePrinter{indentSize: 5}
-	for _, s := range svcs {
-		if r.Query != "" {
-			if !strings.Contains(strings.ToLower(s.Name), strings.ToLower(r.Query)) {
-				continue
-			}
-		}
-
-		p.println("Name", s.Name)
-		p.println("Display Name", s.DisplayName)
-		p.println("Description", s.Desc)
-		p.println("Executable Path", s.ExePath)
-		p.println("Working Directory", s.WorkDir)
-		if len(s.Args) > 0 {
-			p.println("Arguments", strings.Join(s.Args, " "))
-		}
-		if len(s.Env) > 0 {
-			p.println("Environment Variables", strings.Join(s.Env, " "))
-		}
-		p.println("Start Type", startTypeMapping[s.StartType])
-		if s.StopSignal != cerberus.NoSignal {
-			p.println("Stop Signal", s.StopSignal)
-		}
-		p.println("Service User", s.ServiceUser)
-		if len(s.Dependencies) > 0 {
-			p.println("Dependencies", strings.Join(s.Dependencies, " | "))
-		}
-		var actlng = len(s.RecoveryActions)
-		if actlng > 0 {
-			p.println("Recovery Actions", "")
-			p.indent()
-			for _, action := range s.RecoveryActions {
-				p.println("Error Code", action.ExitCode)
-				p.println("Action", mapAction(action.Action))
-				if action.Action&cerberus.RestartAction == cerberus.RestartAction {
-					p.println("Delay", action.Delay)
-					p.println("Max Restarts", action.MaxRestarts)
-					p.println("Reset After", action.ResetAfter)
-				}
-				if action.Action&cerberus.RunProgramAction == cerberus.RunProgramAction {
-					p.println("Program", action.Program)
-					p.println("Arguments", fmt.Sprintf("[%v]", concatArgs(action.Arguments)))
-				}
-				if actlng > 1 {
-					p.println("-", nil)
-				}
-				actlng--
-			}
-		}
-
-		p.writeTo(os.Stdout)
-		fmt.Fprintf(os.Stdout, "%v\n", strings.Repeat("-", 80))
+	switch {
+	case r.NoColor:
+		useColor = false
+	case r.Color:
+		useColor = true
+	default:
+		useColor = detectColor()
 	}
 
 	return nil
@@ -168,34 +211,153 @@ func (r *ListCommand) Execute(args []string) (err error) {
 // InstallCommand used to install a binary as service.
 type InstallCommand struct {
 	RootCommand
-	ExePath     string   `long:"executable" short:"x" description:"Full path to the executable" required:"true"`
-	WorkDir     string   `long:"workdir" short:"w" description:"Working directory of the executable, if not specified the folder of the executable is used."`
-	Name        string   `long:"name" short:"n" description:"Name of the service, if not specified name of the executable is used."`
-	DisplayName string   `long:"display-name" short:"i" description:"Display name of the service, if not specified name of the executable is used."`
-	Desc        string   `long:"desc" short:"d" description:"Description of the service"`
-	Args        []string `long:"arg" short:"a" description:"Arguments to pass to the executable in the same order as specified. (ex. -a \"-la\" -a \"123\")"`
-	Env         []string `long:"env" short:"e" description:"Environment variables to set for the executable. (ex. -e \"TERM=bash\" -e \"EDITOR=none\")"`
+	remoteFlags
+	ExePath     string        `long:"executable" short:"x" description:"Full path to the executable" required:"true"`
+	WorkDir     string        `long:"workdir" short:"w" description:"Working directory of the executable, if not specified the folder of the executable is used."`
+	CreateWD    bool          `long:"create-workdir" description:"Create the working directory on start if it doesn't exist."`
+	Name        string        `long:"name" short:"n" description:"Name of the service, if not specified name of the executable is used."`
+	DisplayName string        `long:"display-name" short:"i" description:"Display name of the service, if not specified name of the executable is used."`
+	Desc        string        `long:"desc" short:"d" description:"Description of the service"`
+	Args        []string      `long:"arg" short:"a" description:"Arguments to pass to the executable in the same order as specified. (ex. -a \"-la\" -a \"123\")"`
+	Env         []string      `long:"env" short:"e" description:"Environment variables to set for the executable. (ex. -e \"TERM=bash\" -e \"EDITOR=none\")"`
+	EnvFile     string        `long:"env-file" description:"File with environment variables (KEY=VALUE) to set for the executable, it is read on every start."`
+	InheritEnv  []string      `long:"inherit-env" description:"Host environment variable to pass to the executable, per default only common system variables like PATH are passed. (ex. --inherit-env JAVA_HOME)"`
+	InheritAll  bool          `long:"inherit-all-env" description:"Pass the whole host environment to the executable."`
+	NoExpand    bool          `long:"no-expand-env" description:"Don't expand ${VAR} references in the executable, working directory, stdin file, logs, arguments and environment on start."`
+	StopTimeout time.Duration `long:"stop-timeout" description:"Time to wait for the service to stop, max. 125s. (ex. --stop-timeout 60s) (default: 30s)"`
+	WdInterval  time.Duration `long:"watchdog-interval" description:"Interval to check if the executable still responds, zero disables the watchdog. (ex. --watchdog-interval 30s)"`
+	WdURL       string        `long:"watchdog-url" description:"URL the watchdog calls with GET, the watchdog requires the url or the cpu check."`
+	WdCPU       bool          `long:"watchdog-cpu" description:"Consider the executable hung if it doesn't use any cpu time between two checks. Note: an idle executable, ex. waiting for requests, is restarted too."`
+	WdThreshold int           `long:"watchdog-threshold" description:"Number of failed watchdog checks in a row until the executable is stopped. (default: 3)"`
+	Priority    string        `long:"priority" description:"Priority class of the executable. One of [normal|below-normal|above-normal|realtime]"`
+	IOPriority  string        `long:"io-priority" description:"I/O priority of the executable. One of [very-low|low|normal]"`
+	CPUAffinity string        `long:"cpu-affinity" description:"CPU affinity as hex mask, zero inherits the system default. (ex. --cpu-affinity 0x3)"`
+	MemoryLimit uint64        `long:"memory-limit-mb" description:"Maximum memory in MB the executable is allowed to commit, zero means unlimited."`
+	CPURate     uint32        `long:"cpu-rate" description:"Maximum cpu usage in percent of all processors, zero means unlimited."`
+	MaxProcs    uint32        `long:"max-processes" description:"Maximum number of active processes the executable is allowed to create including itself, zero means unlimited."`
+	MaxHandles  uint32        `long:"max-handles" description:"Maximum number of open handles, the executable is terminated if it exceeds the limit. Zero means unlimited."`
+	KillOnClose bool          `long:"kill-on-job-close" description:"Terminate the executable and all its child processes if the cerberus service host exits."`
+	StdinFile   string        `long:"stdin-file" description:"File or named pipe to read the standard input of the executable from, it is opened on every start."`
+	StdoutLog   string        `long:"stdout-log" description:"File to write the standard output of the executable to."`
+	StderrLog   string        `long:"stderr-log" description:"File to write the standard error of the executable to."`
+	LogMaxSize  uint64        `long:"log-max-size-mb" description:"Rotate the output logs if they exceed the size in MB, zero disables rotation."`
+	LogBackups  int           `long:"log-max-backups" description:"Maximum number of rotated output logs to keep, zero keeps all."`
+	Labels      []string      `long:"label" short:"l" description:"Labels to tag the service with. (ex. -l \"env=prod\" -l \"team=platform\")"`
+	Notes       string        `long:"notes" description:"Notes for operators, use @filename to read the notes from a file."`
+	PreStart    string        `long:"pre-start" description:"Program to run before the executable is started, the service fails to start if it exits with an error."`
+	PreStartArg []string      `long:"pre-start-arg" description:"Arguments to pass to the pre-start program. (ex. --pre-start-arg \"-port\" --pre-start-arg \"5432\")"`
+	PreStartTO  time.Duration `long:"pre-start-timeout" description:"Maximum time the pre-start program is allowed to run. (ex. --pre-start-timeout 60s) (default: 30s)"`
+	PostStop    string        `long:"post-stop" description:"Program to run after the executable has stopped."`
+	PostStopArg []string      `long:"post-stop-arg" description:"Arguments to pass to the post-stop program. (ex. --post-stop-arg \"-v\")"`
+	PreInstall  string        `long:"pre-install" description:"Program to run before the service is created, the installation is aborted if it exits with an error."`
+	PreInstArg  []string      `long:"pre-install-arg" description:"Arguments to pass to the pre-install program, it gets the service in CERBERUS_SVC_NAME and CERBERUS_SVC_EXE."`
+	PostInstall string        `long:"post-install" description:"Program to run after the service is installed, a failure is only reported as warning."`
+	PostInstArg []string      `long:"post-install-arg" description:"Arguments to pass to the post-install program, it gets the service in CERBERUS_SVC_NAME, CERBERUS_SVC_EXE and CERBERUS_SVC_DISPLAY_NAME."`
+	PreRemove   string        `long:"pre-remove" description:"Program to run before the service is removed, the removal is aborted if it exits with an error."`
+	PreRemArg   []string      `long:"pre-remove-arg" description:"Arguments to pass to the pre-remove program, it gets the same variables as the post-install program."`
+	UseCredMan  bool          `long:"use-credential-manager" description:"Read the password of the service user from the Windows Credential Manager, see credential set."`
+	GMSA        string        `long:"gmsa" description:"Group managed service account to run the service, its password is managed by the active directory. (ex. --gmsa DOMAIN\\svc$)"`
+	UseVirtual  bool          `long:"use-virtual-account" description:"Run the service as its virtual account NT SERVICE\\SERVICE_NAME, which requires no password."`
+	Privileges  []string      `long:"privilege" description:"Privilege the service requires, the service process is restricted to the listed privileges. (ex. --privilege SeChangeNotifyPrivilege)"`
+	ACL         string        `long:"acl" description:"DACL of the service as SDDL string, controls who can start, stop and configure the service. (ex. --acl \"D:(A;;CCLCSWRPWPDTLOCRRC;;;SY)(A;;RPWPLC;;;BU)\")"`
+	MetricsPort uint16        `long:"metrics-port" description:"Serve Prometheus metrics on localhost:PORT/metrics, zero disables the metrics."`
+	DryRun      bool          `long:"dry-run" description:"Show the resolved configuration of the service without installing it."`
+	Group       string        `long:"group" description:"Group to start and stop the service together with related services, see group start."`
 }
 
 // Execute will install a binary as service. The args parameter is not used
 // and is only to fullfil the go-flags commander interface.
 func (i *InstallCommand) Execute(args []string) (err error) {
 	if err := i.RootCommand.Execute(args); err != nil {
-		cerberus.Logger.Fatalln(err)
+		fatal(err)
 	}
+	cerberus.SetComputer(i.Computer)
 
 	svcCfg := cerberus.SvcConfig{
-		ExePath:     i.ExePath,
-		Name:        i.Name,
-		WorkDir:     i.WorkDir,
-		Args:        i.Args,
-		Env:         i.Env,
-		Desc:        i.Desc,
-		DisplayName: i.DisplayName,
+		ExePath:         i.ExePath,
+		Name:            i.Name,
+		WorkDir:         i.WorkDir,
+		WorkDirCreate:   i.CreateWD,
+		Args:            i.Args,
+		Env:             i.Env,
+		EnvFile:         i.EnvFile,
+		InheritEnv:      i.InheritEnv,
+		InheritEnvAll:   i.InheritAll,
+		NoExpandEnv:     i.NoExpand,
+		Desc:            i.Desc,
+		DisplayName:     i.DisplayName,
+		StopTimeout:     i.StopTimeout,
+		MemoryLimitMB:   i.MemoryLimit,
+		StdinFile:       i.StdinFile,
+		StdoutLog:       i.StdoutLog,
+		StderrLog:       i.StderrLog,
+		LogMaxSizeMB:    i.LogMaxSize,
+		LogMaxBackups:   i.LogBackups,
+		Labels:          parseLabels(i.Labels),
+		Notes:           readNotes(i.Notes),
+		PreStartCmd:     i.PreStart,
+		PreStartArgs:    i.PreStartArg,
+		PreStartTimeout: i.PreStartTO,
+		PostStopCmd:     i.PostStop,
+		PostStopArgs:    i.PostStopArg,
+		PreInstallCmd:   i.PreInstall,
+		PreInstallArgs:  i.PreInstArg,
+		PostInstallCmd:  i.PostInstall,
+		PostInstallArgs: i.PostInstArg,
+		PreRemoveCmd:    i.PreRemove,
+		PreRemoveArgs:   i.PreRemArg,
+	}
+
+	svcCfg.UseCredentialManager = i.UseCredMan
+	svcCfg.ServiceACL = i.ACL
+	svcCfg.RequiredPrivileges = i.Privileges
+	svcCfg.UseVirtualAccount = i.UseVirtual
+	if i.GMSA != "" {
+		svcCfg.ServiceUser = i.GMSA
+		svcCfg.UseGMSA = true
+	}
+	svcCfg.WatchdogInterval = i.WdInterval
+	svcCfg.WatchdogURL = i.WdURL
+	svcCfg.WatchdogCPU = i.WdCPU
+	svcCfg.WatchdogFailThreshold = i.WdThreshold
+	svcCfg.MetricsPort = i.MetricsPort
+	svcCfg.Group = i.Group
+
+	svcCfg.JobObject = cerberus.JobObjectConfig{
+		CPURatePercent: i.CPURate,
+		MaxProcesses:   i.MaxProcs,
+		MaxHandles:     i.MaxHandles,
+		KillOnJobClose: i.KillOnClose,
+	}
+
+	if i.Priority != "" {
+		svcCfg.Priority = parsePriority(i.Priority)
+	}
+
+	if i.IOPriority != "" {
+		svcCfg.IOPriority = parseIOPriority(i.IOPriority)
+	}
+
+	if i.CPUAffinity != "" {
+		svcCfg.CPUAffinity = parseAffinity(i.CPUAffinity)
+	}
+
+	if i.DryRun {
+		cfg, err := cerberus.ResolveInstallConfig(svcCfg)
+		if err != nil {
+			fatal(err)
+		}
+
+		fmt.Printf("\nService %v would be installed with:\n", cfg.Name)
+		fmt.Println(strings.Repeat("-", 80))
+		p := keyValuePrinter{indentSize: 5}
+		printService(&p, cfg, cerberus.UnknownState)
+		p.writeTo(os.Stdout)
+		return nil
 	}
 
 	if err := cerberus.InstallService(svcCfg); err != nil {
-		cerberus.Logger.Fatalln(err)
+		fatal(err)
 	}
 
 	return nil
@@ -204,7 +366,10 @@ func (i *InstallCommand) Execute(args []string) (err error) {
 // RemoveCommand used to remove a service.
 type RemoveCommand struct {
 	RootCommand
-	Args struct {
+	remoteFlags
+	SkipHooks bool `long:"skip-hooks" description:"Don't run the pre-remove hook, ex. in an emergency if the hook fails."`
+	Force     bool `long:"force" description:"Kill the service process immediately instead of waiting for it to stop gracefully."`
+	Args      struct {
 		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service to remove." required:"yes"`
 	} `positional-args:"yes" required:"1"`
 }
@@ -213,11 +378,12 @@ type RemoveCommand struct {
 // and is only to fullfil the go-flags commander interface.
 func (r *RemoveCommand) Execute(args []string) error {
 	if err := r.RootCommand.Execute(args); err != nil {
-		cerberus.Logger.Fatalln(err)
+		fatal(err)
 	}
+	cerberus.SetComputer(r.Computer)
 
-	if err := cerberus.RemoveService(r.Args.Name); err != nil {
-		cerberus.Logger.Fatalln(err)
+	if err := cerberus.RemoveServiceWithOptions(context.Background(), r.Args.Name, cerberus.RemoveOptions{SkipHooks: r.SkipHooks, Force: r.Force}); err != nil {
+		fatal(err)
 	}
 
 	return nil
@@ -236,16 +402,16 @@ func (r *RunCommand) Execute(args []string) (err error) {
 	// If we run as a service, we need to catch panics.
 	defer func() {
 		if r := recover(); r != nil {
-			cerberus.Logger.Fatalln(r)
+			errLogger.Fatalln(r)
 		}
 	}()
 
 	if err := r.RootCommand.Execute(args); err != nil {
-		cerberus.Logger.Fatalln(err)
+		fatal(err)
 	}
 
 	if err := cerberus.RunService(r.Args.Name); err != nil {
-		cerberus.Logger.Fatalln(err)
+		fatal(err)
 	}
 
 	return nil
@@ -254,44 +420,131 @@ func (r *RunCommand) Execute(args []string) (err error) {
 // EditCommand runs the configured service directly.
 type EditCommand struct {
 	RootCommand
-	WorkDir      *string   `long:"workdir" short:"w" description:"Working directory of the executable.."`
-	DisplayName  *string   `long:"display-name" short:"i" description:"Display name of the service."`
-	Desc         *string   `long:"desc" short:"d" description:"Description of the service"`
-	Arguments    *[]string `long:"arg" short:"a" description:"Arguments to pass to the executable in the same order as specified. (ex. -a \"-la\" -a \"123\")"`
-	Env          *[]string `long:"env" short:"e" description:"Environment variables to set for the executable. (ex. -e \"TERM=bash\" -e \"EDITOR=none\")"`
-	Dependencies *[]string `long:"dependencies" short:"n" description:"Services on which this service depend on. (ex. -a serviceA -a serviceB)"`
-	ServiceUser  *string   `long:"user" short:"u" description:"User under which this service will run."`
-	Password     *string   `long:"password" short:"p" description:"Password for the specified service user."`
-	StartType    *string   `long:"start-type" short:"s" description:"Service start type. One of [manual|autostart|delayed|disabled]"`
+	remoteFlags
+	editFlags
+	ResetStats bool `long:"reset-stats" description:"Reset the restart and runtime statistics of the service."`
+	Args       struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service to edit."`
+	} `positional-args:"yes" required:"1"`
+}
+
+// remoteFlags select the computer whose service control manager is used, they are shared by the commands
+// which support services on a remote computer.
+type remoteFlags struct {
+	Computer string `long:"computer" description:"Manage the service on the given remote computer, the configuration is also stored on this computer. (ex. --computer SRV01)"`
+}
+
+// editFlags are the flags to change a service configuration, they are shared by the edit and clone command.
+type editFlags struct {
+	WorkDir      *string        `long:"workdir" short:"w" description:"Working directory of the executable.."`
+	DisplayName  *string        `long:"display-name" short:"i" description:"Display name of the service."`
+	Desc         *string        `long:"desc" short:"d" description:"Description of the service"`
+	Arguments    *[]string      `long:"arg" short:"a" description:"Arguments to pass to the executable in the same order as specified. (ex. -a \"-la\" -a \"123\")"`
+	Env          *[]string      `long:"env" short:"e" description:"Environment variables to set for the executable. (ex. -e \"TERM=bash\" -e \"EDITOR=none\")"`
+	EnvFile      *string        `long:"env-file" description:"File with environment variables (KEY=VALUE) to set for the executable, empty removes the file."`
+	InheritEnv   *[]string      `long:"inherit-env" description:"Host environment variables to pass to the executable, an empty value restores the common system variables. (ex. --inherit-env JAVA_HOME)"`
+	Dependencies *[]string      `long:"dependencies" short:"n" description:"Services on which this service depend on. (ex. -a serviceA -a serviceB)"`
+	OptionalDeps *[]string      `long:"optional-dependencies" description:"Services to start and wait for if they are installed, an empty value removes them. (ex. --optional-dependencies serviceA)"`
+	ServiceUser  *string        `long:"user" short:"u" description:"User under which this service will run."`
+	Password     *string        `long:"password" short:"p" description:"Password for the specified service user."`
+	Privileges   *[]string      `long:"privilege" description:"Privileges the service requires, an empty value removes the restriction. (ex. --privilege SeChangeNotifyPrivilege)"`
+	GMSA         *string        `long:"gmsa" description:"Group managed service account to run the service, its password is managed by the active directory. (ex. --gmsa DOMAIN\\svc$)"`
+	ACL          *string        `long:"acl" description:"DACL of the service as SDDL string, controls who can start, stop and configure the service."`
+	StartType    *string        `long:"start-type" short:"s" description:"Service start type. One of [manual|autostart|delayed|disabled]"`
+	StopTimeout  *time.Duration `long:"stop-timeout" description:"Time to wait for the service to stop, max. 125s. Zero restores the default of 30s."`
+	WdInterval   *time.Duration `long:"watchdog-interval" description:"Interval to check if the executable still responds, zero disables the watchdog."`
+	WdURL        *string        `long:"watchdog-url" description:"URL the watchdog calls with GET, the watchdog requires the url or the cpu check."`
+	WdCPU        *bool          `long:"watchdog-cpu" description:"Consider the executable hung if it doesn't use any cpu time between two checks. Note: an idle executable, ex. waiting for requests, is restarted too."`
+	NoWdCPU      *bool          `long:"no-watchdog-cpu" description:"Don't check the cpu time of the executable."`
+	WdThreshold  *int           `long:"watchdog-threshold" description:"Number of failed watchdog checks in a row until the executable is stopped, zero restores the default of 3."`
+	Priority     *string        `long:"priority" description:"Priority class of the executable. One of [inherit|normal|below-normal|above-normal|realtime]"`
+	IOPriority   *string        `long:"io-priority" description:"I/O priority of the executable. One of [inherit|very-low|low|normal]"`
+	CPUAffinity  *string        `long:"cpu-affinity" description:"CPU affinity as hex mask, zero inherits the system default. (ex. --cpu-affinity 0x3)"`
+	MemoryLimit  *uint64        `long:"memory-limit-mb" description:"Maximum memory in MB the executable is allowed to commit, zero means unlimited."`
+	CPURate      *uint32        `long:"cpu-rate" description:"Maximum cpu usage in percent of all processors, zero means unlimited."`
+	MaxProcs     *uint32        `long:"max-processes" description:"Maximum number of active processes the executable is allowed to create including itself, zero means unlimited."`
+	MaxHandles   *uint32        `long:"max-handles" description:"Maximum number of open handles, the executable is terminated if it exceeds the limit. Zero means unlimited."`
+	StdinFile    *string        `long:"stdin-file" description:"File or named pipe to read the standard input of the executable from, empty disables the input."`
+	StdoutLog    *string        `long:"stdout-log" description:"File to write the standard output of the executable to, empty disables the log."`
+	StderrLog    *string        `long:"stderr-log" description:"File to write the standard error of the executable to, empty disables the log."`
+	LogMaxSize   *uint64        `long:"log-max-size-mb" description:"Rotate the output logs if they exceed the size in MB, zero disables rotation."`
+	LogBackups   *int           `long:"log-max-backups" description:"Maximum number of rotated output logs to keep, zero keeps all."`
+	MetricsPort  *uint16        `long:"metrics-port" description:"Serve Prometheus metrics on localhost:PORT/metrics, zero disables the metrics."`
+	Group        *string        `long:"group" description:"Group to start and stop the service together with related services, empty removes the service from its group."`
+	Labels       *[]string      `long:"label" short:"l" description:"Labels to add or update, an empty value removes the label. (ex. -l \"env=prod\" -l \"team=\")"`
+	Notes        *string        `long:"notes" description:"Notes for operators, use @filename to read the notes from a file."`
+	PreStart     *string        `long:"pre-start" description:"Program to run before the executable is started, empty removes the hook."`
+	PreStartArg  *[]string      `long:"pre-start-arg" description:"Arguments to pass to the pre-start program. (ex. --pre-start-arg \"-port\" --pre-start-arg \"5432\")"`
+	PreStartTO   *time.Duration `long:"pre-start-timeout" description:"Maximum time the pre-start program is allowed to run. Zero restores the default of 30s."`
+	PostStop     *string        `long:"post-stop" description:"Program to run after the executable has stopped, empty removes the hook."`
+	PostStopArg  *[]string      `long:"post-stop-arg" description:"Arguments to pass to the post-stop program. (ex. --post-stop-arg \"-v\")"`
+	PreRemove    *string        `long:"pre-remove" description:"Program to run before the service is removed, empty removes the hook."`
+	PreRemArg    *[]string      `long:"pre-remove-arg" description:"Arguments to pass to the pre-remove program."`
 	// Flags
 	SignalCtrlC    *bool `long:"signal-ctrlc" description:"Send Ctrl-C to process if service has to stop."`
+	SignalCtrlBrk  *bool `long:"signal-ctrlbreak" description:"Send Ctrl-Break to process if service has to stop."`
 	SignalWmQuit   *bool `long:"signal-wmquit" description:"Send WM_QUIT to process if service has to stop."`
 	SignalWmClose  *bool `long:"signal-wmclose" description:"Send WM_CLOSE to process if service has to stop."`
 	NoSignal       *bool `long:"no-signal" description:"Restore default behaviour and doesn't send any signals."`
 	NoDependencies *bool `long:"no-deps" description:"Remove all dependencies for this service."`
 	NoArgs         *bool `long:"no-args" description:"Remove all arguments for this service."`
 	NoEnv          *bool `long:"no-env" description:"Remove all environment variables for this service."`
+	NoLabels       *bool `long:"no-labels" description:"Remove all labels for this service."`
+	CreateWD       *bool `long:"create-workdir" description:"Create the working directory on start if it doesn't exist."`
+	NoCreateWD     *bool `long:"no-create-workdir" description:"Don't create the working directory on start."`
 	UseLocalSystem *bool `long:"use-system-account" description:"Use local system account to run this service."`
-	Args           struct {
-		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service to edit."`
-	} `positional-args:"yes" required:"1"`
+	UseVirtual     *bool `long:"use-virtual-account" description:"Run the service as its virtual account NT SERVICE\\SERVICE_NAME, which requires no password."`
+	InheritAll     *bool `long:"inherit-all-env" description:"Pass the whole host environment to the executable."`
+	NoInheritAll   *bool `long:"no-inherit-all-env" description:"Only pass the inherited environment variables to the executable."`
+	ExpandEnv      *bool `long:"expand-env" description:"Expand ${VAR} references in the executable, working directory, stdin file, logs, arguments and environment on start."`
+	NoExpandEnv    *bool `long:"no-expand-env" description:"Don't expand ${VAR} references, they are passed literally."`
+	KillOnClose    *bool `long:"kill-on-job-close" description:"Terminate the executable and all its child processes if the cerberus service host exits."`
+	NoKillOnClose  *bool `long:"no-kill-on-job-close" description:"Keep the executable running if the cerberus service host exits."`
+	UseCredMan     *bool `long:"use-credential-manager" description:"Read the password of the service user from the Windows Credential Manager, a passed password is stored there."`
+	NoCredMan      *bool `long:"no-credential-manager" description:"Don't read the password of the service user from the Windows Credential Manager."`
 }
 
 // Execute will run the service handler.
 func (e *EditCommand) Execute(args []string) (err error) {
 	if err := e.RootCommand.Execute(args); err != nil {
-		cerberus.Logger.Fatalln(err)
+		fatal(err)
 	}
+	cerberus.SetComputer(e.Computer)
 
 	svc, err := cerberus.LoadServiceCfg(e.Args.Name)
 	if err != nil {
-		cerberus.Logger.Fatalln(err)
+		fatal(err)
+	}
+
+	e.apply(svc)
+	cerberus.DebugLogger.Printf("%+v\n", *svc)
+	if err := cerberus.UpdateService(*svc); err != nil {
+		fatal(err)
 	}
 
+	if e.ResetStats {
+		if err := cerberus.ResetServiceStats(svc.Name); err != nil {
+			fatal(err)
+		}
+	}
+
+	return nil
+}
+
+// apply changes the given configuration according to the passed flags.
+func (e *editFlags) apply(svc *cerberus.SvcConfig) {
 	if e.WorkDir != nil && *e.WorkDir != "" {
 		svc.WorkDir = *e.WorkDir
 	}
 
+	if e.CreateWD != nil && *e.CreateWD {
+		svc.WorkDirCreate = true
+	}
+
+	if e.NoCreateWD != nil && *e.NoCreateWD {
+		svc.WorkDirCreate = false
+	}
+
 	if e.DisplayName != nil {
 		svc.DisplayName = *e.DisplayName
 	}
@@ -308,18 +561,85 @@ func (e *EditCommand) Execute(args []string) (err error) {
 		svc.Env = *e.Env
 	}
 
+	if e.EnvFile != nil {
+		svc.EnvFile = *e.EnvFile
+	}
+
+	if e.InheritEnv != nil {
+		svc.InheritEnv = nil
+		for _, name := range *e.InheritEnv {
+			if name != "" {
+				svc.InheritEnv = append(svc.InheritEnv, name)
+			}
+		}
+	}
+
+	if e.InheritAll != nil && *e.InheritAll {
+		svc.InheritEnvAll = true
+	}
+
+	if e.NoInheritAll != nil && *e.NoInheritAll {
+		svc.InheritEnvAll = false
+	}
+
+	if e.ExpandEnv != nil && *e.ExpandEnv {
+		svc.NoExpandEnv = false
+	}
+
+	if e.NoExpandEnv != nil && *e.NoExpandEnv {
+		svc.NoExpandEnv = true
+	}
+
 	if e.Dependencies != nil {
 		svc.Dependencies = *e.Dependencies
 	}
 
+	if e.OptionalDeps != nil {
+		svc.OptionalDependencies = nil
+		for _, name := range *e.OptionalDeps {
+			if name != "" {
+				svc.OptionalDependencies = append(svc.OptionalDependencies, name)
+			}
+		}
+	}
+
 	if e.ServiceUser != nil {
 		svc.ServiceUser = *e.ServiceUser
+		svc.UseVirtualAccount = false
+		svc.UseGMSA = false
+	}
+
+	if e.GMSA != nil && *e.GMSA != "" {
+		svc.ServiceUser = *e.GMSA
+		svc.UseVirtualAccount = false
+		svc.UseGMSA = true
 	}
 
 	if e.Password != nil {
 		svc.Password = e.Password
 	}
 
+	if e.Privileges != nil {
+		svc.RequiredPrivileges = nil
+		for _, name := range *e.Privileges {
+			if name != "" {
+				svc.RequiredPrivileges = append(svc.RequiredPrivileges, name)
+			}
+		}
+	}
+
+	if e.ACL != nil && *e.ACL != "" {
+		svc.ServiceACL = *e.ACL
+	}
+
+	if e.UseCredMan != nil && *e.UseCredMan {
+		svc.UseCredentialManager = true
+	}
+
+	if e.NoCredMan != nil && *e.NoCredMan {
+		svc.UseCredentialManager = false
+	}
+
 	if e.StartType != nil {
 		switch *e.StartType {
 		case "manual":
@@ -331,10 +651,98 @@ func (e *EditCommand) Execute(args []string) (err error) {
 		case "disabled":
 			svc.StartType = cerberus.DisabledStartType
 		default:
-			cerberus.Logger.Fatalln("Invalid start type passed: one of (manual|autostart|delayed|disabled) is required.")
+			errLogger.Fatalln("Invalid start type passed: one of (manual|autostart|delayed|disabled) is required.")
 		}
 	}
 
+	if e.StopTimeout != nil {
+		svc.StopTimeout = *e.StopTimeout
+	}
+
+	if e.WdInterval != nil {
+		svc.WatchdogInterval = *e.WdInterval
+	}
+
+	if e.WdURL != nil {
+		svc.WatchdogURL = *e.WdURL
+	}
+
+	if e.WdCPU != nil && *e.WdCPU {
+		svc.WatchdogCPU = true
+	}
+
+	if e.NoWdCPU != nil && *e.NoWdCPU {
+		svc.WatchdogCPU = false
+	}
+
+	if e.WdThreshold != nil {
+		svc.WatchdogFailThreshold = *e.WdThreshold
+	}
+
+	if e.Priority != nil {
+		svc.Priority = parsePriority(*e.Priority)
+	}
+
+	if e.IOPriority != nil {
+		svc.IOPriority = parseIOPriority(*e.IOPriority)
+	}
+
+	if e.CPUAffinity != nil {
+		svc.CPUAffinity = parseAffinity(*e.CPUAffinity)
+	}
+
+	if e.MemoryLimit != nil {
+		svc.MemoryLimitMB = *e.MemoryLimit
+	}
+
+	if e.CPURate != nil {
+		svc.JobObject.CPURatePercent = *e.CPURate
+	}
+
+	if e.MaxProcs != nil {
+		svc.JobObject.MaxProcesses = *e.MaxProcs
+	}
+
+	if e.MaxHandles != nil {
+		svc.JobObject.MaxHandles = *e.MaxHandles
+	}
+
+	if e.KillOnClose != nil && *e.KillOnClose {
+		svc.JobObject.KillOnJobClose = true
+	}
+
+	if e.NoKillOnClose != nil && *e.NoKillOnClose {
+		svc.JobObject.KillOnJobClose = false
+	}
+
+	if e.StdinFile != nil {
+		svc.StdinFile = *e.StdinFile
+	}
+
+	if e.StdoutLog != nil {
+		svc.StdoutLog = *e.StdoutLog
+	}
+
+	if e.StderrLog != nil {
+		svc.StderrLog = *e.StderrLog
+	}
+
+	if e.LogMaxSize != nil {
+		svc.LogMaxSizeMB = *e.LogMaxSize
+	}
+
+	if e.LogBackups != nil {
+		svc.LogMaxBackups = *e.LogBackups
+	}
+
+	if e.MetricsPort != nil {
+		svc.MetricsPort = *e.MetricsPort
+	}
+
+	if e.Group != nil {
+		svc.Group = *e.Group
+	}
+
 	if e.NoSignal != nil && *e.NoSignal {
 		svc.StopSignal = cerberus.NoSignal
 	}
@@ -343,6 +751,10 @@ func (e *EditCommand) Execute(args []string) (err error) {
 		svc.StopSignal = svc.StopSignal | cerberus.CtrlCSignal
 	}
 
+	if e.SignalCtrlBrk != nil && *e.SignalCtrlBrk {
+		svc.StopSignal = svc.StopSignal | cerberus.CtrlBreakSignal
+	}
+
 	if e.SignalWmClose != nil && *e.SignalWmClose {
 		svc.StopSignal = svc.StopSignal | cerberus.WmCloseSignal
 	}
@@ -359,19 +771,66 @@ func (e *EditCommand) Execute(args []string) (err error) {
 		svc.Env = []string{}
 	}
 
+	if e.Notes != nil {
+		svc.Notes = readNotes(*e.Notes)
+	}
+
+	if e.PreStart != nil {
+		svc.PreStartCmd = *e.PreStart
+	}
+
+	if e.PreStartArg != nil {
+		svc.PreStartArgs = *e.PreStartArg
+	}
+
+	if e.PreStartTO != nil {
+		svc.PreStartTimeout = *e.PreStartTO
+	}
+
+	if e.PostStop != nil {
+		svc.PostStopCmd = *e.PostStop
+	}
+
+	if e.PostStopArg != nil {
+		svc.PostStopArgs = *e.PostStopArg
+	}
+
+	if e.PreRemove != nil {
+		svc.PreRemoveCmd = *e.PreRemove
+	}
+
+	if e.PreRemArg != nil {
+		svc.PreRemoveArgs = *e.PreRemArg
+	}
+
+	if e.NoLabels != nil && *e.NoLabels {
+		svc.Labels = map[string]string{}
+	}
+
+	if e.Labels != nil {
+		for k, v := range parseLabels(*e.Labels) {
+			if v == "" {
+				delete(svc.Labels, k)
+				continue
+			}
+			svc.Labels[k] = v
+		}
+	}
+
 	if e.NoDependencies != nil && *e.NoDependencies {
 		svc.Dependencies = []string{}
 	}
 
 	if e.UseLocalSystem != nil && *e.UseLocalSystem {
 		svc.ServiceUser = "LocalSystem"
-	}
-	fmt.Printf("%+v", *svc)
-	if err := cerberus.UpdateService(*svc); err != nil {
-		cerberus.Logger.Fatalln(err)
+		svc.UseVirtualAccount = false
+		svc.UseGMSA = false
 	}
 
-	return nil
+	if e.UseVirtual != nil && *e.UseVirtual {
+		svc.UseVirtualAccount = true
+		svc.UseGMSA = false
+	}
 }
 
 // RecoveryDelCommand delete a recovery action for an installed service..
@@ -386,12 +845,12 @@ type RecoveryDelCommand struct {
 // Execute will run the service handler.
 func (r *RecoveryDelCommand) Execute(args []string) (err error) {
 	if err := r.RootCommand.Execute(args); err != nil {
-		cerberus.Logger.Fatalln(err)
+		fatal(err)
 	}
 
 	svc, err := cerberus.LoadServiceCfg(r.Args.Name)
 	if err != nil {
-		cerberus.Logger.Fatalln(err)
+		fatal(err)
 	}
 
 	if _, ok := svc.RecoveryActions[r.Args.ExitCode]; ok {
@@ -400,7 +859,7 @@ func (r *RecoveryDelCommand) Execute(args []string) (err error) {
 
 	err = cerberus.UpdateService(*svc)
 	if err != nil {
-		cerberus.Logger.Fatalln(err)
+		fatal(err)
 	}
 
 	return nil
@@ -409,12 +868,22 @@ func (r *RecoveryDelCommand) Execute(args []string) (err error) {
 // RecoverySetCommand sets a recovery action for an installed service..
 type RecoverySetCommand struct {
 	RootCommand
-	ExitCode    int    `long:"exit-code" short:"e" description:"Exit code to handle by this action." required:"yes"`
-	Action      string `long:"action" short:"a" description:"Action to take if an error occurred. One of [run-restart|none|restart|run]" required:"yes"`
-	Delay       int    `long:"delay" short:"d" description:"Delay restart of the program in seconds." default:"0"`
-	MaxRestarts int    `long:"max-restart" short:"r" description:"Maximum restarts of the service within the specified time span. Zero means unlimited restarts." default:"0"`
-	ResetAfter  int    `long:"reset-timer" short:"c" description:"Specify the duration in seconds after which the restart counter will be cleared." default:"0"`
-	Program     string `long:"exec" short:"x" description:"Specify the program to run if an error occurred."`
+	ExitCode    int           `long:"exit-code" short:"e" description:"Exit code to handle by this action, -1 handles all exit codes without an action and -2 a process stopped by the watchdog. (ex. --exit-code=-1)" required:"yes"`
+	Action      string        `long:"action" short:"a" description:"Action to take if an error occurred. One of [run-restart|none|restart|run|webhook|webhook-restart]" required:"yes"`
+	Delay       int           `long:"delay" short:"d" description:"Delay restart of the program in seconds." default:"0"`
+	MaxRestarts int           `long:"max-restart" short:"r" description:"Maximum restarts of the service within the specified time span. Zero means unlimited restarts." default:"0"`
+	ResetAfter  int           `long:"reset-timer" short:"c" description:"Specify the duration in seconds after which the restart counter will be cleared." default:"0"`
+	Program     string        `long:"exec" short:"x" description:"Specify the program to run if an error occurred."`
+	Backoff     bool          `long:"backoff" description:"Increase the restart delay exponentially with every restart."`
+	Multiplier  float64       `long:"backoff-multiplier" description:"Multiplier for the exponential backoff." default:"2"`
+	MaxDelay    int           `long:"max-delay" description:"Maximum restart delay in seconds including jitter. Zero means no limit." default:"0"`
+	Jitter      time.Duration `long:"jitter" description:"Add a random duration up to the specified value to the restart delay. (ex. --jitter 5s)"`
+	CircuitN    int           `long:"circuit-break-after" description:"Stop the service gracefully after the number of restarts within the circuit break duration. Zero disables the circuit breaker."`
+	CircuitDur  time.Duration `long:"circuit-break-duration" description:"Time window for the circuit breaker. (ex. --circuit-break-duration 5m)"`
+	ExtraEnv    []string      `long:"recovery-env" description:"Environment variables to add for the program and the restarted executable. (ex. --recovery-env \"MODE=migrate\")"`
+	WebhookURL  string        `long:"webhook-url" description:"Specify the url to post the failure to if an error occurred."`
+	WebhookTO   time.Duration `long:"webhook-timeout" description:"Timeout for the webhook request. (default: 10s)"`
+	Insecure    bool          `long:"webhook-insecure" description:"Don't verify the TLS certificate of the webhook url."`
 	Args        struct {
 		Name      string   `positional-arg-name:"SERVICE_NAME" description:"Name of the service to set a recovery action."`
 		Arguments []string `positional-arg-name:"ARGUMENTS" description:"Arguments for the program to run if an error occurred. Use '--' after SERVICE_NAME to specify arguments starting with '-'."`
@@ -424,12 +893,12 @@ type RecoverySetCommand struct {
 // Execute will run the service handler.
 func (r *RecoverySetCommand) Execute(args []string) (err error) {
 	if err := r.RootCommand.Execute(args); err != nil {
-		cerberus.Logger.Fatalln(err)
+		fatal(err)
 	}
 
 	svc, err := cerberus.LoadServiceCfg(r.Args.Name)
 	if err != nil {
-		cerberus.Logger.Fatalln(err)
+		fatal(err)
 	}
 
 	action := cerberus.SvcRecoveryAction{
@@ -439,6 +908,19 @@ func (r *RecoverySetCommand) Execute(args []string) (err error) {
 		MaxRestarts: r.MaxRestarts,
 		ResetAfter:  time.Second * time.Duration(r.ResetAfter),
 		Program:     r.Program,
+		ExtraEnv:    r.ExtraEnv,
+
+		ExponentialBackoff: r.Backoff,
+		BackoffMultiplier:  r.Multiplier,
+		MaxDelay:           r.MaxDelay,
+		Jitter:             r.Jitter,
+
+		CircuitBreakAfter:    r.CircuitN,
+		CircuitBreakDuration: r.CircuitDur,
+
+		WebhookURL:      r.WebhookURL,
+		WebhookTimeout:  r.WebhookTO,
+		WebhookInsecure: r.Insecure,
 	}
 
 	switch r.Action {
@@ -450,14 +932,18 @@ func (r *RecoverySetCommand) Execute(args []string) (err error) {
 		action.Action = cerberus.RestartAction
 	case "run-restart":
 		action.Action = cerberus.RunAndRestartAction
+	case "webhook":
+		action.Action = cerberus.WebhookAction
+	case "webhook-restart":
+		action.Action = cerberus.WebhookAction | cerberus.RestartAction
 	default:
-		cerberus.Logger.Fatalln("Invalid recovery action passed: one of (run|restart|none|run-restart) is required.")
+		errLogger.Fatalln("Invalid recovery action passed: one of (run|restart|none|run-restart|webhook|webhook-restart) is required.")
 	}
 
 	svc.RecoveryActions[action.ExitCode] = action
 
 	if err := cerberus.UpdateService(*svc); err != nil {
-		cerberus.Logger.Fatalln(err)
+		fatal(err)
 	}
 
 	return nil
@@ -487,6 +973,92 @@ func concatArgs(args []string) string {
 	return strings.Join(args, " ")
 }
 
+func parsePriority(priority string) cerberus.ProcessPriority {
+	if priority == "inherit" {
+		return cerberus.InheritPriority
+	}
+
+	for k, v := range priorityMapping {
+		if v == priority {
+			return k
+		}
+	}
+
+	errLogger.Fatalln("Invalid priority passed: one of (normal|below-normal|above-normal|realtime) is required.")
+	return cerberus.InheritPriority
+}
+
+func parseIOPriority(priority string) cerberus.IOPriority {
+	if priority == "inherit" {
+		return cerberus.IOPriorityInherit
+	}
+
+	for k, v := range ioPriorityMapping {
+		if v == priority {
+			return k
+		}
+	}
+
+	errLogger.Fatalln("Invalid i/o priority passed: one of (very-low|low|normal) is required.")
+	return cerberus.IOPriorityInherit
+}
+
+// readNotes returns the notes or if prefixed with '@' the content of the referenced file.
+func readNotes(notes string) string {
+	if !strings.HasPrefix(notes, "@") {
+		return notes
+	}
+
+	data, err := ioutil.ReadFile(notes[1:])
+	if err != nil {
+		errLogger.Fatalln("Failed to read notes:", err)
+	}
+	return strings.TrimRightFunc(string(data), unicode.IsSpace)
+}
+
+func parseLabels(labels []string) map[string]string {
+	m := map[string]string{}
+	for _, l := range labels {
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			errLogger.Fatalf("Invalid label passed '%v': key=value is required.\n", l)
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m
+}
+
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+// matchLabels reports whether the labels contain all filters, a filter
+// is either a key which must be present or a key=value pair which must match.
+func matchLabels(labels map[string]string, filters []string) bool {
+	for _, f := range filters {
+		kv := strings.SplitN(f, "=", 2)
+		v, ok := labels[kv[0]]
+		if !ok || (len(kv) == 2 && v != kv[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseAffinity(mask string) uint64 {
+	m := strings.TrimPrefix(strings.ToLower(mask), "0x")
+	v, err := strconv.ParseUint(m, 16, 64)
+	if err != nil {
+		errLogger.Fatalln("Invalid cpu affinity passed: a hex mask is required (ex. 0x3).")
+	}
+	return v
+}
+
 func mapAction(action cerberus.RecoveryAction) string {
 	switch action {
 	case cerberus.NoAction:
@@ -497,6 +1069,10 @@ func mapAction(action cerberus.RecoveryAction) string {
 		return "restart"
 	case cerberus.RunAndRestartAction:
 		return "run-restart"
+	case cerberus.WebhookAction:
+		return "webhook"
+	case cerberus.WebhookAction | cerberus.RestartAction:
+		return "webhook-restart"
 	default:
 		return ""
 	}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// MigrateCommand upgrades all stored service configurations to the current schema version.
+type MigrateCommand struct {
+	RootCommand
+}
+
+// Execute will migrate all service configurations without touching the services themselves.
+// The args parameter is not used and is only to fullfil the go-flags commander interface.
+func (m *MigrateCommand) Execute(args []string) error {
+	if err := m.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	results, err := cerberus.MigrateServices()
+	if err != nil {
+		fatal(err)
+	}
+
+	if len(results) == 0 {
+		cerberus.Logger.Printf("All services are up to date (schema version %v).\n", cerberus.CurrentSchemaVersion)
+		return nil
+	}
+
+	fmt.Printf("\nMigration results:\n")
+	fmt.Println(strings.Repeat("-", 80))
+
+	failed := false
+	p := keyValuePrinter{indentSize: 5}
+	for _, r := range results {
+		if r.Err != nil {
+			p.printlnColor(r.Name, r.Err, colorRed)
+			failed = true
+			continue
+		}
+		p.printlnColor(r.Name, fmt.Sprintf("migrated from version %v to %v", r.FromVersion, r.ToVersion), colorGreen)
+	}
+	p.writeTo(os.Stdout)
+
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -13,6 +13,7 @@ type keyValuePrinter struct {
 		indent int
 		key    string
 		value  interface{}
+		color  string
 	}
 	maxKeys map[int]int
 }
@@ -28,15 +29,22 @@ func (p *keyValuePrinter) indent() {
 }
 
 func (p *keyValuePrinter) println(key string, value interface{}) {
+	p.printlnColor(key, value, "")
+}
+
+// printlnColor adds an item whose value is colorized if colors are enabled.
+func (p *keyValuePrinter) printlnColor(key string, value interface{}, color string) {
 	p.updateKey(key)
 	p.items = append(p.items, struct {
 		indent int
 		key    string
 		value  interface{}
+		color  string
 	}{
 		indent: p.ci,
 		key:    key,
 		value:  value,
+		color:  color,
 	})
 }
 
@@ -65,7 +73,10 @@ func (p *keyValuePrinter) writeTo(writer io.Writer) {
 			fmt.Fprintf(writer, "%v\n", item.key)
 			continue
 		}
-		fmt.Fprintf(writer, "%v : %v\n", item.key+strings.Repeat(" ", n), item.value)
+		value := fmt.Sprint(item.value)
+		// Align multi-line values with the first line.
+		value = strings.Replace(value, "\n", "\n"+strings.Repeat(" ", item.indent*p.indentSize+p.maxKeys[item.indent]+3), -1)
+		fmt.Fprintf(writer, "%v : %v\n", item.key+strings.Repeat(" ", n), colorize(item.color, value))
 	}
 
 	p.ci = 0
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// RestoreCommand reinstalls all services from a backup file.
+type RestoreCommand struct {
+	RootCommand
+	Overwrite bool `long:"overwrite" description:"Update existing services instead of skipping them."`
+	DryRun    bool `long:"dry-run" short:"n" description:"Only validate the configurations, nothing is installed or updated."`
+	Args      struct {
+		File string `positional-arg-name:"FILE" description:"Backup file created by the backup command." required:"yes"`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will restore all services from the backup. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (r *RestoreCommand) Execute(args []string) error {
+	if err := r.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(r.Args.File)
+	if err != nil {
+		fatal(err)
+	}
+
+	backup, err := cerberus.ImportBackup(data)
+	if err != nil {
+		fatal(err)
+	}
+
+	if backup.Version != "" {
+		cerberus.Logger.Printf("Restoring backup of cerberus %v from %v...\n", backup.Version, backup.Timestamp.Format("2006-01-02 15:04:05"))
+	}
+
+	results := applyConfigs(backup.Services, r.Overwrite, r.DryRun)
+	printResults("Restore summary", results, r.DryRun)
+	if hasFailures(results) {
+		os.Exit(1)
+	}
+	return nil
+}
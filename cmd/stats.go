@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// StatsCommand shows the operational metrics of a service.
+type StatsCommand struct {
+	RootCommand
+	Args struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service." required:"yes"`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will print the metrics of the service. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (s *StatsCommand) Execute(args []string) error {
+	if err := s.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	stats, err := cerberus.GetServiceStats(s.Args.Name)
+	if err != nil {
+		fatal(err)
+	}
+
+	p := keyValuePrinter{indentSize: 5}
+	p.printlnColor("Name", stats.Name, colorBold)
+	p.printlnColor("Status", stats.State, stateColor(stats.State))
+	p.println("Restarts", stats.RestartCount)
+	p.println("Last Restart", formatTime(stats.LastRestart))
+	p.println("First Start", formatTime(stats.FirstStart))
+	p.println("Last Start", formatTime(stats.LastStart))
+	p.println("Total Runtime", stats.TotalRuntime.Round(time.Second))
+
+	metrics, err := cerberus.GetProcessMetrics(s.Args.Name)
+	if err != nil {
+		fatal(err)
+	}
+	if metrics.Running() {
+		p.println("PID", metrics.PID)
+		p.println("Uptime", time.Since(metrics.StartTime).Round(time.Second))
+		p.println("CPU Time", fmt.Sprintf("%v (user %v, kernel %v)", metrics.CPUTime().Round(time.Millisecond),
+			metrics.UserTime.Round(time.Millisecond), metrics.KernelTime.Round(time.Millisecond)))
+		p.println("Working Set", formatBytes(metrics.WorkingSet))
+		p.println("Peak Working Set", formatBytes(metrics.PeakWorkingSet))
+		p.println("Handles", metrics.HandleCount)
+	} else {
+		p.println("Process", "not running, no live metrics available")
+	}
+	p.writeTo(os.Stdout)
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func formatBytes(n uint64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/1024/1024)
+}
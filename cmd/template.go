@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// TemplateSaveCommand saves the configuration of a service as template.
+type TemplateSaveCommand struct {
+	RootCommand
+	Args struct {
+		Name     string `positional-arg-name:"SERVICE_NAME" description:"Name of the service to save as template."`
+		Template string `positional-arg-name:"TEMPLATE_NAME" description:"Name of the template. (default: SERVICE_NAME)"`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will save the service as template. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (t *TemplateSaveCommand) Execute(args []string) error {
+	if err := t.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	template := t.Args.Template
+	if template == "" {
+		template = t.Args.Name
+	}
+
+	if err := cerberus.SaveTemplate(template, t.Args.Name); err != nil {
+		fatal(err)
+	}
+
+	cerberus.Logf(cerberus.Logger, "Saved service %v as template %v\n", cerberus.Field("service", t.Args.Name), cerberus.Field("template", template))
+	return nil
+}
+
+// TemplateListCommand shows all saved templates.
+type TemplateListCommand struct {
+	RootCommand
+}
+
+// Execute will print the names of all templates. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (t *TemplateListCommand) Execute(args []string) error {
+	if err := t.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	templates, err := cerberus.ListTemplates()
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("\nCerberus templates:\n")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, t := range templates {
+		fmt.Println(t)
+	}
+	return nil
+}
+
+// TemplateDelCommand removes a saved template.
+type TemplateDelCommand struct {
+	RootCommand
+	Args struct {
+		Template string `positional-arg-name:"TEMPLATE_NAME" description:"Name of the template to remove."`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will remove the template. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (t *TemplateDelCommand) Execute(args []string) error {
+	if err := t.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	if err := cerberus.RemoveTemplate(t.Args.Template); err != nil {
+		fatal(err)
+	}
+	return nil
+}
+
+// TemplateApplyCommand installs a service from a template.
+type TemplateApplyCommand struct {
+	RootCommand
+	editFlags
+	Vars []string `long:"var" description:"Value for a {{variable}} placeholder of the template. (ex. --var port=8080)"`
+	Args struct {
+		Template string `positional-arg-name:"TEMPLATE_NAME" description:"Name of the template."`
+		Name     string `positional-arg-name:"SERVICE_NAME" description:"Name of the new service."`
+	} `positional-args:"yes" required:"2"`
+}
+
+// Execute will install a service from the template and apply the passed flags to it.
+// The args parameter is not used and is only to fullfil the go-flags commander interface.
+func (t *TemplateApplyCommand) Execute(args []string) error {
+	if err := t.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	vars := map[string]string{}
+	for _, v := range t.Vars {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			errLogger.Fatalf("Invalid variable passed '%v': key=value is required.\n", v)
+		}
+		vars[kv[0]] = kv[1]
+	}
+
+	svc, err := cerberus.ApplyTemplate(t.Args.Template, t.Args.Name, vars, t.apply)
+	if err != nil {
+		fatal(err)
+	}
+
+	state, err := cerberus.GetServiceStatus(svc.Name)
+	if err != nil {
+		cerberus.DebugLogger.Println("failed to get status of", svc.Name, ":", err)
+	}
+
+	p := keyValuePrinter{indentSize: 5}
+	printService(&p, svc, state)
+	p.writeTo(os.Stdout)
+	return nil
+}
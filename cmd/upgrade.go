@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// UpgradeCommand replaces the executable of an installed service.
+type UpgradeCommand struct {
+	RootCommand
+	ExePath   string `long:"executable" short:"x" description:"Path to the new executable." required:"yes"`
+	NoRestart bool   `long:"no-restart" description:"Don't start the service after the upgrade."`
+	BackupOld string `long:"backup-old" description:"Copy the previous executable to the given path before replacing it."`
+	Args      struct {
+		Name string `positional-arg-name:"SERVICE_NAME" description:"Name of the service to upgrade." required:"yes"`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will stop the service, replace the executable and start the service again.
+// The args parameter is not used and is only to fullfil the go-flags commander interface.
+func (u *UpgradeCommand) Execute(args []string) error {
+	if err := u.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	svc, err := cerberus.LoadServiceCfg(u.Args.Name)
+	if err != nil {
+		fatal(err)
+	}
+
+	exePath, err := filepath.Abs(u.ExePath)
+	if err != nil {
+		fatal(err)
+	}
+	if fi, err := os.Stat(exePath); err != nil || fi.IsDir() {
+		errLogger.Fatalf("Executable %v isn't a binary file\n", exePath)
+	}
+
+	if err := cerberus.StopService(svc.Name, 0); err != nil {
+		fatal(err)
+	}
+
+	if u.BackupOld != "" {
+		cerberus.Logger.Printf("Copying %v to %v...\n", svc.ExePath, u.BackupOld)
+		if err := copyFile(svc.ExePath, u.BackupOld); err != nil {
+			fatal(err)
+		}
+	}
+
+	// Only the configured executable changes, the SCM still runs cerberus.
+	svc.ExePath = exePath
+	if err := cerberus.UpdateService(*svc); err != nil {
+		fatal(err)
+	}
+
+	if u.NoRestart {
+		return nil
+	}
+
+	if err := cerberus.StartService(svc.Name); err != nil {
+		fatal(err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/go-sharp/cerberus/v2"
+)
+
+// ValidateCommand validates service configurations from a JSON file.
+type ValidateCommand struct {
+	RootCommand
+	SkipDeps bool `long:"skip-dependencies" description:"Don't require the dependencies to be installed on this machine."`
+	AllowUNC bool `long:"allow-unc-paths" description:"Don't require executables on a network share (\\\\server\\share) to be reachable."`
+	Args     struct {
+		File string `positional-arg-name:"FILE" description:"JSON file with one or more service configurations." required:"yes"`
+	} `positional-args:"yes" required:"1"`
+}
+
+// Execute will validate all configurations in the given file and exits with
+// a non-zero exit code if any of them is invalid. The args parameter is not used
+// and is only to fullfil the go-flags commander interface.
+func (v *ValidateCommand) Execute(args []string) error {
+	if err := v.RootCommand.Execute(args); err != nil {
+		fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(v.Args.File)
+	if err != nil {
+		fatal(err)
+	}
+
+	svcs, err := cerberus.ImportConfig(data)
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("\nValidation results:\n")
+	fmt.Println(strings.Repeat("-", 80))
+
+	valid := true
+	p := keyValuePrinter{indentSize: 5}
+	for i, svc := range svcs {
+		name := svc.Name
+		if name == "" {
+			name = fmt.Sprintf("#%v", i+1)
+		}
+
+		opts := cerberus.ValidateConfigOptions{SkipDependencies: v.SkipDeps, AllowUNCPaths: v.AllowUNC}
+		if err := cerberus.ValidateConfigWithOptions(*svc, opts); err != nil {
+			p.printlnColor(name, err, colorRed)
+			valid = false
+			continue
+		}
+		p.printlnColor(name, "valid", colorGreen)
+	}
+	p.writeTo(os.Stdout)
+
+	if !valid {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,449 @@
+package cerberus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sharp/windows/pkg/ps"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+)
+
+// DefaultStartTimeout is the default time to wait for a service to start.
+const DefaultStartTimeout = 30 * time.Second
+
+// ServiceState is the current state of a service as reported by the SCM.
+type ServiceState uint32
+
+// Service states mirroring the SCM states.
+const (
+	UnknownState         ServiceState = 0
+	StoppedState                      = ServiceState(svc.Stopped)
+	StartPendingState                 = ServiceState(svc.StartPending)
+	StopPendingState                  = ServiceState(svc.StopPending)
+	RunningState                      = ServiceState(svc.Running)
+	ContinuePendingState              = ServiceState(svc.ContinuePending)
+	PausePendingState                 = ServiceState(svc.PausePending)
+	PausedState                       = ServiceState(svc.Paused)
+)
+
+func (s ServiceState) String() string {
+	switch s {
+	case StoppedState:
+		return "Stopped"
+	case StartPendingState:
+		return "StartPending"
+	case StopPendingState:
+		return "StopPending"
+	case RunningState:
+		return "Running"
+	case ContinuePendingState:
+		return "ContinuePending"
+	case PausePendingState:
+		return "PausePending"
+	case PausedState:
+		return "Paused"
+	default:
+		return "Unknown"
+	}
+}
+
+// GetServiceStatus returns the current state of the service with the given name.
+func GetServiceStatus(name string) (ServiceState, error) {
+	return defaultManager.GetServiceStatus(name)
+}
+
+// GetServiceStatus returns the current state of the service like the package level GetServiceStatus.
+func (m *Manager) GetServiceStatus(name string) (ServiceState, error) {
+	DebugLogger.Println("Open connection to service control manager...")
+	manager, err := m.connect()
+	if err != nil {
+		return UnknownState, err
+	}
+	defer manager.Disconnect()
+
+	return getServiceStatus(manager, name)
+}
+
+func getServiceStatus(manager SCMClient, name string) (ServiceState, error) {
+	status, err := queryService(manager, name)
+	return ServiceState(status.State), err
+}
+
+// GetServicePID returns the process id of the service with the given name,
+// zero means the service is not running.
+func GetServicePID(name string) (uint32, error) {
+	return defaultManager.GetServicePID(name)
+}
+
+// GetServicePID returns the process id of the service like the package level GetServicePID.
+func (m *Manager) GetServicePID(name string) (uint32, error) {
+	DebugLogger.Println("Open connection to service control manager...")
+	manager, err := m.connect()
+	if err != nil {
+		return 0, err
+	}
+	defer manager.Disconnect()
+
+	status, err := queryService(manager, name)
+	return status.ProcessId, err
+}
+
+func queryService(manager SCMClient, name string) (svc.Status, error) {
+	s, err := manager.OpenService(name)
+	if err == windows.ERROR_SERVICE_DOES_NOT_EXIST {
+		return svc.Status{}, newError(ErrNotInstalled, "service %v is not installed", name)
+	} else if err != nil {
+		return svc.Status{}, newErrorW(ErrGeneric, "failed to open service %v", err, name)
+	}
+	defer s.Close()
+
+	status, err := s.Query()
+	if err != nil {
+		return svc.Status{}, newErrorW(ErrGeneric, "failed to query service %v", err, name)
+	}
+
+	return status, nil
+}
+
+// GetServicesStatus returns the current state of all services with the given names
+// using a single connection to the SCM. Services which can't be queried are reported
+// with UnknownState.
+func GetServicesStatus(names []string) (map[string]ServiceState, error) {
+	return defaultManager.GetServicesStatus(names)
+}
+
+// GetServicesStatus returns the current state of the services like the package level GetServicesStatus.
+func (m *Manager) GetServicesStatus(names []string) (map[string]ServiceState, error) {
+	DebugLogger.Println("Open connection to service control manager...")
+	manager, err := m.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer manager.Disconnect()
+
+	states := make(map[string]ServiceState, len(names))
+	for _, name := range names {
+		state, err := getServiceStatus(manager, name)
+		if err != nil {
+			DebugLogger.Println("failed to get status of", name, ":", err)
+		}
+		states[name] = state
+	}
+
+	return states, nil
+}
+
+// StartService starts the service with the given name and waits
+// until it is running or the DefaultStartTimeout expired.
+func StartService(name string) error {
+	return StartServiceTimeout(name, DefaultStartTimeout)
+}
+
+// StartServiceTimeout starts the service with the given name and waits
+// until it is running or the timeout expired.
+func StartServiceTimeout(name string, timeout time.Duration) error {
+	return defaultManager.StartService(name, timeout)
+}
+
+// StartService starts the service and waits until it is running like StartServiceTimeout.
+func (m *Manager) StartService(name string, timeout time.Duration) error {
+	DebugLogger.Println("Open connection to service control manager...")
+	manager, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer manager.Disconnect()
+
+	return startService(manager, name, timeout)
+}
+
+// StartServiceWithDependencies starts the dependencies of the service with the given name recursively,
+// dependencies first, and waits up to depTimeout for each of them to run before the service itself
+// is started. If a dependency doesn't run within depTimeout, an error with ErrTimeout is returned.
+func StartServiceWithDependencies(name string, timeout, depTimeout time.Duration) error {
+	return defaultManager.StartServiceWithDependencies(name, timeout, depTimeout)
+}
+
+// StartServiceWithDependencies starts the service and its dependencies like the package level
+// StartServiceWithDependencies.
+func (m *Manager) StartServiceWithDependencies(name string, timeout, depTimeout time.Duration) error {
+	DebugLogger.Println("Open connection to service control manager...")
+	manager, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer manager.Disconnect()
+
+	started := map[string]bool{strings.ToLower(name): true}
+	if err := startDependencies(manager, name, depTimeout, started); err != nil {
+		return err
+	}
+	return startService(manager, name, timeout)
+}
+
+// startDependencies starts the dependencies of the service in dependency order, started contains the
+// services already handled, so shared dependencies are started once and cycles don't recurse forever.
+func startDependencies(manager SCMClient, name string, timeout time.Duration, started map[string]bool) error {
+	s, err := manager.OpenService(name)
+	if err != nil {
+		return newErrorW(ErrStartService, "failed to open service %v", err, name)
+	}
+	cfg, err := s.Config()
+	s.Close()
+	if err != nil {
+		return newErrorW(ErrStartService, "failed to get configuration of service %v", err, name)
+	}
+
+	for _, dep := range cfg.Dependencies {
+		// Load order groups (+<group>) can't be started.
+		if strings.HasPrefix(dep, "+") || started[strings.ToLower(dep)] {
+			continue
+		}
+		started[strings.ToLower(dep)] = true
+
+		if err := startDependencies(manager, dep, timeout, started); err != nil {
+			return err
+		}
+
+		Logf(Logger, "Starting dependency %v of service %v...\n", Field("dependency", dep), Field("service", name))
+		if err := startService(manager, dep, timeout); err != nil && !errors.Is(err, ErrAlreadyRunning) {
+			return err
+		}
+	}
+	return nil
+}
+
+func startService(manager SCMClient, name string, timeout time.Duration) error {
+	Logf(DebugLogger, "Open service %v...\n", Field("service", name))
+	s, err := manager.OpenService(name)
+	if err != nil {
+		return newErrorW(ErrStartService, "failed to open service %v", err, name)
+	}
+	defer s.Close()
+
+	status, err := s.Query()
+	if err != nil {
+		return newErrorW(ErrStartService, "failed to query service %v", err, name)
+	}
+	if status.State == svc.Running {
+		return newError(ErrAlreadyRunning, "service %v is already running", name)
+	}
+
+	Logf(Logger, "Starting service %v...\n", Field("service", name))
+	if err := s.Start(); err != nil {
+		return newErrorW(ErrStartService, "failed to start service %v", err, name)
+	}
+
+	return waitForState(s, svc.Running, timeout)
+}
+
+// StopService stops the service with the given name and waits until it is stopped
+// or the timeout expired. A zero timeout uses the configured StopTimeout of the service.
+func StopService(name string, timeout time.Duration) error {
+	return defaultManager.StopService(name, timeout)
+}
+
+// StopService stops the service and waits until it is stopped like the package level StopService.
+func (m *Manager) StopService(name string, timeout time.Duration) error {
+	return m.stopService(name, timeout, false)
+}
+
+// KillService kills the process tree of the service with the given name without
+// sending any signals and waits until it is stopped or the timeout expired.
+// A zero timeout uses the configured StopTimeout of the service. Services on a remote
+// computer (see SetComputer) can't be killed.
+func KillService(name string, timeout time.Duration) error {
+	return defaultManager.KillService(name, timeout)
+}
+
+// KillService kills the process tree of the service and waits until it is stopped like
+// the package level KillService.
+func (m *Manager) KillService(name string, timeout time.Duration) error {
+	if scmComputer != "" {
+		return newError(ErrStopService, "services on a remote computer can't be killed")
+	}
+	return m.stopService(name, timeout, true)
+}
+
+func (m *Manager) stopService(name string, timeout time.Duration, force bool) error {
+	if timeout == 0 {
+		timeout = DefaultStopTimeout
+		if config, err := m.LoadServiceCfg(name); err == nil {
+			timeout = config.stopTimeout()
+		}
+	}
+
+	DebugLogger.Println("Open connection to service control manager...")
+	manager, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer manager.Disconnect()
+
+	Logf(DebugLogger, "Open service %v...\n", Field("service", name))
+	s, err := manager.OpenService(name)
+	if err != nil {
+		return newErrorW(ErrStopService, "failed to open service %v", err, name)
+	}
+	defer s.Close()
+
+	status, err := s.Query()
+	if err != nil {
+		return newErrorW(ErrStopService, "failed to query service %v", err, name)
+	}
+	if status.State == svc.Stopped {
+		Logf(Logger, "Service %v is already stopped\n", Field("service", name))
+		return nil
+	}
+
+	if force {
+		Logf(Logger, "Killing service %v...\n", Field("service", name))
+		if err := ps.KillChildProcesses(status.ProcessId, true); err != nil {
+			return newErrorW(ErrStopService, "failed to kill service %v", err, name)
+		}
+	} else {
+		Logf(Logger, "Stopping service %v...\n", Field("service", name))
+		if _, err := s.Control(svc.Stop); err != nil {
+			return newErrorW(ErrStopService, "failed to stop service %v", err, name)
+		}
+	}
+
+	return waitForState(s, svc.Stopped, timeout)
+}
+
+// killServiceProcess kills the process tree of the service if it isn't stopped, without waiting for it.
+func killServiceProcess(s SCMService) error {
+	if scmComputer != "" {
+		return newError(ErrStopService, "services on a remote computer can't be killed")
+	}
+
+	status, err := s.Query()
+	if err != nil {
+		return err
+	}
+	if status.State == svc.Stopped || status.ProcessId == 0 {
+		return nil
+	}
+	return ps.KillChildProcesses(status.ProcessId, true)
+}
+
+// waitForState polls the service until it reaches the given state or the timeout expired.
+// Every state transition is logged.
+func waitForState(s SCMService, state svc.State, timeout time.Duration) error {
+	return waitForStateContext(context.Background(), s, state, timeout)
+}
+
+// waitForStateContext is like waitForState, but returns early if the context is done.
+func waitForStateContext(ctx context.Context, s SCMService, state svc.State, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	last := UnknownState
+	for {
+		status, err := s.Query()
+		if err != nil {
+			return newErrorW(ErrGeneric, "failed to query service %v", err, s.Name())
+		}
+
+		if current := ServiceState(status.State); current != last {
+			Logf(Logger, "Service %v is %v\n", Field("service", s.Name()), Field("state", current))
+			last = current
+		}
+
+		if status.State == state {
+			return nil
+		}
+
+		// A service which stopped while starting won't reach the running state anymore.
+		if state == svc.Running && status.State == svc.Stopped {
+			return newError(ErrStartService, "service %v stopped unexpectedly", s.Name())
+		}
+
+		if time.Now().After(deadline) {
+			return newError(ErrTimeout, "timed out waiting for service %v to be %v, current state: %v",
+				s.Name(), ServiceState(state), ServiceState(status.State))
+		}
+
+		select {
+		case <-ctx.Done():
+			return newErrorW(ErrTimeout, "cancelled waiting for service %v to be %v", ctx.Err(), s.Name(), ServiceState(state))
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// checkContext returns an error with ErrTimeout wrapping ctx.Err() if the context is done,
+// the message describes the cancelled operation.
+func checkContext(ctx context.Context, operation string, args ...interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return newErrorW(ErrTimeout, "cancelled "+operation, err, args...)
+	}
+	return nil
+}
+
+// EnableService sets the start type of a disabled service and returns the previous start type.
+// If startType is zero, the start type before the service was disabled is restored, disabled
+// services without a saved start type are configured for manual startup and other services are unchanged.
+func EnableService(name string, startType StartType) (StartType, error) {
+	return defaultManager.EnableService(name, startType)
+}
+
+// EnableService sets the start type of a disabled service like the package level EnableService.
+func (m *Manager) EnableService(name string, startType StartType) (StartType, error) {
+	DebugLogger.Println("Loading configuration...")
+	cfg, err := m.LoadServiceCfg(name)
+	if err != nil {
+		return 0, err
+	}
+
+	old := cfg.StartType
+	if startType == 0 {
+		// A service which isn't disabled keeps its start type.
+		if old != DisabledStartType {
+			return old, nil
+		}
+		startType = cfg.PreviousStartType
+	}
+	if startType == 0 || startType == DisabledStartType {
+		startType = ManualStartType
+	}
+
+	cfg.StartType = startType
+	cfg.PreviousStartType = 0
+	DebugLogger.Println("Write service configuration...")
+	if err := m.saveServiceCfg(*cfg); err != nil {
+		return old, err
+	}
+
+	return old, nil
+}
+
+// DisableService disables the service and returns the previous start type,
+// which will be restored by EnableService.
+func DisableService(name string) (StartType, error) {
+	return defaultManager.DisableService(name)
+}
+
+// DisableService disables the service like the package level DisableService.
+func (m *Manager) DisableService(name string) (StartType, error) {
+	DebugLogger.Println("Loading configuration...")
+	cfg, err := m.LoadServiceCfg(name)
+	if err != nil {
+		return 0, err
+	}
+
+	old := cfg.StartType
+	if old == DisabledStartType {
+		return old, nil
+	}
+
+	cfg.PreviousStartType = old
+	cfg.StartType = DisabledStartType
+	DebugLogger.Println("Write service configuration...")
+	if err := m.saveServiceCfg(*cfg); err != nil {
+		return old, err
+	}
+
+	return old, nil
+}
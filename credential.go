@@ -0,0 +1,115 @@
+package cerberus
+
+import (
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procCredReadW   = advapi32.NewProc("CredReadW")
+	procCredWriteW  = advapi32.NewProc("CredWriteW")
+	procCredDeleteW = advapi32.NewProc("CredDeleteW")
+	procCredFree    = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+)
+
+// credential mirrors the CREDENTIALW structure.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// CredentialTarget returns the target name of the credential of the service in the Windows Credential Manager.
+func CredentialTarget(name string) string {
+	return "cerberus/" + name
+}
+
+// SetServiceCredential stores the password of the service user in the Windows Credential Manager.
+// The credential manager is private to the user running cerberus, so the same account has to install
+// and edit the service. If the service is installed and uses the credential manager, the password of
+// the service is updated as well.
+func SetServiceCredential(name, password string) error {
+	if err := writeCredential(CredentialTarget(name), password); err != nil {
+		return err
+	}
+
+	cfg, err := LoadServiceCfg(name)
+	if err != nil || !cfg.UseCredentialManager {
+		return nil
+	}
+
+	Logf(Logger, "Updating password of service %v...\n", Field("service", name))
+	return defaultManager.updateSCMProperties(cfg)
+}
+
+// DeleteServiceCredential removes the password of the service user from the Windows Credential Manager.
+func DeleteServiceCredential(name string) error {
+	target, err := windows.UTF16PtrFromString(CredentialTarget(name))
+	if err != nil {
+		return newErrorW(ErrGeneric, "invalid service name %v", err, name)
+	}
+
+	if r, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0); r == 0 {
+		return newErrorW(ErrGeneric, "failed to delete credential of service %v", err, name)
+	}
+	return nil
+}
+
+func writeCredential(target, password string) error {
+	targetPtr, err := windows.UTF16PtrFromString(target)
+	if err != nil {
+		return newErrorW(ErrGeneric, "invalid credential target %v", err, target)
+	}
+
+	// The password is stored without the terminating null character.
+	blob := utf16.Encode([]rune(password))
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         targetPtr,
+		CredentialBlobSize: uint32(len(blob) * 2),
+		Persist:            credPersistLocalMachine,
+	}
+	if len(blob) > 0 {
+		cred.CredentialBlob = (*byte)(unsafe.Pointer(&blob[0]))
+	}
+
+	if r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); r == 0 {
+		return newErrorW(ErrGeneric, "failed to write credential %v", err, target)
+	}
+	return nil
+}
+
+func readCredential(target string) (string, error) {
+	targetPtr, err := windows.UTF16PtrFromString(target)
+	if err != nil {
+		return "", newErrorW(ErrGeneric, "invalid credential target %v", err, target)
+	}
+
+	var cred *credential
+	if r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(targetPtr)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); r == 0 {
+		return "", newErrorW(ErrGeneric, "failed to read credential %v", err, target)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+	blob := unsafe.Slice((*uint16)(unsafe.Pointer(cred.CredentialBlob)), cred.CredentialBlobSize/2)
+	return string(utf16.Decode(blob)), nil
+}
@@ -0,0 +1,150 @@
+package cerberus
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadEnvFile reads a dotenv file and returns the variables as KEY=VALUE pairs.
+// Lines can be prefixed with 'export', comments start with '#' and ${VAR}
+// references are expanded with previously defined or environment variables.
+func loadEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars := map[string]string{}
+	lookup := func(key string) string {
+		if v, ok := vars[key]; ok {
+			return v
+		}
+		return os.Getenv(key)
+	}
+
+	var env []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		idx := strings.Index(line, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid line %v in env file '%v'", n, path)
+		}
+
+		key := strings.TrimSpace(line[:idx])
+		value := strings.TrimSpace(line[idx+1:])
+		if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			// Single quoted values are taken literally.
+			value = value[1 : len(value)-1]
+		} else {
+			if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+				value = value[1 : len(value)-1]
+			}
+			value = os.Expand(value, lookup)
+		}
+
+		vars[key] = value
+		env = append(env, key+"="+value)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// DefaultInheritedEnv are the host environment variables passed to the executable if
+// neither InheritEnv nor InheritEnvAll is configured, most programs don't work without them.
+var DefaultInheritedEnv = []string{
+	"ALLUSERSPROFILE", "APPDATA", "COMPUTERNAME", "ComSpec", "CommonProgramFiles", "LOCALAPPDATA",
+	"NUMBER_OF_PROCESSORS", "OS", "PATH", "PATHEXT", "PROCESSOR_ARCHITECTURE", "ProgramData",
+	"ProgramFiles", "ProgramFiles(x86)", "PUBLIC", "SystemDrive", "SystemRoot", "TEMP", "TMP",
+	"USERDOMAIN", "USERNAME", "USERPROFILE", "windir",
+}
+
+// inheritedEnv returns the variables of the host environment, which are passed to the executable.
+func inheritedEnv(cfg SvcConfig) []string {
+	if cfg.InheritEnvAll {
+		return os.Environ()
+	}
+
+	names := cfg.InheritEnv
+	if len(names) == 0 {
+		names = DefaultInheritedEnv
+	}
+
+	host := os.Environ()
+	var env []string
+	for _, name := range names {
+		// Environment variable names are case insensitive on windows.
+		for _, kv := range host {
+			if idx := strings.Index(kv, "="); idx > 0 && strings.EqualFold(kv[:idx], name) {
+				env = append(env, kv)
+				break
+			}
+		}
+	}
+	return env
+}
+
+// expand expands the ${VAR} references of the value with the environment, unless the expansion
+// is disabled with NoExpandEnv.
+func (cfg *SvcConfig) expand(value string) string {
+	if cfg.NoExpandEnv {
+		return value
+	}
+	return os.ExpandEnv(value)
+}
+
+func (cfg *SvcConfig) expandAll(values []string) []string {
+	if cfg.NoExpandEnv || values == nil {
+		return values
+	}
+
+	expanded := make([]string, len(values))
+	for i, v := range values {
+		expanded[i] = os.ExpandEnv(v)
+	}
+	return expanded
+}
+
+// expandEnv sets the paths, arguments and environment of the configuration to the stored values with
+// their ${VAR} references expanded, so they can differ per machine without changing the configuration.
+func (c *cerberusSvc) expandEnv() {
+	c.cfg.ExePath = c.stored.expand(c.stored.ExePath)
+	c.cfg.WorkDir = c.stored.expand(c.stored.WorkDir)
+	c.cfg.StdinFile = c.stored.expand(c.stored.StdinFile)
+	c.cfg.StdoutLog = c.stored.expand(c.stored.StdoutLog)
+	c.cfg.StderrLog = c.stored.expand(c.stored.StderrLog)
+	c.cfg.Args = c.stored.expandAll(c.stored.Args)
+	c.cfg.Env = c.stored.expandAll(c.stored.Env)
+}
+
+// unsetEnvVars returns the environment variables referenced by the expanded fields of the
+// configuration, which aren't set in the current environment.
+func unsetEnvVars(cfg *SvcConfig) []string {
+	values := append([]string{cfg.ExePath, cfg.WorkDir, cfg.StdinFile, cfg.StdoutLog, cfg.StderrLog}, cfg.Args...)
+	values = append(values, cfg.Env...)
+
+	var names []string
+	seen := map[string]bool{}
+	for _, v := range values {
+		os.Expand(v, func(name string) string {
+			if _, ok := os.LookupEnv(name); !ok && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+			return ""
+		})
+	}
+	return names
+}
@@ -3,6 +3,7 @@ package cerberus
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 // ErrorCode cerberus unique error codes.
@@ -30,6 +31,14 @@ const (
 	ErrTimeout
 	// ErrSCMConnect indicates a failure while connecting to the SCM.
 	ErrSCMConnect
+	// ErrStartService indicates error while starting a service.
+	ErrStartService
+	// ErrAlreadyRunning indicates the service is already running.
+	ErrAlreadyRunning
+	// ErrStopService indicates error while stopping a service.
+	ErrStopService
+	// ErrNotInstalled indicates the service is not installed.
+	ErrNotInstalled
 )
 
 var errorMap = map[ErrorCode]string{
@@ -39,9 +48,38 @@ var errorMap = map[ErrorCode]string{
 	ErrUpdateService:        "UpdateService",
 	ErrRemoveService:        "RemoveService",
 	ErrRunService:           "RunService",
+	ErrStartService:         "StartService",
+	ErrStopService:          "StopService",
 	ErrInvalidConfiguration: "Validation",
 }
 
+// errorCodeText describes the error codes, it is used when an error code is used as sentinel error.
+var errorCodeText = map[ErrorCode]string{
+	ErrGeneric:              "generic error",
+	ErrSaveServiceCfg:       "failed to save service configuration",
+	ErrLoadServiceCfg:       "failed to load service configuration",
+	ErrInstallService:       "failed to install service",
+	ErrUpdateService:        "failed to update service",
+	ErrInvalidConfiguration: "invalid service configuration",
+	ErrRemoveService:        "failed to remove service",
+	ErrRunService:           "failed to run service",
+	ErrTimeout:              "timeout",
+	ErrSCMConnect:           "failed to connect to the service control manager",
+	ErrStartService:         "failed to start service",
+	ErrAlreadyRunning:       "service is already running",
+	ErrStopService:          "failed to stop service",
+	ErrNotInstalled:         "service is not installed",
+}
+
+// Error implements the error interface, so every error code is a sentinel error
+// which can be matched with errors.Is (ex. errors.Is(err, cerberus.ErrNotInstalled)).
+func (c ErrorCode) Error() string {
+	if v, ok := errorCodeText[c]; ok {
+		return "cerberus: " + v
+	}
+	return fmt.Sprintf("cerberus: error code %d", int(c))
+}
+
 // Error is a cerberus specific error.
 type Error struct {
 	Code      ErrorCode
@@ -49,8 +87,13 @@ type Error struct {
 	nestedErr error
 }
 
-// Is implements the errors.Is interface.
+// Is implements the errors.Is interface, the error matches errors and error codes
+// with the same code.
 func (e Error) Is(target error) bool {
+	if code, ok := target.(ErrorCode); ok {
+		return code == e.Code
+	}
+
 	var terr Error
 	if errors.As(target, &terr) && terr.Code == e.Code {
 		return true
@@ -59,13 +102,10 @@ func (e Error) Is(target error) bool {
 	return false
 }
 
-// Unwrap implements the errors.Unwrap interface.
-func (e Error) Unwrap(err error) error {
-	if e.nestedErr != nil {
-		return e.nestedErr
-	}
-
-	return nil
+// Unwrap implements the errors.Unwrap interface, so errors.Is and errors.As
+// also match the wrapped error.
+func (e Error) Unwrap() error {
+	return e.nestedErr
 }
 
 // Error implements the error interface.
@@ -81,6 +121,110 @@ func (e Error) Error() string {
 	return err
 }
 
+// AggregateError collects the errors of a batch operation, which doesn't abort on the first failure.
+type AggregateError struct {
+	Errors []Error
+}
+
+// Error implements the error interface.
+func (a AggregateError) Error() string {
+	msgs := make([]string, len(a.Errors))
+	for i, e := range a.Errors {
+		msgs[i] = e.Error()
+	}
+	return fmt.Sprintf("%v error(s) occurred: %v", len(a.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns all collected errors, so errors.Is and errors.As match any of them.
+func (a AggregateError) Unwrap() []error {
+	errs := make([]error, len(a.Errors))
+	for i := range a.Errors {
+		errs[i] = a.Errors[i]
+	}
+	return errs
+}
+
+// FirstError returns the first collected error or nil if no error occurred.
+func (a AggregateError) FirstError() error {
+	if len(a.Errors) == 0 {
+		return nil
+	}
+	return a.Errors[0]
+}
+
+// HasCode reports whether any of the collected errors has the given code.
+func (a AggregateError) HasCode(code ErrorCode) bool {
+	for _, e := range a.Errors {
+		if e.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// add collects the error with the item it occurred for, errors which aren't cerberus errors
+// are wrapped in an ErrGeneric error.
+func (a *AggregateError) add(err error, item string) {
+	var e Error
+	if errors.As(err, &e) {
+		e = newErrorW(e.Code, "%v: %v", e.nestedErr, item, e.Message)
+	} else {
+		e = newErrorW(ErrGeneric, "%v failed", err, item)
+	}
+	a.Errors = append(a.Errors, e)
+}
+
+// errOrNil returns the aggregate error if any error has been collected, otherwise nil.
+func (a AggregateError) errOrNil() error {
+	if len(a.Errors) == 0 {
+		return nil
+	}
+	return a
+}
+
+// Warning is a cerberus specific issue, which doesn't abort the operation. Functions
+// return them alongside their result, usually as part of a Result.
+type Warning struct {
+	Code      ErrorCode
+	Message   string
+	nestedErr error
+}
+
+// Unwrap returns the error which caused the warning.
+func (w Warning) Unwrap() error {
+	return w.nestedErr
+}
+
+// String formats the warning like an Error.
+func (w Warning) String() string {
+	return Error(w).Error()
+}
+
+// Result is the result of an operation, which can have warnings besides an error.
+type Result[T any] struct {
+	Value    T
+	Err      error
+	Warnings []Warning
+}
+
+// newWarning returns a new cerberus warning.
+func newWarning(code ErrorCode, message string, args ...interface{}) Warning {
+	return Warning(newError(code, message, args...))
+}
+
+// newWarningW returns a new cerberus warning and wraps the error which caused it.
+func newWarningW(code ErrorCode, message string, err error, args ...interface{}) Warning {
+	return Warning(newErrorW(code, message, err, args...))
+}
+
+// logWarnings logs the warnings for callers of the functions without warnings in the result,
+// in JSON mode the warning and its code are separate keys.
+func logWarnings(warnings []Warning) {
+	for _, w := range warnings {
+		Logf(Logger, "Warning: %v\n", Field("warning", w), Field("warning_code", int(w.Code)))
+	}
+}
+
 // newError returns a new cerberus error.
 func newError(code ErrorCode, message string, args ...interface{}) Error {
 	return Error{Code: code, Message: fmt.Sprintf(message, args...)}
@@ -88,7 +232,7 @@ func newError(code ErrorCode, message string, args ...interface{}) Error {
 
 // newErrorW returns a new cerberus error and wraps an existing error.
 func newErrorW(code ErrorCode, message string, err error, args ...interface{}) Error {
-	e := newError(code, message)
+	e := newError(code, message, args...)
 	e.nestedErr = err
 	return e
 }
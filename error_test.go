@@ -0,0 +1,73 @@
+package cerberus
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestErrorChain(t *testing.T) {
+	nested := &os.PathError{Op: "open", Path: "app.exe", Err: os.ErrNotExist}
+
+	for code := ErrGeneric; code <= ErrNotInstalled; code++ {
+		t.Run(fmt.Sprint(int(code)), func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", newErrorW(code, "failed for %v", nested, "app"))
+
+			var e Error
+			if !errors.As(err, &e) {
+				t.Fatalf("errors.As(%v, &Error{}) = false, want true", err)
+			}
+			if e.Code != code {
+				t.Errorf("Code = %v, want %v", e.Code, code)
+			}
+			if e.Message != "failed for app" {
+				t.Errorf("Message = %q, want %q", e.Message, "failed for app")
+			}
+			if got := e.Unwrap(); got != nested {
+				t.Errorf("Unwrap() = %v, want %v", got, nested)
+			}
+
+			if !errors.Is(err, code) {
+				t.Errorf("errors.Is(err, %v) = false, want true", int(code))
+			}
+			if !errors.Is(err, newError(code, "other message")) {
+				t.Errorf("errors.Is(err, Error{Code: %v}) = false, want true", int(code))
+			}
+			if !errors.Is(err, nested) {
+				t.Errorf("errors.Is(err, nested) = false, want true")
+			}
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("errors.Is(err, os.ErrNotExist) = false, want true")
+			}
+
+			var perr *os.PathError
+			if !errors.As(err, &perr) || perr != nested {
+				t.Errorf("errors.As(err, &os.PathError{}) = %v, want nested error", perr)
+			}
+
+			other := ErrGeneric
+			if code == ErrGeneric {
+				other = ErrTimeout
+			}
+			if errors.Is(err, other) {
+				t.Errorf("errors.Is(err, %v) = true, want false", int(other))
+			}
+		})
+	}
+}
+
+func TestErrorWithoutNestedError(t *testing.T) {
+	for code := ErrGeneric; code <= ErrNotInstalled; code++ {
+		err := newError(code, "failed")
+		if err.Unwrap() != nil {
+			t.Errorf("code %v: Unwrap() = %v, want nil", int(code), err.Unwrap())
+		}
+		if !errors.Is(err, code) {
+			t.Errorf("code %v: errors.Is(err, code) = false, want true", int(code))
+		}
+		if code.Error() == "" {
+			t.Errorf("code %v: Error() is empty", int(code))
+		}
+	}
+}
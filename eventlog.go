@@ -0,0 +1,310 @@
+package cerberus
+
+import (
+	"encoding/binary"
+	"regexp"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+var (
+	advapi32 = windows.NewLazySystemDLL("advapi32.dll")
+
+	procOpenEventLogW              = advapi32.NewProc("OpenEventLogW")
+	procCloseEventLog              = advapi32.NewProc("CloseEventLog")
+	procReadEventLogW              = advapi32.NewProc("ReadEventLogW")
+	procGetNumberOfEventLogRecords = advapi32.NewProc("GetNumberOfEventLogRecords")
+	procGetOldestEventLogRecord    = advapi32.NewProc("GetOldestEventLogRecord")
+)
+
+// Flags of ReadEventLogW.
+const (
+	eventlogSequentialRead = 0x0001
+	eventlogSeekRead       = 0x0002
+	eventlogForwardsRead   = 0x0004
+	eventlogBackwardsRead  = 0x0008
+)
+
+// eventSourcesKey is the registry key of the event sources of the application log.
+const eventSourcesKey = `SYSTEM\CurrentControlSet\Services\EventLog\Application`
+
+// eventRecordHeaderSize is the size of the fixed part of an EVENTLOGRECORD.
+const eventRecordHeaderSize = 56
+
+// EventEntry is an entry of the event log of a service.
+type EventEntry struct {
+	Record  uint32    `json:"record"`
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	EventID uint32    `json:"event_id"`
+}
+
+// EventCategory is the category of an event log entry written by cerberus, it's derived from the event id.
+type EventCategory string
+
+const (
+	// InfoCategory are informational entries like start and stop of the service.
+	InfoCategory EventCategory = "info"
+	// StartFailedCategory are entries about a service which failed to start.
+	StartFailedCategory EventCategory = "start-failed"
+	// CrashCategory are entries about a crashed executable and its recovery.
+	CrashCategory EventCategory = "crash"
+	// WarningCategory are entries about issues which don't stop the service.
+	WarningCategory EventCategory = "warning"
+	// RunFailedCategory are entries about a service host which failed to run.
+	RunFailedCategory EventCategory = "run-failed"
+	// UnknownCategory are entries with an event id cerberus doesn't write.
+	UnknownCategory EventCategory = "unknown"
+)
+
+var eventCategories = map[uint32]EventCategory{
+	1: InfoCategory,
+	2: StartFailedCategory,
+	3: CrashCategory,
+	4: WarningCategory,
+	5: RunFailedCategory,
+}
+
+// ParsedEvent is an event log entry with its category and the fields extracted from the message.
+type ParsedEvent struct {
+	EventEntry
+	Category EventCategory `json:"category"`
+	// Fields are the values extracted from the message (ex. executable, exit_code, error).
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// eventPatterns extract the fields of the messages written by the service host, the
+// names of the groups are the field names. If several patterns set a field, the first wins.
+var eventPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^Executable '(?P<executable>[^']*)' exited with error: (?P<error>.*)`),
+	regexp.MustCompile(`exit status (?P<exit_code>-?\d+)`),
+	regexp.MustCompile(`^Executable '(?P<executable>[^']*)' reached specified restart limits: (?P<max_restarts>\d+)`),
+	regexp.MustCompile(`^Executable '(?P<executable>[^']*)' exceeded the handle limit \((?P<handles>\d+) > (?P<max_handles>\d+)\)`),
+	regexp.MustCompile(`^Circuit open: executable '(?P<executable>[^']*)' restarted (?P<restarts>\d+) times within (?P<window>\S+),`),
+	regexp.MustCompile(`^Watchdog check failed \((?P<failures>\d+)/(?P<threshold>\d+)\): (?P<error>.*)`),
+	regexp.MustCompile(`^Waiting (?P<delay>\S+) before restarting`),
+	regexp.MustCompile(`^Calling webhook '(?P<webhook>[^']*)'`),
+	regexp.MustCompile(`^Executing defined program '(?P<program>[^']*)'`),
+	regexp.MustCompile(`^(?:Starting|Restarting) service (?P<service>\S+)`),
+	regexp.MustCompile(`^Service (?P<service>\S+) (?:is running|stopped|unexpectedly stopped)`),
+	regexp.MustCompile(`^Failed to (?P<operation>[^:']+(?:'[^']*')?): (?P<error>.*)`),
+}
+
+// ParseEventLog categorizes the entries by their event id and extracts the fields of their messages.
+func ParseEventLog(entries []EventEntry) []ParsedEvent {
+	parsed := make([]ParsedEvent, len(entries))
+	for i, e := range entries {
+		parsed[i] = parseEvent(e)
+	}
+	return parsed
+}
+
+func parseEvent(e EventEntry) ParsedEvent {
+	p := ParsedEvent{EventEntry: e, Category: UnknownCategory}
+	if c, ok := eventCategories[e.EventID]; ok {
+		p.Category = c
+	}
+
+	for _, re := range eventPatterns {
+		m := re.FindStringSubmatch(e.Message)
+		if m == nil {
+			continue
+		}
+		for i, field := range re.SubexpNames() {
+			if field == "" {
+				continue
+			}
+			if p.Fields == nil {
+				p.Fields = map[string]string{}
+			}
+			if _, ok := p.Fields[field]; !ok {
+				p.Fields[field] = m[i]
+			}
+		}
+	}
+	return p
+}
+
+// QueryEventLog returns the most recent maxEntries event log entries of the
+// service with the given name, the oldest entry comes first.
+func QueryEventLog(name string, maxEntries int) ([]EventEntry, error) {
+	h, err := openEventLog(name)
+	if err != nil {
+		return nil, err
+	}
+	defer procCloseEventLog.Call(uintptr(h))
+
+	var entries []EventEntry
+	err = readEventLog(h, eventlogSequentialRead|eventlogBackwardsRead, 0, func(e EventEntry, source string) bool {
+		if source == name {
+			entries = append(entries, e)
+		}
+		return len(entries) < maxEntries
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// QueryEventLogSince returns all event log entries of the service with the
+// given name, which were written after the record with the given number.
+func QueryEventLogSince(name string, record uint32) ([]EventEntry, error) {
+	h, err := openEventLog(name)
+	if err != nil {
+		return nil, err
+	}
+	defer procCloseEventLog.Call(uintptr(h))
+
+	var oldest, count uint32
+	if r, _, err := procGetOldestEventLogRecord.Call(uintptr(h), uintptr(unsafe.Pointer(&oldest))); r == 0 {
+		return nil, newErrorW(ErrGeneric, "failed to read event log of service %v", err, name)
+	}
+	if r, _, err := procGetNumberOfEventLogRecords.Call(uintptr(h), uintptr(unsafe.Pointer(&count))); r == 0 {
+		return nil, newErrorW(ErrGeneric, "failed to read event log of service %v", err, name)
+	}
+
+	// Seeking behind the newest record isn't allowed.
+	if count == 0 || record+1 >= oldest+count {
+		return nil, nil
+	}
+	if record < oldest {
+		record = oldest - 1
+	}
+
+	var entries []EventEntry
+	err = readEventLog(h, eventlogSeekRead|eventlogForwardsRead, record+1, func(e EventEntry, source string) bool {
+		if source == name {
+			entries = append(entries, e)
+		}
+		return true
+	})
+	return entries, err
+}
+
+// openEventLog opens the application log for the event source of the service.
+func openEventLog(name string) (windows.Handle, error) {
+	// OpenEventLog falls back to the application log for unknown sources, so this must be checked first.
+	if !eventSourceExists(name) {
+		return 0, newError(ErrGeneric, "event source %v doesn't exist, %v is not a cerberus service", name, name)
+	}
+
+	source, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, newErrorW(ErrGeneric, "invalid service name %v", err, name)
+	}
+
+	h, _, err := procOpenEventLogW.Call(0, uintptr(unsafe.Pointer(source)))
+	if h == 0 {
+		return 0, newErrorW(ErrGeneric, "failed to open event log of service %v", err, name)
+	}
+	return windows.Handle(h), nil
+}
+
+// eventSourceExists reports whether the event source was created, which is done by the installation of a service.
+func eventSourceExists(name string) bool {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, eventSourcesKey+"\\"+name, registry.QUERY_VALUE)
+	if err != nil {
+		return false
+	}
+	key.Close()
+	return true
+}
+
+// readEventLog reads the event log with the given flags and calls fn for every record
+// until fn returns false or there are no more records.
+func readEventLog(h windows.Handle, flags, offset uint32, fn func(e EventEntry, source string) bool) error {
+	buf := make([]byte, 64*1024)
+	for {
+		var read, needed uint32
+		r, _, err := procReadEventLogW.Call(uintptr(h), uintptr(flags), uintptr(offset),
+			uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)),
+			uintptr(unsafe.Pointer(&read)), uintptr(unsafe.Pointer(&needed)))
+		if r == 0 {
+			switch err {
+			case windows.ERROR_HANDLE_EOF:
+				return nil
+			case windows.ERROR_INSUFFICIENT_BUFFER:
+				buf = make([]byte, needed)
+				continue
+			default:
+				return newErrorW(ErrGeneric, "failed to read event log", err)
+			}
+		}
+
+		// Only the first read has to seek, continue sequentially afterwards.
+		if flags&eventlogSeekRead != 0 {
+			flags = flags&^eventlogSeekRead | eventlogSequentialRead
+			offset = 0
+		}
+
+		for data := buf[:read]; len(data) >= eventRecordHeaderSize; {
+			length := binary.LittleEndian.Uint32(data[0:])
+			if length < eventRecordHeaderSize || int(length) > len(data) {
+				break
+			}
+
+			entry, source := parseEventRecord(data[:length])
+			if !fn(entry, source) {
+				return nil
+			}
+			data = data[length:]
+		}
+	}
+}
+
+// parseEventRecord parses an EVENTLOGRECORD and returns the entry and the source name.
+func parseEventRecord(rec []byte) (EventEntry, string) {
+	entry := EventEntry{
+		Record: binary.LittleEndian.Uint32(rec[8:]),
+		Time:   time.Unix(int64(binary.LittleEndian.Uint32(rec[12:])), 0),
+		// The upper bits contain the severity and facility.
+		EventID: binary.LittleEndian.Uint32(rec[20:]) & 0xFFFF,
+	}
+
+	switch binary.LittleEndian.Uint16(rec[24:]) {
+	case windows.EVENTLOG_ERROR_TYPE:
+		entry.Level = "error"
+	case windows.EVENTLOG_WARNING_TYPE:
+		entry.Level = "warning"
+	default:
+		entry.Level = "info"
+	}
+
+	source, _ := utf16String(rec[eventRecordHeaderSize:])
+
+	numStrings := int(binary.LittleEndian.Uint16(rec[26:]))
+	offset := int(binary.LittleEndian.Uint32(rec[36:]))
+	for i := 0; i < numStrings && offset < len(rec); i++ {
+		s, n := utf16String(rec[offset:])
+		if entry.Message != "" {
+			entry.Message += " "
+		}
+		entry.Message += s
+		offset += n
+	}
+
+	return entry, source
+}
+
+// utf16String decodes a null terminated UTF-16 string and returns the string
+// and the number of bytes consumed including the terminator.
+func utf16String(b []byte) (string, int) {
+	var s []uint16
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			return windows.UTF16ToString(s), i + 2
+		}
+		s = append(s, c)
+	}
+	return windows.UTF16ToString(s), len(b)
+}
@@ -0,0 +1,187 @@
+package cerberus
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the type of a service event.
+type EventType int
+
+const (
+	// StartedEvent is published when the service is running.
+	StartedEvent EventType = iota + 1
+	// StoppedEvent is published when the service has stopped.
+	StoppedEvent
+	// CrashedEvent is published when the executable exited with an error.
+	CrashedEvent
+	// RecoveredEvent is published when the executable was restarted by a recovery action.
+	RecoveredEvent
+	// MaxRestartsReachedEvent is published when the executable reached the restart limit.
+	MaxRestartsReachedEvent
+)
+
+func (e EventType) String() string {
+	switch e {
+	case StartedEvent:
+		return "Started"
+	case StoppedEvent:
+		return "Stopped"
+	case CrashedEvent:
+		return "Crashed"
+	case RecoveredEvent:
+		return "Recovered"
+	case MaxRestartsReachedEvent:
+		return "MaxRestartsReached"
+	default:
+		return "Unknown"
+	}
+}
+
+// SvcEvent is a state change of a service.
+type SvcEvent struct {
+	Name     string
+	Type     EventType
+	ExitCode int
+}
+
+// eventBufferSize is the buffer size of a subscription channel, events
+// are dropped if a subscriber doesn't keep up.
+const eventBufferSize = 16
+
+var subscriptions = struct {
+	sync.RWMutex
+	subs map[string]map[chan SvcEvent]struct{}
+}{subs: map[string]map[chan SvcEvent]struct{}{}}
+
+// Subscribe registers a channel which receives all events of the service with the given name.
+// The returned function unsubscribes and closes the channel.
+func Subscribe(name string) (<-chan SvcEvent, func(), error) {
+	if name == "" {
+		return nil, nil, newError(ErrGeneric, "empty service name is not allowed")
+	}
+
+	ch := make(chan SvcEvent, eventBufferSize)
+	subscriptions.Lock()
+	if subscriptions.subs[name] == nil {
+		subscriptions.subs[name] = map[chan SvcEvent]struct{}{}
+	}
+	subscriptions.subs[name][ch] = struct{}{}
+	subscriptions.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			subscriptions.Lock()
+			delete(subscriptions.subs[name], ch)
+			if len(subscriptions.subs[name]) == 0 {
+				delete(subscriptions.subs, name)
+			}
+			subscriptions.Unlock()
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe, nil
+}
+
+// StateCallbackTimeout is the time a callback registered with OnStateChange may run,
+// a callback which runs longer is logged and no longer waited for.
+var StateCallbackTimeout = 5 * time.Second
+
+// stateCallback wraps a callback, so it can be identified for unregistration.
+type stateCallback struct {
+	fn func(SvcEvent)
+}
+
+// stateCallbacks maps the service name to its []*stateCallback, the empty name to the callbacks of all
+// services. The slices are replaced on change, so they can be read without holding stateCallbacksMu.
+var (
+	stateCallbacks   sync.Map
+	stateCallbacksMu sync.Mutex
+)
+
+// OnStateChange registers a callback which is called with all events of the service with the given name,
+// or of all services if the name is empty. Events are published by the service host (see RunService),
+// every callback runs in its own goroutine and must not block. The returned function unregisters the callback.
+func OnStateChange(name string, fn func(SvcEvent)) (func(), error) {
+	if fn == nil {
+		return nil, newError(ErrGeneric, "state change callback can't be nil")
+	}
+	cb := &stateCallback{fn: fn}
+
+	stateCallbacksMu.Lock()
+	callbacks, _ := stateCallbacks.Load(name)
+	list, _ := callbacks.([]*stateCallback)
+	stateCallbacks.Store(name, append(append([]*stateCallback(nil), list...), cb))
+	stateCallbacksMu.Unlock()
+
+	var once sync.Once
+	unregister := func() {
+		once.Do(func() {
+			stateCallbacksMu.Lock()
+			defer stateCallbacksMu.Unlock()
+
+			callbacks, _ := stateCallbacks.Load(name)
+			list, _ := callbacks.([]*stateCallback)
+			remaining := make([]*stateCallback, 0, len(list))
+			for _, c := range list {
+				if c != cb {
+					remaining = append(remaining, c)
+				}
+			}
+			if len(remaining) == 0 {
+				stateCallbacks.Delete(name)
+			} else {
+				stateCallbacks.Store(name, remaining)
+			}
+		})
+	}
+
+	return unregister, nil
+}
+
+// publish sends the event to all subscribers of the service without blocking
+// and calls the registered callbacks.
+func publish(event SvcEvent) {
+	subscriptions.RLock()
+	for ch := range subscriptions.subs[event.Name] {
+		select {
+		case ch <- event:
+		default:
+			DebugLogger.Println("dropping event", event.Type, "for service", event.Name)
+		}
+	}
+	subscriptions.RUnlock()
+
+	for _, name := range []string{event.Name, ""} {
+		callbacks, _ := stateCallbacks.Load(name)
+		list, _ := callbacks.([]*stateCallback)
+		for _, cb := range list {
+			go runStateCallback(cb, event)
+		}
+	}
+}
+
+// runStateCallback calls the callback and waits at most StateCallbackTimeout for it,
+// a panicking callback is logged and doesn't crash the service host.
+func runStateCallback(cb *stateCallback, event SvcEvent) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				Logf(Logger, "State change callback for %v event of service %v panicked: %v\n", Field("event", event.Type), Field("service", event.Name), Field("error", r))
+			}
+		}()
+		cb.fn(event)
+	}()
+
+	timer := time.NewTimer(StateCallbackTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		Logf(Logger, "State change callback for %v event of service %v didn't return within %v\n", Field("event", event.Type), Field("service", event.Name), Field("timeout", StateCallbackTimeout))
+	}
+}
@@ -0,0 +1,104 @@
+package cerberus
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// Backup contains the configurations of all cerberus services.
+type Backup struct {
+	Version   string       `json:"version"`
+	Timestamp time.Time    `json:"timestamp"`
+	Services  []*SvcConfig `json:"services"`
+}
+
+// ImportBackup parses a backup created by ExportBackup, a JSON array
+// created by ExportConfigs is accepted as well.
+func ImportBackup(data []byte) (*Backup, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		svcs, err := ImportConfig(data)
+		if err != nil {
+			return nil, err
+		}
+		return &Backup{Services: svcs}, nil
+	}
+
+	var backup Backup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to import backup", err)
+	}
+	return &backup, nil
+}
+
+// ExportBackup returns the backup as indented JSON with sorted keys.
+func ExportBackup(backup Backup) ([]byte, error) {
+	if backup.Services == nil {
+		backup.Services = []*SvcConfig{}
+	}
+	return exportJSON(backup)
+}
+
+// ImportConfig parses configurations exported by ExportConfig or ExportConfigs.
+func ImportConfig(data []byte) ([]*SvcConfig, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var cfgs []*SvcConfig
+		if err := json.Unmarshal(data, &cfgs); err != nil {
+			return nil, newErrorW(ErrLoadServiceCfg, "failed to import configuration", err)
+		}
+		for _, cfg := range cfgs {
+			if cfg != nil {
+				migrateConfig(cfg)
+			}
+		}
+		return cfgs, nil
+	}
+
+	var cfg SvcConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to import configuration", err)
+	}
+	// Exports of older versions are upgraded like stored configurations.
+	migrateConfig(&cfg)
+	return []*SvcConfig{&cfg}, nil
+}
+
+// ExportConfig returns the configuration of a service as indented JSON. The keys
+// are sorted, so the output is deterministic and can be diffed between versions.
+// The password is never exported.
+func ExportConfig(cfg *SvcConfig) ([]byte, error) {
+	return exportJSON(cfg)
+}
+
+// ExportConfigs returns the configurations of multiple services as JSON array,
+// this is the format consumed by ImportConfig and the restore command.
+func ExportConfigs(cfgs []*SvcConfig) ([]byte, error) {
+	if cfgs == nil {
+		cfgs = []*SvcConfig{}
+	}
+	return exportJSON(cfgs)
+}
+
+// exportJSON marshals v with sorted keys, maps are always encoded in key order.
+func exportJSON(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, newErrorW(ErrGeneric, "failed to export configuration", err)
+	}
+
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Keep numbers as they are, ex. an affinity mask doesn't fit into a float64.
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return nil, newErrorW(ErrGeneric, "failed to export configuration", err)
+	}
+
+	data, err = json.MarshalIndent(generic, "", "  ")
+	if err != nil {
+		return nil, newErrorW(ErrGeneric, "failed to export configuration", err)
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,142 @@
+package cerberus
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListGroups returns the service groups with the sorted names of their services. Group names
+// are case-insensitive, services without a group aren't returned.
+func ListGroups() (map[string][]string, error) {
+	svcs, err := LoadServicesCfg()
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]string{}
+	groups := map[string][]string{}
+	for _, s := range svcs {
+		if s.Group == "" {
+			continue
+		}
+		key := strings.ToLower(s.Group)
+		if _, ok := names[key]; !ok {
+			names[key] = s.Group
+		}
+		groups[names[key]] = append(groups[names[key]], s.Name)
+	}
+
+	for _, members := range groups {
+		sort.Strings(members)
+	}
+	return groups, nil
+}
+
+// StartGroup starts all services of the group in parallel and waits up to timeout for each of
+// them to run. Services which are already running are skipped, a failure doesn't stop the
+// remaining services from being started, all failures are returned as AggregateError.
+func StartGroup(group string, timeout time.Duration) error {
+	svcs, err := loadGroup(group)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs AggregateError
+	for _, s := range svcs {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if err := StartServiceTimeout(name, timeout); err != nil && !errors.Is(err, ErrAlreadyRunning) {
+				mu.Lock()
+				errs.add(err, "starting "+name)
+				mu.Unlock()
+			}
+		}(s.Name)
+	}
+	wg.Wait()
+
+	return errs.errOrNil()
+}
+
+// StopGroup stops all services of the group one after another, services are stopped before the
+// services of the group they depend on. A zero timeout uses the configured StopTimeout of each
+// service. A failure doesn't stop the remaining services from being stopped, all failures are
+// returned as AggregateError.
+func StopGroup(group string, timeout time.Duration) error {
+	svcs, err := loadGroup(group)
+	if err != nil {
+		return err
+	}
+
+	var errs AggregateError
+	for _, s := range stopOrder(svcs) {
+		if err := StopService(s.Name, timeout); err != nil {
+			errs.add(err, "stopping "+s.Name)
+		}
+	}
+	return errs.errOrNil()
+}
+
+// loadGroup loads the configurations of all services of the group.
+func loadGroup(group string) ([]*SvcConfig, error) {
+	if group == "" {
+		return nil, newError(ErrGeneric, "empty group name is not allowed")
+	}
+
+	svcs, err := LoadServicesCfg()
+	if err != nil {
+		return nil, err
+	}
+
+	var members []*SvcConfig
+	for _, s := range svcs {
+		if strings.EqualFold(s.Group, group) {
+			members = append(members, s)
+		}
+	}
+	if len(members) == 0 {
+		return nil, newError(ErrGeneric, "group %v has no services", group)
+	}
+	return members, nil
+}
+
+// stopOrder sorts the services, so every service comes before the services it depends on.
+func stopOrder(svcs []*SvcConfig) []*SvcConfig {
+	byName := map[string]*SvcConfig{}
+	for _, s := range svcs {
+		byName[strings.ToLower(s.Name)] = s
+	}
+
+	// Collect the services dependencies first, then reverse the order.
+	visited := map[string]bool{}
+	var order []*SvcConfig
+	var visit func(s *SvcConfig)
+	visit = func(s *SvcConfig) {
+		if visited[strings.ToLower(s.Name)] {
+			return
+		}
+		visited[strings.ToLower(s.Name)] = true
+
+		for _, deps := range [][]string{s.Dependencies, s.OptionalDependencies} {
+			for _, dep := range deps {
+				if d, ok := byName[strings.ToLower(dep)]; ok {
+					visit(d)
+				}
+			}
+		}
+		order = append(order, s)
+	}
+	for _, s := range svcs {
+		visit(s)
+	}
+
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
@@ -1,26 +1,51 @@
 package cerberus
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
 	"os"
 	"os/exec"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-sharp/windows/pkg/signal"
 
 	"github.com/go-sharp/windows/pkg/ps"
+	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/debug"
 )
 
 type cerberusSvc struct {
+	// The service is stopped if the context is done
+	ctx  context.Context
 	log  debug.Log
 	cfg  SvcConfig
 	cmd  *exec.Cmd
+	job  windows.Handle
 	done chan error
+	// Output logs of the process
+	stdout *rotatingWriter
+	stderr *rotatingWriter
 	// Restart Counter
 	restarts    int
 	lastRestart time.Time
+	delay       time.Duration
+	rnd         *rand.Rand
+	// Restarts within the circuit breaker window
+	recentRestarts []time.Time
+	// Additional environment for the next start only
+	extraEnv []string
+	// Set by the watchdog if it stopped the process, accessed atomically
+	watchdogTripped int32
+	// Serves the metrics if a metrics port is configured
+	metrics *http.Server
+	// Configuration as stored, cfg contains its expanded environment references
+	stored SvcConfig
 }
 
 type recoveryHandlerStatus int
@@ -34,6 +59,14 @@ const (
 // Execute will be called when the service is started.
 func (c *cerberusSvc) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (svcSpecificEC bool, exitCode uint32) {
 	changes <- svc.Status{State: svc.StartPending}
+	defer c.closeJob()
+	defer c.closeLogs()
+
+	c.waitForOptionalDependencies(changes)
+	if c.cfg.PreStartCmd != "" {
+		// Tell the SCM how long the pre-start hook may take, otherwise it considers the service as hung.
+		changes <- svc.Status{State: svc.StartPending, CheckPoint: uint32(len(c.cfg.OptionalDependencies) + 1), WaitHint: uint32(c.cfg.preStartTimeout() / time.Millisecond)}
+	}
 
 	// Setup signaling for the process and run it
 	c.done = make(chan error)
@@ -46,22 +79,51 @@ func (c *cerberusSvc) Execute(args []string, r <-chan svc.ChangeRequest, changes
 	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
 	c.log.Info(1, fmt.Sprintf("Service %v is running...", c.cfg.Name))
 
+	started := time.Now()
+	if err := recordRunning(c.cfg.Name, started); err != nil {
+		c.log.Warning(4, fmt.Sprintf("Failed to record service start: %v", err))
+	}
+	stopHeartbeat := make(chan struct{})
+	go c.heartbeat(stopHeartbeat)
+	defer func() {
+		close(stopHeartbeat)
+		if err := recordStopped(c.cfg.Name, started); err != nil {
+			c.log.Warning(4, fmt.Sprintf("Failed to record service stop: %v", err))
+		}
+	}()
+	c.startMetrics()
+	defer c.stopMetrics()
+	publish(SvcEvent{Name: c.cfg.Name, Type: StartedEvent})
+
 loop:
 	for {
 		select {
 		case err := <-c.done:
+			// An exit forced by the watchdog is handled like a crash, regardless of the exit code.
+			if atomic.SwapInt32(&c.watchdogTripped, 0) == 1 {
+				err = errWatchdog
+			}
 			if err != nil {
-				c.log.Error(3, fmt.Sprintf("Executable '%v' exited with error: %v", c.cfg.ExePath, err))
-				// Check if we have a proper exit error and act according configuration
+				fields := []LogField{Field("executable", c.cfg.ExePath), Field("error", err)}
 				if e, ok := err.(*exec.ExitError); ok {
-					ec := e.ExitCode()
-					// If we get -1 process was stopped by a signal, so we stopping gracefully.
-					if ec < 0 {
-						break loop
+					fields = append(fields, Field("exit_code", e.ExitCode()))
+				}
+				logServiceError(c.log, 3, "Executable '%v' exited with error: %v", fields...)
+				// Check if we have a proper exit error and act according configuration
+				e, ok := err.(*exec.ExitError)
+				if ok || err == errWatchdog {
+					ec := WatchdogExitCode
+					if ok {
+						ec = e.ExitCode()
+						// If we get -1 process was stopped by a signal, so we stopping gracefully.
+						if ec < 0 {
+							break loop
+						}
 					}
+					publish(SvcEvent{Name: c.cfg.Name, Type: CrashedEvent, ExitCode: ec})
 					// Check if any recovery action is defined an handle it accordingly.
-					if action, ok := c.cfg.RecoveryActions[ec]; ok {
-						switch c.handleRecovery(action) {
+					if action, ok := c.recoveryAction(ec); ok {
+						switch c.handleRecovery(action, ec) {
 						case rerunServiceStatus:
 							continue
 						case shutdownGracefullyStatus:
@@ -72,17 +134,23 @@ loop:
 					}
 				}
 				c.log.Error(3, fmt.Sprintf("Service %v unexpectedly stopped...", c.cfg.Name))
+				c.runPostStopHook()
+				publish(SvcEvent{Name: c.cfg.Name, Type: StoppedEvent})
 				// We return here so the SCM knows that an error occurred
 				return false, 3
 			}
 			break loop
 
+		case <-c.ctx.Done():
+			c.log.Info(1, "Context done, shutting down...")
+			c.shutdown(changes)
+			break loop
+
 		case cr := <-r:
 			switch cr.Cmd {
 			case svc.Interrogate:
 				changes <- cr.CurrentStatus
 			case svc.Shutdown, svc.Stop:
-				changes <- svc.Status{State: svc.StopPending}
 				c.log.Info(1, "Received shutdown command, shutting down...")
 				c.shutdown(changes)
 				break loop
@@ -92,12 +160,130 @@ loop:
 		}
 	}
 
+	c.runPostStopHook()
 	changes <- svc.Status{State: svc.Stopped}
+	publish(SvcEvent{Name: c.cfg.Name, Type: StoppedEvent})
 	c.log.Info(1, fmt.Sprintf("Service %v stopped...", c.cfg.Name))
 	return
 }
 
+// OptionalDependencyTimeout is the time the service host waits for an optional dependency to run.
+var OptionalDependencyTimeout = DefaultStartTimeout
+
+// PostStopHookTimeout is the time the service host waits for the post-stop hook to finish.
+var PostStopHookTimeout = 30 * time.Second
+
+// waitForOptionalDependencies starts the installed optional dependencies and waits until they are running.
+// Unlike required dependencies, the service is started anyway if they can't be started in time.
+func (c *cerberusSvc) waitForOptionalDependencies(changes chan<- svc.Status) {
+	if len(c.cfg.OptionalDependencies) == 0 {
+		return
+	}
+
+	manager, err := connectSCM()
+	if err != nil {
+		c.log.Warning(4, fmt.Sprintf("Skipping optional dependencies: %v", err))
+		return
+	}
+	defer manager.Disconnect()
+
+	for i, name := range c.cfg.OptionalDependencies {
+		s, err := manager.OpenService(name)
+		if err != nil {
+			c.log.Info(1, fmt.Sprintf("Optional dependency %v is not available: %v", name, err))
+			continue
+		}
+
+		if err := s.Start(); err != nil && err != windows.ERROR_SERVICE_ALREADY_RUNNING {
+			c.log.Warning(4, fmt.Sprintf("Failed to start optional dependency %v: %v", name, err))
+			s.Close()
+			continue
+		}
+
+		// Tell the SCM how long the start will take, otherwise it considers the service as hung.
+		changes <- svc.Status{State: svc.StartPending, CheckPoint: uint32(i + 1), WaitHint: uint32(OptionalDependencyTimeout / time.Millisecond)}
+		if err := waitForStateContext(c.ctx, s, svc.Running, OptionalDependencyTimeout); err != nil {
+			c.log.Warning(4, fmt.Sprintf("Optional dependency %v isn't running, starting anyway: %v", name, err))
+		}
+		s.Close()
+	}
+}
+
+// heartbeat records that the service is still running until stop is closed.
+func (c *cerberusSvc) heartbeat(stop <-chan struct{}) {
+	ticker := time.NewTicker(StatsHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := recordHeartbeat(c.cfg.Name); err != nil {
+				DebugLogger.Println("failed to record heartbeat:", err)
+			}
+		}
+	}
+}
+
+// runPostStopHook runs the configured post-stop hook, errors are only logged
+// as they must not change the exit code of the service.
+func (c *cerberusSvc) runPostStopHook() {
+	if c.cfg.PostStopCmd == "" {
+		return
+	}
+
+	c.log.Info(1, fmt.Sprintf("Running post-stop hook '%v'...", c.cfg.PostStopCmd))
+	out, err := runHook(c.cfg.PostStopCmd, c.cfg.PostStopArgs, c.cfg.WorkDir, append(inheritedEnv(c.cfg), c.cfg.Env...), PostStopHookTimeout)
+	if len(out) > 0 {
+		c.log.Info(1, fmt.Sprintf("Post-stop hook output:\n%s", out))
+	}
+	if err != nil {
+		logServiceError(c.log, 3, "Post-stop hook failed: %v", Field("error", err))
+	}
+}
+
+// stopCheckpointInterval is the interval the service host reports its progress to the SCM while stopping.
+const stopCheckpointInterval = 2 * time.Second
+
+// shutdown stops the executable, it reports the stop timeout as wait hint and advances the
+// checkpoint while waiting, so the SCM doesn't consider the service as hung.
 func (c *cerberusSvc) shutdown(ch chan<- svc.Status) {
+	timeout := c.cfg.stopTimeout()
+	status := svc.Status{State: svc.StopPending, CheckPoint: 1, WaitHint: uint32(timeout / time.Millisecond)}
+	ch <- status
+
+	ticker := time.NewTicker(stopCheckpointInterval)
+	defer ticker.Stop()
+	wait := func(deadline <-chan time.Time) bool {
+		for {
+			select {
+			case <-deadline:
+				return false
+			case <-c.done:
+				return true
+			case <-ticker.C:
+				status.CheckPoint++
+				ch <- status
+			}
+		}
+	}
+
+	c.stopMetrics()
+	if c.cfg.StopSignal > NoSignal {
+		c.sendStopSignals()
+
+		// If the process doesn't stop within the stop timeout we will kill the process.
+		if wait(time.After(timeout)) {
+			return
+		}
+	}
+
+	ps.KillChildProcesses(uint32(c.cmd.Process.Pid), true)
+	wait(nil)
+}
+
+// sendStopSignals sends the configured stop signals to the process.
+func (c *cerberusSvc) sendStopSignals() {
 	sig := c.cfg.StopSignal
 	if sig > NoSignal {
 		// Sending WM_QUIT if configured
@@ -120,29 +306,54 @@ func (c *cerberusSvc) shutdown(ch chan<- svc.Status) {
 			}
 		}
 
-		// If the process doesn't stop within 30 seconds we will kill the process.
-		select {
-		case <-time.After(time.Second * 30):
-		case <-c.done:
-			return
+		// Sending Ctrl-Break if configured
+		if sig&CtrlBreakSignal == CtrlBreakSignal {
+			if err := signal.SendCtrlEvent(uint32(c.cmd.Process.Pid), signal.CtrlBreakEvent); err != nil {
+				c.log.Warning(1, fmt.Sprintf("Failed to send Ctrl-Break signal: %v", err))
+			}
 		}
 	}
+}
 
-	ps.KillChildProcesses(uint32(c.cmd.Process.Pid), true)
-	<-c.done
+// recoveryAction returns the recovery action for the exit code, falling back
+// to the catch-all action if there is no action for this exit code.
+func (c *cerberusSvc) recoveryAction(exitCode int) (SvcRecoveryAction, bool) {
+	if action, ok := c.cfg.RecoveryActions[exitCode]; ok {
+		return action, true
+	}
+
+	action, ok := c.cfg.RecoveryActions[AnyExitCode]
+	return action, ok
 }
 
-func (c *cerberusSvc) handleRecovery(action SvcRecoveryAction) recoveryHandlerStatus {
+func (c *cerberusSvc) handleRecovery(action SvcRecoveryAction, exitCode int) recoveryHandlerStatus {
 	c.log.Info(3, "Applying defined recovery action...")
 	// We stop the service if no action is defined
 	if action.Action == NoAction {
 		c.log.Info(3, "Shutdown service gracefully ...")
 		return shutdownGracefullyStatus
 	}
+	// Notify the webhook without blocking the recovery
+	if action.Action&WebhookAction == WebhookAction {
+		payload := webhookPayload{
+			Service:      c.cfg.Name,
+			ExitCode:     exitCode,
+			RestartCount: c.restarts,
+			Timestamp:    time.Now().Format(time.RFC3339),
+		}
+		go func() {
+			c.log.Info(3, fmt.Sprintf("Calling webhook '%v'...", action.WebhookURL))
+			if err := sendWebhook(action, payload); err != nil {
+				c.log.Warning(3, fmt.Sprintf("Failed to call webhook '%v': %v", action.WebhookURL, err))
+			}
+		}()
+	}
 	// Check if we have to run a external program
 	if action.Action&RunProgramAction == RunProgramAction {
 		c.log.Info(3, fmt.Sprintf("Executing defined program '%v'...", action.Program))
-		if err := exec.Command(action.Program, action.Arguments...).Start(); err != nil {
+		cmd := exec.Command(action.Program, action.Arguments...)
+		cmd.Env = append(append(inheritedEnv(c.cfg), c.cfg.Env...), action.ExtraEnv...)
+		if err := cmd.Start(); err != nil {
 			c.log.Error(3, fmt.Sprintf("Failed to start external program '%v': %v", action.Program, err))
 			return errorStatus
 		}
@@ -154,42 +365,307 @@ func (c *cerberusSvc) handleRecovery(action SvcRecoveryAction) recoveryHandlerSt
 		if !c.lastRestart.IsZero() && time.Now().Sub(c.lastRestart) > action.ResetAfter {
 			c.log.Info(3, "Resetting restart counter...")
 			c.restarts = 0
+			c.delay = 0
+			c.recentRestarts = nil
+		}
+
+		if c.circuitOpen(action) {
+			c.log.Warning(3, fmt.Sprintf("Circuit open: executable '%v' restarted %v times within %v, shutdown service gracefully...",
+				c.cfg.ExePath, len(c.recentRestarts), action.CircuitBreakDuration))
+			return shutdownGracefullyStatus
 		}
 
 		// If we get here we should restart the service as long as max restarts not exceeds the limit.
 		if action.MaxRestarts > 0 && c.restarts >= action.MaxRestarts {
 			c.log.Error(3, fmt.Sprintf("Executable '%v' reached specified restart limits: %v", c.cfg.ExePath, action.MaxRestarts))
+			publish(SvcEvent{Name: c.cfg.Name, Type: MaxRestartsReachedEvent, ExitCode: exitCode})
 			return errorStatus
 		}
 
+		c.delay = restartDelay(action, c.restarts)
+		if action.Jitter > 0 {
+			c.delay += c.jitter(action)
+		}
 		c.restarts++
 		c.lastRestart = time.Now()
+		c.recentRestarts = append(c.recentRestarts, c.lastRestart)
 		// Waiting for the restart
-		if action.Delay > 0 {
-			time.Sleep(time.Duration(action.Delay) * time.Second)
+		if c.delay > 0 {
+			c.log.Info(3, fmt.Sprintf("Waiting %v before restarting...", c.delay))
+			time.Sleep(c.delay)
 		}
 
 		c.log.Info(3, fmt.Sprintf("Restarting service %v", c.cfg.Name))
-		if err := c.runSvc(); err != nil {
+		c.extraEnv = action.ExtraEnv
+		err := c.runSvc()
+		c.extraEnv = nil
+		if err != nil {
 			c.log.Error(3, err.Error())
 			return errorStatus
 		}
 
+		if err := recordRestart(c.cfg.Name); err != nil {
+			c.log.Warning(4, fmt.Sprintf("Failed to record service restart: %v", err))
+		}
+		publish(SvcEvent{Name: c.cfg.Name, Type: RecoveredEvent, ExitCode: exitCode})
 		// We continue the loop
 		return rerunServiceStatus
 	}
 	return errorStatus
 }
 
+// circuitOpen reports whether the executable restarted too often within the circuit breaker window.
+func (c *cerberusSvc) circuitOpen(action SvcRecoveryAction) bool {
+	if action.CircuitBreakAfter <= 0 {
+		return false
+	}
+
+	if action.CircuitBreakDuration > 0 {
+		since := time.Now().Add(-action.CircuitBreakDuration)
+		for len(c.recentRestarts) > 0 && c.recentRestarts[0].Before(since) {
+			c.recentRestarts = c.recentRestarts[1:]
+		}
+	}
+
+	return len(c.recentRestarts) >= action.CircuitBreakAfter
+}
+
+// restartDelay calculates the delay before the next restart.
+func restartDelay(action SvcRecoveryAction, restarts int) time.Duration {
+	delay := time.Duration(action.Delay) * time.Second
+	if !action.ExponentialBackoff {
+		return delay
+	}
+
+	multiplier := action.BackoffMultiplier
+	if multiplier <= 0 {
+		multiplier = DefaultBackoffMultiplier
+	}
+
+	maxDelay := time.Duration(action.MaxDelay) * time.Second
+	delay = time.Duration(float64(delay) * math.Pow(multiplier, float64(restarts)))
+	if maxDelay > 0 && (delay > maxDelay || delay < 0) {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// jitter returns a random duration to add to the restart delay, so the
+// total delay doesn't exceed the configured maximum delay.
+func (c *cerberusSvc) jitter(action SvcRecoveryAction) time.Duration {
+	if c.rnd == nil {
+		// Seed with the service name so the behaviour is reproducible across runs.
+		h := fnv.New64a()
+		h.Write([]byte(c.cfg.Name))
+		c.rnd = rand.New(rand.NewSource(int64(h.Sum64())))
+	}
+
+	jitter := time.Duration(c.rnd.Int63n(int64(action.Jitter)))
+	if maxDelay := time.Duration(action.MaxDelay) * time.Second; maxDelay > 0 && c.delay+jitter > maxDelay {
+		jitter = maxDelay - c.delay
+		if jitter < 0 {
+			jitter = 0
+		}
+	}
+	return jitter
+}
+
+func (c *cerberusSvc) closeJob() {
+	if c.job != 0 {
+		windows.CloseHandle(c.job)
+		c.job = 0
+	}
+}
+
+func (c *cerberusSvc) openLogs() (err error) {
+	if c.cfg.StdoutLog != "" && c.stdout == nil {
+		if c.stdout, err = openRotatingFile(c.cfg.StdoutLog, c.cfg.LogMaxSizeMB, c.cfg.LogMaxBackups); err != nil {
+			return fmt.Errorf("Failed to open stdout log: %v", err)
+		}
+	}
+
+	if c.cfg.StderrLog != "" && c.stderr == nil {
+		// Share the file if both outputs are written to the same log.
+		if c.cfg.StderrLog == c.cfg.StdoutLog {
+			c.stderr = c.stdout
+		} else if c.stderr, err = openRotatingFile(c.cfg.StderrLog, c.cfg.LogMaxSizeMB, c.cfg.LogMaxBackups); err != nil {
+			return fmt.Errorf("Failed to open stderr log: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *cerberusSvc) closeLogs() {
+	if c.stderr != nil && c.stderr != c.stdout {
+		c.stderr.Close()
+	}
+	if c.stdout != nil {
+		c.stdout.Close()
+	}
+	c.stdout, c.stderr = nil, nil
+}
+
+// checkPaths checks that the executable and the working directory are reachable, so an unavailable
+// network share is reported instead of the error of starting the process.
+func (c *cerberusSvc) checkPaths() error {
+	if fi, err := os.Stat(c.cfg.ExePath); err != nil {
+		if isUNCPath(c.cfg.ExePath) {
+			return fmt.Errorf("Executable '%v' on network share is unreachable: %v", c.cfg.ExePath, err)
+		}
+		return fmt.Errorf("Executable '%v' is unreachable: %v", c.cfg.ExePath, err)
+	} else if fi.IsDir() {
+		return fmt.Errorf("Executable '%v' is a directory", c.cfg.ExePath)
+	}
+
+	if c.cfg.WorkDir == "" {
+		return nil
+	}
+	if _, err := os.Stat(c.cfg.WorkDir); err != nil {
+		if isUNCPath(c.cfg.WorkDir) {
+			return fmt.Errorf("Working directory '%v' on network share is unreachable: %v", c.cfg.WorkDir, err)
+		}
+		return fmt.Errorf("Working directory '%v' is unreachable: %v", c.cfg.WorkDir, err)
+	}
+	return nil
+}
+
 func (c *cerberusSvc) runSvc() error {
-	c.cmd = &exec.Cmd{Path: c.cfg.ExePath, Dir: c.cfg.WorkDir, Args: append([]string{c.cfg.ExePath}, c.cfg.Args...), Env: append(os.Environ(), c.cfg.Env...)}
+	c.expandEnv()
+	c.closeJob()
+	// Reopen the logs on every (re)start, the previous process has already
+	// exited, so nothing writes to them anymore.
+	c.closeLogs()
+	if c.cfg.WorkDirCreate && c.cfg.WorkDir != "" {
+		if _, err := os.Stat(c.cfg.WorkDir); os.IsNotExist(err) {
+			c.log.Info(1, fmt.Sprintf("Creating working directory '%v'...", c.cfg.WorkDir))
+			if err := os.MkdirAll(c.cfg.WorkDir, 0755); err != nil {
+				return newErrorW(ErrRunService, "failed to create working directory '%v'", err, c.cfg.WorkDir)
+			}
+		}
+	}
+
+	if err := c.checkPaths(); err != nil {
+		return err
+	}
+
+	if err := c.openLogs(); err != nil {
+		return err
+	}
+
+	if c.cfg.PreStartCmd != "" {
+		c.log.Info(1, fmt.Sprintf("Running pre-start hook '%v'...", c.cfg.PreStartCmd))
+		out, err := runHook(c.cfg.PreStartCmd, c.cfg.PreStartArgs, c.cfg.WorkDir, append(inheritedEnv(c.cfg), c.cfg.Env...), c.cfg.preStartTimeout())
+		if len(out) > 0 {
+			c.log.Info(1, fmt.Sprintf("Pre-start hook output:\n%s", out))
+		}
+		if err != nil {
+			return fmt.Errorf("Pre-start hook failed: %v", err)
+		}
+	}
+
+	// The env file is read on every start, so changes take effect without reinstalling the service.
+	env := inheritedEnv(c.cfg)
+	if c.cfg.EnvFile != "" {
+		vars, err := loadEnvFile(c.cfg.EnvFile)
+		if err != nil {
+			return fmt.Errorf("Failed to load env file: %v", err)
+		}
+		env = append(env, vars...)
+	}
+
+	c.cmd = &exec.Cmd{Path: c.cfg.ExePath, Dir: c.cfg.WorkDir, Args: append([]string{c.cfg.ExePath}, c.cfg.Args...), Env: append(append(env, c.cfg.Env...), c.extraEnv...)}
+	if c.stdout != nil {
+		c.cmd.Stdout = c.stdout
+	}
+	if c.stderr != nil {
+		c.cmd.Stderr = c.stderr
+	}
+
+	// The file is opened on every start, so it can be a named pipe or be replaced between restarts.
+	if c.cfg.StdinFile != "" {
+		stdin, err := os.Open(c.cfg.StdinFile)
+		if err != nil {
+			return fmt.Errorf("Failed to open stdin file: %v", err)
+		}
+		// The process inherits its own handle of the file.
+		defer stdin.Close()
+		c.cmd.Stdin = stdin
+	}
+
 	if err := c.cmd.Start(); err != nil {
 		return fmt.Errorf("Failed to start service: %v", err)
 	}
 
+	if c.cfg.Priority != InheritPriority {
+		if err := setPriorityClass(uint32(c.cmd.Process.Pid), c.cfg.Priority); err != nil {
+			c.log.Warning(4, fmt.Sprintf("Failed to set process priority: %v", err))
+		}
+	}
+
+	if c.cfg.IOPriority != IOPriorityInherit {
+		if err := setIOPriority(uint32(c.cmd.Process.Pid), c.cfg.IOPriority); err != nil {
+			c.log.Warning(4, fmt.Sprintf("Failed to set i/o priority: %v", err))
+		}
+	}
+
+	if c.cfg.CPUAffinity != 0 {
+		if err := setAffinityMask(uint32(c.cmd.Process.Pid), c.cfg.CPUAffinity); err != nil {
+			c.log.Warning(4, fmt.Sprintf("Failed to set cpu affinity: %v", err))
+		}
+	}
+
+	if c.cfg.MemoryLimitMB > 0 || c.cfg.JobObject.enabled() {
+		job, err := createJobObject(uint32(c.cmd.Process.Pid), c.cfg.MemoryLimitMB, c.cfg.JobObject)
+		if err != nil {
+			c.log.Warning(4, fmt.Sprintf("Failed to create job object: %v", err))
+		}
+		c.job = job
+	}
+
+	if err := recordStart(c.cfg.Name, uint32(c.cmd.Process.Pid)); err != nil {
+		c.log.Warning(4, fmt.Sprintf("Failed to record service start: %v", err))
+	}
+
+	exited := make(chan struct{})
 	go func() {
-		c.done <- c.cmd.Wait()
+		err := c.cmd.Wait()
+		close(exited)
+		c.done <- err
 	}()
 
+	if c.cfg.JobObject.MaxHandles > 0 {
+		go c.watchHandles(c.cmd.Process, exited)
+	}
+
+	if c.cfg.WatchdogInterval > 0 {
+		go c.watchdog(c.cmd.Process, exited)
+	}
+
 	return nil
 }
+
+// handleCheckInterval is the interval the handle count of the executable is checked.
+const handleCheckInterval = 5 * time.Second
+
+// watchHandles terminates the process if it exceeds the configured handle limit,
+// the exit is handled like a crash, so the recovery actions apply.
+func (c *cerberusSvc) watchHandles(p *os.Process, exited <-chan struct{}) {
+	ticker := time.NewTicker(handleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+			count, err := processHandleCount(uint32(p.Pid))
+			if err != nil || count <= c.cfg.JobObject.MaxHandles {
+				continue
+			}
+			c.log.Error(3, fmt.Sprintf("Executable '%v' exceeded the handle limit (%v > %v), terminating...", c.cfg.ExePath, count, c.cfg.JobObject.MaxHandles))
+			p.Kill()
+			return
+		}
+	}
+}
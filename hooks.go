@@ -0,0 +1,49 @@
+package cerberus
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// runHook runs the given command synchronously and returns its combined output.
+// The env is the complete environment of the command, a timeout of zero lets
+// the command run until it exits.
+func runHook(program string, args []string, dir string, env []string, timeout time.Duration) ([]byte, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, program, args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return out, newErrorW(ErrTimeout, "hook '%v' didn't finish within %v", ctx.Err(), program, timeout)
+	}
+
+	return out, err
+}
+
+// runServiceHook runs a hook of the installation or removal of a service with the environment
+// of cerberus and the given KEY=VALUE variables. The output of a failed hook is part of the error.
+func runServiceHook(program string, args []string, vars ...string) error {
+	out, err := runHook(program, args, "", append(os.Environ(), vars...), 0)
+	if err == nil {
+		if len(out) > 0 {
+			DebugLogger.Printf("Hook output:\n%s", out)
+		}
+		return nil
+	}
+
+	if output := strings.TrimSpace(string(out)); output != "" {
+		return fmt.Errorf("%w, output:\n%v", err, output)
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package cerberus
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatingWriter writes to a log file which will be rotated as soon
+// as it exceeds the configured size. It is safe for concurrent use.
+type rotatingWriter struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// openRotatingFile opens or creates the log file at the given path. A maxSizeMB of zero
+// disables rotation and a maxBackups of zero keeps all rotated files.
+func openRotatingFile(path string, maxSizeMB uint64, maxBackups int) (*rotatingWriter, error) {
+	r := &rotatingWriter{path: path, maxSize: int64(maxSizeMB) * 1024 * 1024, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewRotatingWriter opens or creates the log file at the given path and returns a writer,
+// which rotates the file as soon as it exceeds maxSizeMB. Rotated files are renamed to
+// <basename>.<timestamp><ext> and only the latest maxBackups files are kept.
+func NewRotatingWriter(path string, maxSizeMB uint64, maxBackups int) (io.WriteCloser, error) {
+	return openRotatingFile(path, maxSizeMB, maxBackups)
+}
+
+func (r *rotatingWriter) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.file = f
+	r.size = fi.Size()
+	return nil
+}
+
+// Write implements the io.Writer interface.
+func (r *rotatingWriter) Write(p []byte) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close implements the io.Closer interface.
+func (r *rotatingWriter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file.Close()
+}
+
+// backupTimeFormat is the timestamp of the rotated files, which are named <basename>.<timestamp><ext>.
+const backupTimeFormat = "20060102-150405.000"
+
+// rotate renames the log file and opens a new one. If the file can't be renamed,
+// ex. because another process holds it open, the writer keeps writing to the
+// current file and the rotation is retried with the next write.
+func (r *rotatingWriter) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(r.path)
+	base := strings.TrimSuffix(r.path, ext)
+	if err := os.Rename(r.path, base+"."+time.Now().Format(backupTimeFormat)+ext); err != nil {
+		return r.open()
+	}
+
+	if r.maxBackups > 0 {
+		backups := r.backups(base, ext)
+		// The timestamp suffix ensures the lexical order is also the chronological one.
+		sort.Strings(backups)
+		for len(backups) > r.maxBackups {
+			os.Remove(backups[0])
+			backups = backups[1:]
+		}
+	}
+
+	return r.open()
+}
+
+// backups returns the rotated files of the log file, other files of the directory sharing
+// the base name like app.err.log and app.out.log are ignored.
+func (r *rotatingWriter) backups(base, ext string) []string {
+	files, _ := filepath.Glob(base + ".*" + ext)
+
+	var backups []string
+	for _, f := range files {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(f, base+"."), ext)
+		if _, err := time.Parse(backupTimeFormat, suffix); err == nil {
+			backups = append(backups, f)
+		}
+	}
+	return backups
+}
@@ -0,0 +1,215 @@
+package cerberus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows/svc/debug"
+)
+
+type jsonLogEntry struct {
+	Level string `json:"level"`
+	Ts    string `json:"ts"`
+	Msg   string `json:"msg"`
+}
+
+// LogField is structured data of a log message, like the service name or an error.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// Field returns a LogField with the given key and value.
+func Field(key string, value interface{}) LogField {
+	return LogField{Key: key, Value: value}
+}
+
+// jsonLogWriter converts every written log line into a JSON object.
+type jsonLogWriter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level string
+}
+
+// NewJSONLogWriter returns a writer for a log.Logger which emits every log line
+// as JSON object with the given level, ex. {"level":"info","ts":"<rfc3339>","msg":"..."}.
+// The logger should be created without prefix and flags.
+func NewJSONLogWriter(w io.Writer, level string) io.Writer {
+	return &jsonLogWriter{w: w, level: level}
+}
+
+// Write implements the io.Writer interface.
+func (j *jsonLogWriter) Write(p []byte) (n int, err error) {
+	if err := j.writeEntry(j.level, strings.TrimRight(string(p), "\r\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeEntry writes the message with the fields as separate keys, a key is only written once.
+func (j *jsonLogWriter) writeEntry(level, msg string, fields ...LogField) error {
+	data, err := json.Marshal(jsonLogEntry{
+		Level: level,
+		Ts:    time.Now().Format(time.RFC3339),
+		Msg:   msg,
+	})
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]bool{"level": true, "ts": true, "msg": true}
+	data = data[:len(data)-1]
+	for _, f := range fields {
+		if keys[f.Key] {
+			continue
+		}
+		keys[f.Key] = true
+
+		key, _ := json.Marshal(f.Key)
+		value, err := json.Marshal(fieldValue(f.Value))
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(f.Value))
+		}
+		data = append(append(append(append(data, ','), key...), ':'), value...)
+	}
+	data = append(data, '}', '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.w.Write(data)
+	return err
+}
+
+// fieldValue returns the text of errors and stringers, which don't marshal to JSON on their own.
+func fieldValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+// Logf logs the message like l.Printf with the values of the fields as arguments, fields after the ones
+// used by the format are only logged as JSON. If the logger writes JSON (see NewJSONLogWriter), the fields
+// are separate keys and the message contains their keys as placeholders instead of the values,
+// ex. {"level":"info","ts":"<rfc3339>","msg":"Starting service {service}...","service":"app"}.
+func Logf(l *log.Logger, format string, fields ...LogField) {
+	j, ok := l.Writer().(*jsonLogWriter)
+	if !ok {
+		l.Print(formatFields(format, fields, false))
+		return
+	}
+	if err := j.writeEntry(j.level, strings.TrimRight(formatFields(format, fields, true), "\r\n"), fields...); err != nil {
+		DebugLogger.Println("failed to write log entry:", err)
+	}
+}
+
+// LogError logs the error like l.Println. If the logger writes JSON, the message of a cerberus error is
+// logged with the whole error and its code as separate keys.
+func LogError(l *log.Logger, err error) {
+	j, ok := l.Writer().(*jsonLogWriter)
+	if !ok {
+		l.Println(err)
+		return
+	}
+
+	msg := err.Error()
+	fields := []LogField{Field("error", err)}
+	var e Error
+	if errors.As(err, &e) {
+		msg = e.Message
+		fields = append(fields, Field("error_code", int(e.Code)))
+	}
+	if werr := j.writeEntry(j.level, msg, fields...); werr != nil {
+		DebugLogger.Println("failed to write log entry:", werr)
+	}
+}
+
+// formatFields formats the message with the values of the fields used by the format,
+// or with their keys as placeholders.
+func formatFields(format string, fields []LogField, placeholders bool) string {
+	n := countVerbs(format)
+	if n > len(fields) {
+		n = len(fields)
+	}
+
+	args := make([]interface{}, n)
+	for i := range args {
+		if placeholders {
+			args[i] = "{" + fields[i].Key + "}"
+		} else {
+			args[i] = fields[i].Value
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// countVerbs counts the formatting verbs of the format, a literal percent sign isn't counted.
+func countVerbs(format string) int {
+	n := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		if i+1 < len(format) && format[i+1] == '%' {
+			i++
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// jsonLogger implements the debug.Log interface of a service run in an interactive session,
+// every message is emitted as JSON object with the name of the service.
+type jsonLogger struct {
+	name string
+	w    *jsonLogWriter
+}
+
+// newServiceLog returns the log of a service run in an interactive session, which writes
+// to stderr like debug.New and emits JSON if Logger does.
+func newServiceLog(name string) debug.Log {
+	if _, ok := Logger.Writer().(*jsonLogWriter); ok {
+		return &jsonLogger{name: name, w: &jsonLogWriter{w: os.Stderr}}
+	}
+	return debug.New(name)
+}
+
+// Close implements the debug.Log interface.
+func (l *jsonLogger) Close() error {
+	return nil
+}
+
+// Info implements the debug.Log interface.
+func (l *jsonLogger) Info(eid uint32, msg string) error {
+	return l.w.writeEntry("info", msg, Field("service", l.name), Field("event_id", eid))
+}
+
+// Warning implements the debug.Log interface.
+func (l *jsonLogger) Warning(eid uint32, msg string) error {
+	return l.w.writeEntry("warning", msg, Field("service", l.name), Field("event_id", eid))
+}
+
+// Error implements the debug.Log interface.
+func (l *jsonLogger) Error(eid uint32, msg string) error {
+	return l.w.writeEntry("error", msg, Field("service", l.name), Field("event_id", eid))
+}
+
+// logServiceError logs the error message to the service log like Logf, a jsonLogger emits
+// the fields as separate keys.
+func logServiceError(l debug.Log, eid uint32, format string, fields ...LogField) error {
+	if j, ok := l.(*jsonLogger); ok {
+		return j.w.writeEntry("error", formatFields(format, fields, true), append([]LogField{Field("service", j.name), Field("event_id", eid)}, fields...)...)
+	}
+	return l.Error(eid, formatFields(format, fields, false))
+}
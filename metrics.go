@@ -0,0 +1,88 @@
+package cerberus
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// metricsShutdownTimeout is the time running scrapes get to complete when the service stops.
+const metricsShutdownTimeout = 5 * time.Second
+
+// startMetrics starts the http server exposing the metrics of the service in the Prometheus
+// text format on localhost:<MetricsPort>/metrics, nothing is started if the port is zero.
+func (c *cerberusSvc) startMetrics() {
+	if c.cfg.MetricsPort == 0 {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", c.serveMetrics)
+	c.metrics = &http.Server{
+		Addr:              net.JoinHostPort("localhost", strconv.Itoa(int(c.cfg.MetricsPort))),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func(srv *http.Server) {
+		c.log.Info(1, fmt.Sprintf("Serving metrics on http://%v/metrics", srv.Addr))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			c.log.Warning(4, fmt.Sprintf("Failed to serve metrics: %v", err))
+		}
+	}(c.metrics)
+}
+
+// stopMetrics shuts the metrics server down, it may be called more than once.
+func (c *cerberusSvc) stopMetrics() {
+	if c.metrics == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+	if err := c.metrics.Shutdown(ctx); err != nil {
+		c.log.Warning(4, fmt.Sprintf("Failed to shutdown metrics server: %v", err))
+	}
+	c.metrics = nil
+}
+
+func (c *cerberusSvc) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	m, err := GetProcessMetrics(c.cfg.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var uptime float64
+	if m.Running() {
+		uptime = time.Since(m.StartTime).Seconds()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	label := fmt.Sprintf("{service=%q}", c.cfg.Name)
+	writeMetric(w, "cerberus_service_restart_total", "counter", "Number of restarts of the executable over all runs of the service.", label, float64(restartCount(c.cfg.Name)))
+	writeMetric(w, "cerberus_service_uptime_seconds", "gauge", "Time since the executable was started.", label, uptime)
+	writeMetric(w, "cerberus_process_rss_bytes", "gauge", "Working set of the executable.", label, float64(m.WorkingSet))
+	writeMetric(w, "cerberus_process_cpu_seconds_total", "counter", "User and kernel cpu time of the executable.", label, m.CPUTime().Seconds())
+}
+
+func writeMetric(w http.ResponseWriter, name, typ, help, label string, value float64) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n%v%v %v\n", name, help, name, typ, name, label, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// restartCount returns the cumulative restart count recorded by the service host.
+func restartCount(name string) uint64 {
+	key, err := registry.OpenKey(swRegRoot, swRegBaseKey+"\\"+name, registry.QUERY_VALUE)
+	if err != nil {
+		return 0
+	}
+	defer key.Close()
+
+	count, _, _ := key.GetIntegerValue("RestartCount")
+	return count
+}
@@ -0,0 +1,101 @@
+package cerberus
+
+// CurrentSchemaVersion is the schema version of configurations saved by this version of cerberus.
+// Increase it and append a migration to migrations whenever SvcConfig gains fields, which need
+// a default other than the zero value.
+const CurrentSchemaVersion = 2
+
+// migrations upgrade a configuration by one schema version, migrations[i]
+// upgrades a configuration from version i to i+1.
+var migrations = []func(cfg *SvcConfig){
+	// Configurations without a schema version may lack the maps, which were added later.
+	func(cfg *SvcConfig) {
+		if cfg.RecoveryActions == nil {
+			cfg.RecoveryActions = map[int]SvcRecoveryAction{}
+		}
+		if cfg.Labels == nil {
+			cfg.Labels = map[string]string{}
+		}
+	},
+	// Older versions passed the whole host environment to the executable.
+	func(cfg *SvcConfig) {
+		if len(cfg.InheritEnv) == 0 {
+			cfg.InheritEnvAll = true
+		}
+	},
+}
+
+// migrateConfig runs all migrations required to upgrade the configuration to
+// the current schema version and returns true if the configuration has changed.
+func migrateConfig(cfg *SvcConfig) bool {
+	if cfg.SchemaVersion >= CurrentSchemaVersion {
+		return false
+	}
+
+	if cfg.SchemaVersion < 0 {
+		cfg.SchemaVersion = 0
+	}
+	for v := cfg.SchemaVersion; v < CurrentSchemaVersion; v++ {
+		migrations[v](cfg)
+	}
+	cfg.SchemaVersion = CurrentSchemaVersion
+	return true
+}
+
+// loadStoredCfg loads the configuration from the storage and migrates it to the current schema version.
+// A migrated configuration is written back, failing to do so (ex. missing rights) isn't an error.
+func loadStoredCfg(name string) (*SvcConfig, error) {
+	return defaultManager.loadStoredCfg(name)
+}
+
+func (m *Manager) loadStoredCfg(name string) (*SvcConfig, error) {
+	cfg, err := m.storage().Load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	from := cfg.SchemaVersion
+	if migrateConfig(cfg) {
+		DebugLogger.Printf("Migrated configuration of service %v from schema version %v to %v\n", name, from, cfg.SchemaVersion)
+		if err := m.storage().Save(*cfg); err != nil {
+			DebugLogger.Printf("Failed to save migrated configuration of service %v: %v\n", name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// MigrationResult is the result of migrating a single service configuration.
+type MigrationResult struct {
+	Name        string
+	FromVersion int
+	ToVersion   int
+	Err         error
+}
+
+// MigrateServices upgrades the stored configurations of all services to the current schema version.
+// Only the configuration in the storage is changed, the services and their SCM properties are untouched.
+// Services which are already up to date are not part of the result.
+func MigrateServices() ([]MigrationResult, error) {
+	names, err := ConfigStorage.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []MigrationResult
+	for _, name := range names {
+		cfg, err := ConfigStorage.Load(name)
+		if err != nil {
+			results = append(results, MigrationResult{Name: name, Err: err})
+			continue
+		}
+
+		res := MigrationResult{Name: name, FromVersion: cfg.SchemaVersion}
+		if !migrateConfig(cfg) {
+			continue
+		}
+		res.ToVersion = cfg.SchemaVersion
+		res.Err = ConfigStorage.Save(*cfg)
+		results = append(results, res)
+	}
+	return results, nil
+}
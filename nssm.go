@@ -0,0 +1,193 @@
+package cerberus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// nssmParametersKey is the registry key below HKLM where NSSM stores the parameters of a service.
+const nssmParametersKey = `SYSTEM\CurrentControlSet\Services\%v\Parameters`
+
+// NSSM skips the stop methods set in AppStopMethodSkip.
+const (
+	nssmSkipConsole = 1 << iota
+	nssmSkipWindow
+	nssmSkipThreads
+)
+
+// ImportFromNSSM reads the configuration of the service with the given name managed by NSSM and returns
+// it as cerberus configuration, which can be passed to InstallService. The NSSM service must be removed
+// before a cerberus service with the same name can be installed. Passwords can't be read, a service user
+// which requires a password must be set again before installing.
+//
+// The exit actions of NSSM are mapped to recovery actions: Restart restarts the executable after
+// AppRestartDelay, Exit and Ignore stop the service gracefully and Suicide stops the service with an error.
+func ImportFromNSSM(name string) (*SvcConfig, error) {
+	return defaultManager.ImportFromNSSM(name)
+}
+
+// ImportFromNSSM reads the configuration of the NSSM service like the package level ImportFromNSSM,
+// the properties of the service are read from the service control manager of the manager.
+func (m *Manager) ImportFromNSSM(name string) (*SvcConfig, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, fmt.Sprintf(nssmParametersKey, name), registry.QUERY_VALUE)
+	if err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "service %v is not managed by NSSM", err, name)
+	}
+	defer key.Close()
+
+	cfg := &SvcConfig{Name: name, StopSignal: CtrlCSignal | WmCloseSignal | WmQuitSignal}
+	if cfg.ExePath, err = nssmString(key, "Application"); err != nil || cfg.ExePath == "" {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to read application of NSSM service %v", err, name)
+	}
+	cfg.WorkDir, _ = nssmString(key, "AppDirectory")
+	cfg.StdoutLog, _ = nssmString(key, "AppStdout")
+	cfg.StderrLog, _ = nssmString(key, "AppStderr")
+
+	params, _ := nssmString(key, "AppParameters")
+	if cfg.Args, err = splitCommandLine(params); err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to parse parameters of NSSM service %v", err, name)
+	}
+	cfg.Env, _, _ = key.GetStringsValue("AppEnvironmentExtra")
+
+	if skip, _, err := key.GetIntegerValue("AppStopMethodSkip"); err == nil {
+		if skip&nssmSkipConsole != 0 {
+			cfg.StopSignal &^= CtrlCSignal
+		}
+		if skip&nssmSkipWindow != 0 {
+			cfg.StopSignal &^= WmCloseSignal
+		}
+		if skip&nssmSkipThreads != 0 {
+			cfg.StopSignal &^= WmQuitSignal
+		}
+	}
+
+	delay, _, _ := key.GetIntegerValue("AppRestartDelay")
+	if cfg.RecoveryActions, err = nssmExitActions(name, time.Duration(delay)*time.Millisecond); err != nil {
+		return nil, err
+	}
+
+	if err := m.importSCMConfig(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// nssmExitActions maps the AppExit key of the NSSM service to recovery actions.
+func nssmExitActions(name string, delay time.Duration) (map[int]SvcRecoveryAction, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, fmt.Sprintf(nssmParametersKey, name)+`\AppExit`, registry.QUERY_VALUE)
+	if err == registry.ErrNotExist {
+		// NSSM restarts the application by default.
+		return map[int]SvcRecoveryAction{AnyExitCode: nssmRecoveryAction(AnyExitCode, "Restart", delay)}, nil
+	}
+	if err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to read exit actions of NSSM service %v", err, name)
+	}
+	defer key.Close()
+
+	names, err := key.ReadValueNames(-1)
+	if err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to read exit actions of NSSM service %v", err, name)
+	}
+
+	actions := map[int]SvcRecoveryAction{}
+	for _, n := range names {
+		code := AnyExitCode
+		if n != "" {
+			if code, err = strconv.Atoi(n); err != nil {
+				logWarnings([]Warning{newWarning(ErrLoadServiceCfg, "ignoring exit action '%v' of NSSM service %v, it isn't an exit code", n, name)})
+				continue
+			}
+		}
+
+		action, _, _ := key.GetStringValue(n)
+		// Suicide stops the service with an error, which is the behaviour without a recovery action.
+		if strings.EqualFold(action, "Suicide") {
+			continue
+		}
+		actions[code] = nssmRecoveryAction(code, action, delay)
+	}
+	return actions, nil
+}
+
+func nssmRecoveryAction(code int, action string, delay time.Duration) SvcRecoveryAction {
+	if !strings.EqualFold(action, "Restart") {
+		return SvcRecoveryAction{ExitCode: code, Action: NoAction}
+	}
+	return SvcRecoveryAction{ExitCode: code, Action: RestartAction, Delay: int(delay.Round(time.Second) / time.Second)}
+}
+
+// nssmString reads a string value, environment variables of expandable strings are expanded.
+func nssmString(key registry.Key, name string) (string, error) {
+	value, typ, err := key.GetStringValue(name)
+	if err != nil || typ != registry.EXPAND_SZ {
+		return value, err
+	}
+	return registry.ExpandString(value)
+}
+
+// importSCMConfig copies the properties of the already installed service with the name of the
+// configuration from the SCM, so an imported service keeps its display name, user and start type.
+func (m *Manager) importSCMConfig(cfg *SvcConfig) error {
+	manager, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer manager.Disconnect()
+
+	s, err := manager.OpenService(cfg.Name)
+	if err != nil {
+		return newErrorW(ErrLoadServiceCfg, "failed to open service %v", err, cfg.Name)
+	}
+	defer s.Close()
+
+	scmCfg, err := s.Config()
+	if err != nil {
+		return newErrorW(ErrLoadServiceCfg, "failed to get service configuration from scm", err)
+	}
+
+	cfg.DisplayName = scmCfg.DisplayName
+	cfg.Desc = scmCfg.Description
+	cfg.Dependencies = scmCfg.Dependencies
+	if !isLocalSystem(scmCfg.ServiceStartName) {
+		cfg.ServiceUser = scmCfg.ServiceStartName
+		cfg.UseVirtualAccount = strings.EqualFold(scmCfg.ServiceStartName, VirtualAccountName(cfg.Name))
+		cfg.UseGMSA = strings.HasSuffix(scmCfg.ServiceStartName, "$")
+	}
+	if scmCfg.DelayedAutoStart && StartType(scmCfg.StartType) == AutoStartType {
+		cfg.StartType = AutoDelayedStartType
+	} else {
+		cfg.StartType = StartType(scmCfg.StartType)
+	}
+	return nil
+}
+
+// splitCommandLine splits the command line into arguments like the windows runtime does.
+func splitCommandLine(cmdLine string) ([]string, error) {
+	if strings.TrimSpace(cmdLine) == "" {
+		return nil, nil
+	}
+
+	// The program name is parsed with different rules, so a placeholder is passed as program.
+	p, err := windows.UTF16PtrFromString("cerberus " + cmdLine)
+	if err != nil {
+		return nil, err
+	}
+	var argc int32
+	argv, err := windows.CommandLineToArgv(p, &argc)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(argv)))
+
+	args := make([]string, 0, argc-1)
+	for _, arg := range argv[1:argc] {
+		args = append(args, windows.UTF16PtrToString(&arg[0]))
+	}
+	return args, nil
+}
@@ -0,0 +1,95 @@
+//go:build cerberus_otel
+
+package cerberus
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OtelEndpointEnv is the environment variable with the endpoint of the OTLP/HTTP collector the spans
+// are exported to (ex. http://localhost:4318). If it isn't set, the spans are passed to the global
+// tracer provider, which can be configured by programs using cerberus as library.
+const OtelEndpointEnv = "CERBERUS_OTEL_ENDPOINT"
+
+const tracerName = "github.com/go-sharp/cerberus/v2"
+
+func init() {
+	endpoint := os.Getenv(OtelEndpointEnv)
+	if endpoint != "" {
+		if err := setupOtelExporter(endpoint); err != nil {
+			DebugLogger.Println("failed to setup OpenTelemetry exporter:", err)
+		}
+	}
+
+	traceOperation = func(ctx context.Context, operation, name string) (context.Context, func(err error)) {
+		ctx, span := otel.Tracer(tracerName).Start(ctx, "cerberus."+operation, trace.WithAttributes(
+			attribute.String("service.name", name),
+			attribute.String("cerberus.operation", operation),
+		))
+
+		return ctx, func(err error) {
+			span.SetAttributes(attribute.Int("cerberus.exit_code", exitCode(err)))
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	}
+}
+
+// setupOtelExporter installs a tracer provider exporting to the OTLP/HTTP endpoint as global provider.
+// The spans are exported when they end, as the cerberus cli exits right after the operation.
+func setupOtelExporter(endpoint string) error {
+	opts := []otlptracehttp.Option{}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return newErrorW(ErrGeneric, "invalid %v '%v'", err, OtelEndpointEnv, endpoint)
+	}
+	opts = append(opts, otlptracehttp.WithEndpoint(u.Host))
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if u.Path != "" && u.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return newErrorW(ErrGeneric, "failed to create OTLP exporter", err)
+	}
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithResource(resource.Default()),
+	))
+	return nil
+}
+
+// exitCode returns the error code of a cerberus error, 1 for any other error and 0 if the operation succeeded.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var e Error
+	if errors.As(err, &e) {
+		return int(e.Code)
+	}
+	return 1
+}
@@ -0,0 +1,229 @@
+package cerberus
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32 = windows.NewLazySystemDLL("kernel32.dll")
+	ntdll    = windows.NewLazySystemDLL("ntdll.dll")
+
+	procNtSetInformationProcess = ntdll.NewProc("NtSetInformationProcess")
+
+	procSetPriorityClass       = kernel32.NewProc("SetPriorityClass")
+	procSetProcessAffinityMask = kernel32.NewProc("SetProcessAffinityMask")
+	procGetProcessAffinityMask = kernel32.NewProc("GetProcessAffinityMask")
+	procGetProcessMemoryInfo   = kernel32.NewProc("K32GetProcessMemoryInfo")
+	procGetProcessHandleCount  = kernel32.NewProc("GetProcessHandleCount")
+)
+
+// Flags of JOBOBJECT_CPU_RATE_CONTROL_INFORMATION.
+const (
+	jobObjectCPURateControlEnable  = 0x1
+	jobObjectCPURateControlHardCap = 0x4
+)
+
+// jobObjectCPURateControlInformation mirrors JOBOBJECT_CPU_RATE_CONTROL_INFORMATION.
+type jobObjectCPURateControlInformation struct {
+	ControlFlags uint32
+	// CpuRate in 1/100 percent, the union member used with a hard cap.
+	CPURate uint32
+}
+
+// processMemoryCounters mirrors PROCESS_MEMORY_COUNTERS.
+type processMemoryCounters struct {
+	cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// setPriorityClass sets the priority class of the process with the given pid.
+func setPriorityClass(pid uint32, priority ProcessPriority) error {
+	h, err := windows.OpenProcess(windows.PROCESS_SET_INFORMATION, false, pid)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+
+	if r, _, err := procSetPriorityClass.Call(uintptr(h), uintptr(priority)); r == 0 {
+		return err
+	}
+	return nil
+}
+
+// processIoPriority is the PROCESSINFOCLASS of the i/o priority.
+const processIoPriority = 33
+
+// setIOPriority sets the i/o priority of the process with the given pid.
+func setIOPriority(pid uint32, priority IOPriority) error {
+	h, err := windows.OpenProcess(windows.PROCESS_SET_INFORMATION, false, pid)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+
+	// The native values start with very low at 0.
+	value := uint32(priority - IOPriorityVeryLow)
+	if status, _, _ := procNtSetInformationProcess.Call(uintptr(h), processIoPriority,
+		uintptr(unsafe.Pointer(&value)), unsafe.Sizeof(value)); status != 0 {
+		return fmt.Errorf("NtSetInformationProcess failed with status %#x", status)
+	}
+	return nil
+}
+
+// setAffinityMask sets the cpu affinity mask of the process with the given pid.
+func setAffinityMask(pid uint32, mask uint64) error {
+	h, err := windows.OpenProcess(windows.PROCESS_SET_INFORMATION|windows.PROCESS_QUERY_INFORMATION, false, pid)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+
+	if r, _, err := procSetProcessAffinityMask.Call(uintptr(h), uintptr(mask)); r == 0 {
+		return err
+	}
+	return nil
+}
+
+// systemAffinityMask returns the mask of the processors configured on the system.
+func systemAffinityMask() (uint64, error) {
+	var processMask, systemMask uintptr
+	r, _, err := procGetProcessAffinityMask.Call(uintptr(windows.CurrentProcess()),
+		uintptr(unsafe.Pointer(&processMask)), uintptr(unsafe.Pointer(&systemMask)))
+	if r == 0 {
+		return 0, err
+	}
+	return uint64(systemMask), nil
+}
+
+// processTimes returns the creation time and the consumed cpu time (user and kernel)
+// of the process with the given pid.
+func processTimes(pid uint32) (time.Time, time.Duration, error) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	defer windows.CloseHandle(h)
+
+	var created, exited, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(h, &created, &exited, &kernel, &user); err != nil {
+		return time.Time{}, 0, err
+	}
+
+	// Kernel and user times are durations in 100-nanosecond units.
+	cpu := time.Duration((uint64(kernel.HighDateTime)<<32|uint64(kernel.LowDateTime))+
+		(uint64(user.HighDateTime)<<32|uint64(user.LowDateTime))) * 100
+	return time.Unix(0, created.Nanoseconds()), cpu, nil
+}
+
+// processMetrics returns the cpu times, memory usage and handle count of the process with the given pid.
+func processMetrics(pid uint32) (ProcessMetrics, error) {
+	m := ProcessMetrics{PID: pid}
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return m, err
+	}
+	defer windows.CloseHandle(h)
+
+	var created, exited, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(h, &created, &exited, &kernel, &user); err != nil {
+		return m, err
+	}
+	// Kernel and user times are durations in 100-nanosecond units.
+	m.StartTime = time.Unix(0, created.Nanoseconds())
+	m.KernelTime = time.Duration(uint64(kernel.HighDateTime)<<32|uint64(kernel.LowDateTime)) * 100
+	m.UserTime = time.Duration(uint64(user.HighDateTime)<<32|uint64(user.LowDateTime)) * 100
+
+	counters := processMemoryCounters{}
+	counters.cb = uint32(unsafe.Sizeof(counters))
+	if r, _, err := procGetProcessMemoryInfo.Call(uintptr(h), uintptr(unsafe.Pointer(&counters)), uintptr(counters.cb)); r == 0 {
+		return m, err
+	}
+	m.WorkingSet = uint64(counters.WorkingSetSize)
+	m.PeakWorkingSet = uint64(counters.PeakWorkingSetSize)
+
+	if r, _, err := procGetProcessHandleCount.Call(uintptr(h), uintptr(unsafe.Pointer(&m.HandleCount))); r == 0 {
+		return m, err
+	}
+	return m, nil
+}
+
+// createJobObject creates a job object with the given memory limit and job configuration
+// and assigns the process with the given pid to it. The returned handle must be kept open
+// as long as the process is running, closing it kills the process if KillOnJobClose is set.
+func createJobObject(pid uint32, memoryLimitMB uint64, cfg JobObjectConfig) (windows.Handle, error) {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	if memoryLimitMB > 0 {
+		info.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_PROCESS_MEMORY
+		info.ProcessMemoryLimit = uintptr(memoryLimitMB * 1024 * 1024)
+	}
+	if cfg.MaxProcesses > 0 {
+		info.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_ACTIVE_PROCESS
+		info.BasicLimitInformation.ActiveProcessLimit = cfg.MaxProcesses
+	}
+	if cfg.KillOnJobClose {
+		info.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	}
+	if _, err := windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		windows.CloseHandle(job)
+		return 0, err
+	}
+
+	if cfg.CPURatePercent > 0 {
+		rate := jobObjectCPURateControlInformation{
+			ControlFlags: jobObjectCPURateControlEnable | jobObjectCPURateControlHardCap,
+			CPURate:      cfg.CPURatePercent * 100,
+		}
+		if _, err := windows.SetInformationJobObject(job, windows.JobObjectCpuRateControlInformation,
+			uintptr(unsafe.Pointer(&rate)), uint32(unsafe.Sizeof(rate))); err != nil {
+			windows.CloseHandle(job)
+			return 0, err
+		}
+	}
+
+	h, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, pid)
+	if err != nil {
+		windows.CloseHandle(job)
+		return 0, err
+	}
+	defer windows.CloseHandle(h)
+
+	if err := windows.AssignProcessToJobObject(job, h); err != nil {
+		windows.CloseHandle(job)
+		return 0, err
+	}
+
+	return job, nil
+}
+
+// processHandleCount returns the number of open handles of the process with the given pid.
+func processHandleCount(pid uint32) (uint32, error) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(h)
+
+	var count uint32
+	if r, _, err := procGetProcessHandleCount.Call(uintptr(h), uintptr(unsafe.Pointer(&count))); r == 0 {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,115 @@
+package cerberus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// ExportRegFile writes a .reg file with the registry keys of the given services, which can be
+// imported with "regedit /s". Only the cerberus specific properties are part of the file, the
+// services itself must still be installed. The file is encoded as UTF-16LE like regedit does.
+func ExportRegFile(names []string, w io.Writer) error {
+	if _, ok := ConfigStorage.(RegistryStorage); !ok {
+		return newError(ErrGeneric, "reg export requires the registry storage")
+	}
+
+	var b strings.Builder
+	b.WriteString("Windows Registry Editor Version 5.00\r\n")
+	for _, name := range names {
+		if err := writeRegKey(&b, swRegBaseKey+"\\"+name); err != nil {
+			return newErrorW(ErrGeneric, "failed to export service '%v'", err, name)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	// Byte order mark
+	bw.Write([]byte{0xFF, 0xFE})
+	for _, c := range utf16.Encode([]rune(b.String())) {
+		bw.Write([]byte{byte(c), byte(c >> 8)})
+	}
+	if err := bw.Flush(); err != nil {
+		return newErrorW(ErrGeneric, "failed to write reg file", err)
+	}
+	return nil
+}
+
+func writeRegKey(b *strings.Builder, path string) error {
+	key, err := registry.OpenKey(swRegRoot, path, registry.QUERY_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	names, err := key.ReadValueNames(-1)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(b, "\r\n[%v\\%v]\r\n", regRootName(), path)
+	for _, name := range names {
+		n, typ, err := key.GetValue(name, nil)
+		if err != nil {
+			return err
+		}
+		data := make([]byte, n)
+		if _, _, err := key.GetValue(name, data); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(b, "%v=", regQuote(name))
+		switch typ {
+		case registry.SZ:
+			s, _, err := key.GetStringValue(name)
+			if err != nil {
+				return err
+			}
+			b.WriteString(regQuote(s))
+		case registry.DWORD:
+			fmt.Fprintf(b, "dword:%08x", binary.LittleEndian.Uint32(data))
+		case registry.BINARY:
+			b.WriteString("hex:" + regHex(data))
+		case registry.EXPAND_SZ:
+			b.WriteString("hex(2):" + regHex(data))
+		case registry.MULTI_SZ:
+			b.WriteString("hex(7):" + regHex(data))
+		case registry.QWORD:
+			b.WriteString("hex(b):" + regHex(data))
+		default:
+			fmt.Fprintf(b, "hex(%x):%v", typ, regHex(data))
+		}
+		b.WriteString("\r\n")
+	}
+	return nil
+}
+
+func regRootName() string {
+	switch swRegRoot {
+	case registry.CURRENT_USER:
+		return "HKEY_CURRENT_USER"
+	case registry.USERS:
+		return "HKEY_USERS"
+	default:
+		return "HKEY_LOCAL_MACHINE"
+	}
+}
+
+// regQuote quotes a string value, backslashes and quotes must be escaped.
+func regQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func regHex(data []byte) string {
+	parts := make([]string, len(data))
+	for i, c := range data {
+		parts[i] = fmt.Sprintf("%02x", c)
+	}
+	return strings.Join(parts, ",")
+}
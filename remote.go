@@ -0,0 +1,130 @@
+package cerberus
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// scmComputer is the computer whose service control manager is used, empty for the local computer.
+var scmComputer string
+
+// SetComputer selects the computer whose service control manager is used by all following calls, an empty
+// name selects the local computer. The configurations are still stored on the local computer, a copy of the
+// configuration is written to the registry of the remote computer, where the service host reads it from.
+// The cerberus executable must be installed at the same path on the remote computer.
+func SetComputer(name string) {
+	scmComputer = localComputer(strings.TrimPrefix(name, `\\`))
+}
+
+// sameComputer reports whether both names refer to the same computer.
+func sameComputer(a, b string) bool {
+	return strings.EqualFold(localComputer(a), localComputer(b))
+}
+
+// localComputer returns an empty name if the name refers to the local computer.
+func localComputer(name string) string {
+	switch {
+	case name == "" || name == "." || strings.EqualFold(name, "localhost"):
+		return ""
+	case strings.EqualFold(name, os.Getenv("COMPUTERNAME")):
+		return ""
+	}
+	return name
+}
+
+func computerName(name string) string {
+	if localComputer(name) == "" {
+		return "the local computer"
+	}
+	return name
+}
+
+// openLocalMachine opens the HKEY_LOCAL_MACHINE key of the computer, the local one if empty.
+// The key must be closed with closeLocalMachine.
+func openLocalMachine(computer string) (registry.Key, error) {
+	if computer == "" {
+		return registry.LOCAL_MACHINE, nil
+	}
+	return registry.OpenRemoteKey(computer, registry.LOCAL_MACHINE)
+}
+
+func closeLocalMachine(computer string, key registry.Key) {
+	if computer != "" {
+		key.Close()
+	}
+}
+
+// saveRemoteCfg writes the cerberus specific properties to the registry of the remote computer,
+// the service host reads them from there like the configuration of a local service.
+func saveRemoteCfg(config SvcConfig) error {
+	root, err := openLocalMachine(config.Computer)
+	if err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to open registry of %v", err, config.Computer)
+	}
+	defer closeLocalMachine(config.Computer, root)
+
+	key, _, err := registry.CreateKey(root, swRegBaseKey+"\\"+config.Name, registry.CREATE_SUB_KEY|registry.WRITE)
+	if err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to create registry entry on %v", err, config.Computer)
+	}
+	defer key.Close()
+
+	computer := config.Computer
+	config.Computer = ""
+	if err := writeSvcCfgRegistry(key, config); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to write configuration to %v", err, computer)
+	}
+	return nil
+}
+
+// deleteRemoteCfg removes the copy of the configuration from the registry of the remote computer.
+func deleteRemoteCfg(computer, name string) error {
+	root, err := openLocalMachine(computer)
+	if err != nil {
+		return err
+	}
+	defer closeLocalMachine(computer, root)
+
+	return registry.DeleteKey(root, swRegBaseKey+"\\"+name)
+}
+
+// installRemoteEventSource registers the event source of the service on the remote computer
+// the same way eventlog.InstallAsEventCreate does on the local computer.
+func installRemoteEventSource(computer, name string) error {
+	root, err := openLocalMachine(computer)
+	if err != nil {
+		return err
+	}
+	defer closeLocalMachine(computer, root)
+
+	key, exists, err := registry.CreateKey(root, eventSourcesKey+"\\"+name, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	if exists {
+		return newError(ErrGeneric, "event source %v already exists on %v", name, computer)
+	}
+
+	if err := key.SetExpandStringValue("EventMessageFile", `%SystemRoot%\System32\EventCreate.exe`); err != nil {
+		return err
+	}
+	if err := key.SetDWordValue("TypesSupported", eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		return err
+	}
+	return key.SetDWordValue("CustomSource", 1)
+}
+
+// removeRemoteEventSource removes the event source of the service from the remote computer.
+func removeRemoteEventSource(computer, name string) error {
+	root, err := openLocalMachine(computer)
+	if err != nil {
+		return err
+	}
+	defer closeLocalMachine(computer, root)
+
+	return registry.DeleteKey(root, eventSourcesKey+"\\"+name)
+}
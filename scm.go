@@ -0,0 +1,285 @@
+package cerberus
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// SCMClient is the part of the service control manager used by cerberus, see SCMConnector.
+type SCMClient interface {
+	CreateService(name, exepath string, c mgr.Config, args ...string) (SCMService, error)
+	OpenService(name string) (SCMService, error)
+	ListServices() ([]string, error)
+	Disconnect() error
+	// InstallEventSource registers the event log source of the service.
+	InstallEventSource(name string) error
+	// RemoveEventSource removes the event log source of the service.
+	RemoveEventSource(name string) error
+}
+
+// SCMService is the part of a service of the service control manager used by cerberus.
+type SCMService interface {
+	Name() string
+	Config() (mgr.Config, error)
+	UpdateConfig(c mgr.Config) error
+	Query() (svc.Status, error)
+	Control(c svc.Cmd) (svc.Status, error)
+	Start(args ...string) error
+	Delete() error
+	Close() error
+	// DACL returns the DACL of the service as SDDL string.
+	DACL() (string, error)
+	// SetDACL replaces the DACL of the service with the DACL of the SDDL string.
+	SetDACL(sddl string) error
+	// RequiredPrivileges returns the privileges the service process is restricted to.
+	RequiredPrivileges() ([]string, error)
+	// SetRequiredPrivileges restricts the privileges of the service process, an empty list removes the restriction.
+	SetRequiredPrivileges(privileges []string) error
+	// SetEnvironment sets the environment variables (KEY=VALUE) the SCM passes to the service process.
+	SetEnvironment(env []string) error
+}
+
+// SCMConnector connects to the service control manager used by the package level functions. Per default
+// it connects to the windows SCM with the configured retries. It can be replaced to use cerberus without
+// a real SCM, but not while cerberus functions are running. Use a Manager with its own client instead,
+// ex. in parallel tests with cerberustest.FakeSCMClient.
+var SCMConnector = func() (SCMClient, error) {
+	manager, err := connectWithRetry(scmComputer, scmMaxAttempts, scmRetryDelay)
+	if err != nil {
+		return nil, err
+	}
+	return windowsSCM{manager, scmComputer}, nil
+}
+
+// windowsSCM is the SCMClient of the windows service control manager.
+type windowsSCM struct {
+	*mgr.Mgr
+	computer string
+}
+
+func (m windowsSCM) CreateService(name, exepath string, c mgr.Config, args ...string) (SCMService, error) {
+	s, err := m.Mgr.CreateService(name, exepath, c, args...)
+	if err != nil {
+		return nil, err
+	}
+	return windowsService{s, m.computer}, nil
+}
+
+func (m windowsSCM) OpenService(name string) (SCMService, error) {
+	s, err := m.Mgr.OpenService(name)
+	if err != nil {
+		return nil, err
+	}
+	return windowsService{s, m.computer}, nil
+}
+
+func (m windowsSCM) InstallEventSource(name string) error {
+	if m.computer != "" {
+		return installRemoteEventSource(m.computer, name)
+	}
+	return eventlog.InstallAsEventCreate(name, eventlog.Error|eventlog.Info|eventlog.Warning)
+}
+
+func (m windowsSCM) RemoveEventSource(name string) error {
+	if m.computer != "" {
+		return removeRemoteEventSource(m.computer, name)
+	}
+	return eventlog.Remove(name)
+}
+
+// windowsService is the SCMService of a service of the windows service control manager.
+type windowsService struct {
+	*mgr.Service
+	computer string
+}
+
+func (s windowsService) Name() string {
+	return s.Service.Name
+}
+
+func (s windowsService) DACL() (string, error) {
+	return queryServiceACL(s.Service)
+}
+
+func (s windowsService) SetDACL(sddl string) error {
+	return setServiceACL(s.Service, sddl)
+}
+
+func (s windowsService) RequiredPrivileges() ([]string, error) {
+	return queryRequiredPrivileges(s.Service)
+}
+
+func (s windowsService) SetRequiredPrivileges(privileges []string) error {
+	return setRequiredPrivileges(s.Service, privileges)
+}
+
+func (s windowsService) SetEnvironment(env []string) error {
+	root, err := openLocalMachine(s.computer)
+	if err != nil {
+		return err
+	}
+	defer closeLocalMachine(s.computer, root)
+
+	key, err := registry.OpenKey(root, "SYSTEM\\CurrentControlSet\\Services\\"+s.Service.Name, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	return key.SetStringsValue("Environment", env)
+}
+
+// Defaults for connecting to the SCM, they can be changed with the
+// CERBERUS_SCM_MAX_RETRIES and CERBERUS_SCM_RETRY_DELAY environment variables.
+const (
+	DefaultSCMMaxAttempts = 3
+	DefaultSCMRetryDelay  = 500 * time.Millisecond
+)
+
+var scmMaxAttempts, scmRetryDelay = scmRetryFromEnv()
+
+func scmRetryFromEnv() (int, time.Duration) {
+	attempts, delay := DefaultSCMMaxAttempts, DefaultSCMRetryDelay
+	if v := os.Getenv("CERBERUS_SCM_MAX_RETRIES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			attempts = n
+		} else {
+			Logf(Logger, "Invalid CERBERUS_SCM_MAX_RETRIES '%v', using %v...\n", Field("value", v), Field("attempts", attempts), Field("variable", "CERBERUS_SCM_MAX_RETRIES"))
+		}
+	}
+	if v := os.Getenv("CERBERUS_SCM_RETRY_DELAY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			delay = d
+		} else {
+			Logf(Logger, "Invalid CERBERUS_SCM_RETRY_DELAY '%v', using %v...\n", Field("value", v), Field("delay", delay), Field("variable", "CERBERUS_SCM_RETRY_DELAY"))
+		}
+	}
+	return attempts, delay
+}
+
+// connectSCM connects to the service control manager with the SCMConnector.
+func connectSCM() (SCMClient, error) {
+	return SCMConnector()
+}
+
+// Manager installs, updates, removes, loads and controls services with its own service control manager client and
+// configuration storage, so managers with different clients can be used concurrently (ex. in parallel tests).
+// The package level functions use a Manager with the SCMConnector and the ConfigStorage. The statistics
+// recorded by the service host are always read from the registry.
+type Manager struct {
+	// Client is the service control manager of the manager, it isn't disconnected by the manager.
+	// If nil, a connection is opened with the SCMConnector for every operation.
+	Client SCMClient
+	// Storage stores the configurations of the manager, the ConfigStorage is used if nil.
+	Storage Storage
+}
+
+// NewManager returns a Manager using the client and the storage.
+func NewManager(client SCMClient, storage Storage) *Manager {
+	return &Manager{Client: client, Storage: storage}
+}
+
+var defaultManager = &Manager{}
+
+// InstallService installs a cerberus service like InstallServiceContext.
+func (m *Manager) InstallService(ctx context.Context, config SvcConfig) error {
+	return m.installService(ctx, config, installOptions)
+}
+
+// UpdateService updates a cerberus service like UpdateServiceContext.
+func (m *Manager) UpdateService(ctx context.Context, config SvcConfig) error {
+	return m.updateService(ctx, config)
+}
+
+// RemoveService removes the service like RemoveServiceWithOptions.
+func (m *Manager) RemoveService(ctx context.Context, name string, opts RemoveOptions) error {
+	res := m.removeService(ctx, name, opts)
+	logWarnings(res.Warnings)
+	return res.Err
+}
+
+// LoadServiceCfg loads the configuration of the service like the package level LoadServiceCfg.
+func (m *Manager) LoadServiceCfg(name string) (*SvcConfig, error) {
+	DebugLogger.Println("Loading service configuration for " + name + "...")
+	if name == "" {
+		return nil, newError(ErrLoadServiceCfg, "empty service name is not allowed")
+	}
+
+	manager, err := m.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer manager.Disconnect()
+
+	return m.loadServiceCfg(manager, name, nil)
+}
+
+// connect returns the client of the manager or connects with the SCMConnector.
+func (m *Manager) connect() (SCMClient, error) {
+	if m.Client != nil {
+		return sharedClient{m.Client}, nil
+	}
+	return connectSCM()
+}
+
+// storage returns the storage of the manager or the ConfigStorage.
+func (m *Manager) storage() Storage {
+	if m.Storage != nil {
+		return m.Storage
+	}
+	return ConfigStorage
+}
+
+// sharedClient is a client owned by the caller of a Manager, it isn't disconnected after an operation.
+type sharedClient struct {
+	SCMClient
+}
+
+func (sharedClient) Disconnect() error {
+	return nil
+}
+
+// connectWithRetry connects to the service control manager of the computer, the local one if empty. The SCM
+// can briefly be unavailable during boot or under heavy load. Failed attempts are retried with exponential
+// backoff and jitter.
+func connectWithRetry(computer string, maxAttempts int, baseDelay time.Duration) (*mgr.Mgr, error) {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	connect := mgr.Connect
+	if computer != "" {
+		connect = func() (*mgr.Mgr, error) { return mgr.ConnectRemote(computer) }
+	}
+
+	var err error
+	delay := baseDelay
+	for attempt := 1; ; attempt++ {
+		var manager *mgr.Mgr
+		if manager, err = connect(); err == nil {
+			return manager, nil
+		}
+		if attempt >= maxAttempts {
+			break
+		}
+
+		wait := delay
+		if delay > 0 {
+			// Up to 25% jitter, so concurrent callers don't retry in lockstep.
+			wait += time.Duration(rand.Int63n(int64(delay)/4 + 1))
+		}
+		DebugLogger.Printf("Failed to connect to service control manager (attempt %v/%v), retrying in %v: %v\n", attempt, maxAttempts, wait, err)
+		time.Sleep(wait)
+		delay *= 2
+	}
+
+	return nil, newErrorW(ErrSCMConnect, "failed to connect to service control manager of %v after %v attempts", err, computerName(computer), maxAttempts)
+}
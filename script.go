@@ -0,0 +1,376 @@
+package cerberus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// scStartTypes maps the start types to the start= values of sc.exe.
+var scStartTypes = map[StartType]string{
+	AutoStartType:        "auto",
+	AutoDelayedStartType: "delayed-auto",
+	ManualStartType:      "demand",
+	DisabledStartType:    "disabled",
+}
+
+// maxSCMFailureActions is the number of failure actions the script sets, further failures repeat the last one.
+const maxSCMFailureActions = 3
+
+// ExportSCScript writes a batch script with sc.exe commands, which recreates the services with their SCM
+// properties. The services run the cerberus executable the script is exported with, like InstallService
+// does. The properties of the executable (ex. arguments and environment) are stored by cerberus and can't
+// be set with sc.exe, they are written as comments. Passwords are never exported.
+//
+// The recovery action for any exit code is mapped to the failure actions of the SCM, they apply if the
+// service stops with an error. Recovery actions of specific exit codes have no equivalent in the SCM.
+func ExportSCScript(cfgs []*SvcConfig, w io.Writer) error {
+	cerberusPath, _ := filepath.Abs(os.Args[0])
+
+	bw := bufio.NewWriter(w)
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(bw, format+"\r\n", args...)
+	}
+
+	line("@echo off")
+	line("REM Generated by cerberus on %v", time.Now().Format(time.RFC3339))
+	line("setlocal")
+	for _, cfg := range cfgs {
+		name := batchQuote(cfg.Name)
+		line("")
+		line("REM Service %v", batchEscape(cfg.Name))
+
+		create := fmt.Sprintf("sc.exe create %v binPath= %v start= %v", name,
+			batchQuote(serviceBinPath(cerberusPath, cfg.Name)), scStartTypes[cfg.StartType])
+		if cfg.DisplayName != "" {
+			create += " DisplayName= " + batchQuote(cfg.DisplayName)
+		}
+		if len(cfg.Dependencies) > 0 {
+			create += " depend= " + batchQuote(strings.Join(cfg.Dependencies, "/"))
+		}
+		if user := scStartName(cfg); user != "" {
+			if !cfg.UseVirtualAccount && !cfg.UseGMSA {
+				line("REM The password isn't exported, append password= PASSWORD to set it.")
+			}
+			create += " obj= " + batchQuote(user)
+		}
+		line("%v || exit /b 1", create)
+
+		if cfg.Desc != "" {
+			line("sc.exe description %v %v", name, batchQuote(cfg.Desc))
+		}
+		if len(cfg.RequiredPrivileges) > 0 {
+			line("sc.exe privs %v %v", name, batchQuote(strings.Join(cfg.RequiredPrivileges, "/")))
+		}
+		if cfg.ServiceACL != "" {
+			line("sc.exe sdset %v %v", name, batchQuote(cfg.ServiceACL))
+		}
+		if reset, actions, ok := scFailureActions(cfg); ok {
+			line("sc.exe failure %v reset= %v actions= %v", name, reset, batchQuote(actions))
+			line("sc.exe failureflag %v 1", name)
+		}
+
+		for _, c := range scComments(cfg) {
+			line("REM %v", batchEscape(c))
+		}
+	}
+	line("")
+	line("endlocal")
+
+	if err := bw.Flush(); err != nil {
+		return newErrorW(ErrGeneric, "failed to write sc script", err)
+	}
+	return nil
+}
+
+// serviceBinPath returns the command line of the service host of the service,
+// built the same way mgr.CreateService does for InstallService.
+func serviceBinPath(cerberusPath, name string) string {
+	return syscall.EscapeArg(cerberusPath) + " run " + syscall.EscapeArg(name)
+}
+
+// scStartName returns the account the service runs with, empty for the local system account.
+func scStartName(cfg *SvcConfig) string {
+	if cfg.UseVirtualAccount {
+		return VirtualAccountName(cfg.Name)
+	}
+	if isLocalSystem(cfg.ServiceUser) {
+		return ""
+	}
+	return cfg.ServiceUser
+}
+
+// scFailureActions returns the reset period in seconds and the failure actions of the SCM
+// equivalent to the recovery action for any exit code.
+func scFailureActions(cfg *SvcConfig) (int, string, bool) {
+	action, ok := cfg.RecoveryActions[AnyExitCode]
+	if !ok || action.Action&RestartAction != RestartAction {
+		return 0, "", false
+	}
+
+	count := maxSCMFailureActions
+	if action.MaxRestarts > 0 && action.MaxRestarts < count {
+		count = action.MaxRestarts
+	}
+
+	actions := make([]string, count)
+	for i := range actions {
+		actions[i] = fmt.Sprintf("restart/%v", restartDelay(action, i).Milliseconds())
+	}
+	return int(action.ResetAfter / time.Second), strings.Join(actions, "/"), true
+}
+
+// scComments describes the properties which can't be set with sc.exe.
+func scComments(cfg *SvcConfig) []string {
+	comments := []string{
+		"The following properties are stored by cerberus, sc.exe does not support them natively:",
+		"  Executable: " + cfg.ExePath,
+	}
+	if cfg.WorkDir != "" {
+		comments = append(comments, "  Working directory: "+cfg.WorkDir)
+	}
+	for _, arg := range cfg.Args {
+		comments = append(comments, "  Argument: "+arg)
+	}
+	for _, env := range cfg.Env {
+		comments = append(comments, "  Environment: "+env)
+	}
+	if cfg.EnvFile != "" {
+		comments = append(comments, "  Environment file: "+cfg.EnvFile)
+	}
+	for _, dep := range cfg.OptionalDependencies {
+		comments = append(comments, "  Optional dependency: "+dep)
+	}
+
+	codes := make([]int, 0, len(cfg.RecoveryActions))
+	for code := range cfg.RecoveryActions {
+		if code != AnyExitCode {
+			codes = append(codes, code)
+		}
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		comments = append(comments, fmt.Sprintf("  Recovery action for exit code %v: %v", code, cfg.RecoveryActions[code].Action))
+	}
+	return comments
+}
+
+// psStartTypes maps the start types to the -StartupType values of New-Service,
+// the delayed start is set in the registry as Windows PowerShell doesn't support it.
+var psStartTypes = map[StartType]string{
+	AutoStartType:        "Automatic",
+	AutoDelayedStartType: "Automatic",
+	ManualStartType:      "Manual",
+	DisabledStartType:    "Disabled",
+}
+
+// runtimeValues are registry values recorded by the service host, they aren't part of the configuration.
+var runtimeValues = append([]string{"ProcessId", "LastHeartbeat"}, statsValues...)
+
+// ExportPowerShellScript writes a PowerShell script, which recreates the services with New-Service or updates
+// them with Set-Service if they already exist, so the script can be run repeatedly. The cerberus properties are
+// written to the registry with Set-ItemProperty, if the configurations are stored in the registry. The recovery
+// action for any exit code is set with sc.exe failure like ExportSCScript does. Passwords are never exported,
+// the script asks for the credentials of a service user which requires a password.
+func ExportPowerShellScript(cfgs []*SvcConfig, w io.Writer) error {
+	cerberusPath, _ := filepath.Abs(os.Args[0])
+	_, inRegistry := ConfigStorage.(RegistryStorage)
+
+	bw := bufio.NewWriter(w)
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(bw, format+"\r\n", args...)
+	}
+
+	line("# Generated by cerberus on %v", time.Now().Format(time.RFC3339))
+	line("$ErrorActionPreference = 'Stop'")
+	for _, cfg := range cfgs {
+		name := psQuote(cfg.Name)
+		binPath := serviceBinPath(cerberusPath, cfg.Name)
+		line("")
+		line("# Service %v", cfg.Name)
+
+		user := scStartName(cfg)
+		needsPassword := user != "" && !cfg.UseVirtualAccount && !cfg.UseGMSA
+		if needsPassword {
+			line("$credential = Get-Credential -UserName %v -Message %v", psQuote(user), psQuote("Password of the user of service "+cfg.Name))
+		}
+
+		line("if (-not (Get-Service -Name %v -ErrorAction SilentlyContinue)) {", name)
+		create := fmt.Sprintf("    New-Service -Name %v -BinaryPathName %v -StartupType %v", name, psQuote(binPath), psStartTypes[cfg.StartType])
+		if cfg.DisplayName != "" {
+			create += " -DisplayName " + psQuote(cfg.DisplayName)
+		}
+		if cfg.Desc != "" {
+			create += " -Description " + psQuote(cfg.Desc)
+		}
+		if len(cfg.Dependencies) > 0 {
+			create += " -DependsOn " + psList(cfg.Dependencies)
+		}
+		if needsPassword {
+			create += " -Credential $credential"
+		}
+		line("%v | Out-Null", create)
+		line("} else {")
+		update := fmt.Sprintf("    Set-Service -Name %v -StartupType %v", name, psStartTypes[cfg.StartType])
+		if cfg.DisplayName != "" {
+			update += " -DisplayName " + psQuote(cfg.DisplayName)
+		}
+		if cfg.Desc != "" {
+			update += " -Description " + psQuote(cfg.Desc)
+		}
+		line("%v", update)
+		// Windows PowerShell doesn't escape quotes of arguments passed to native programs and drops empty
+		// arguments, "/" removes all dependencies.
+		depend := "/"
+		if len(cfg.Dependencies) > 0 {
+			depend = strings.Join(cfg.Dependencies, "/")
+		}
+		line("    sc.exe config %v binPath= %v depend= %v | Out-Null", name, psQuote(strings.ReplaceAll(binPath, `"`, `\"`)), psQuote(depend))
+		if needsPassword {
+			line("    sc.exe config %v obj= $credential.UserName password= $credential.GetNetworkCredential().Password | Out-Null", name)
+		}
+		line("}")
+
+		if user != "" && !needsPassword {
+			line("sc.exe config %v obj= %v | Out-Null", name, psQuote(user))
+		}
+		serviceKey := psQuote(`HKLM:\SYSTEM\CurrentControlSet\Services\` + cfg.Name)
+		line("Set-ItemProperty -Path %v -Name DelayedAutostart -Value %v -Type DWord", serviceKey, boolToDWord(cfg.StartType == AutoDelayedStartType))
+		if len(cfg.RequiredPrivileges) > 0 {
+			line("sc.exe privs %v %v | Out-Null", name, psQuote(strings.Join(cfg.RequiredPrivileges, "/")))
+		}
+		if cfg.ServiceACL != "" {
+			line("sc.exe sdset %v %v | Out-Null", name, psQuote(cfg.ServiceACL))
+		}
+		if reset, actions, ok := scFailureActions(cfg); ok {
+			line("sc.exe failure %v reset= %v actions= %v | Out-Null", name, reset, psQuote(actions))
+			line("sc.exe failureflag %v 1 | Out-Null", name)
+		}
+
+		if !inRegistry {
+			line("# The cerberus configuration isn't stored in the registry, restore it with 'cerberus import'.")
+			continue
+		}
+		if err := writePSRegKey(line, swRegBaseKey+"\\"+cfg.Name); err != nil {
+			return newErrorW(ErrGeneric, "failed to export service '%v'", err, cfg.Name)
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return newErrorW(ErrGeneric, "failed to write PowerShell script", err)
+	}
+	return nil
+}
+
+// writePSRegKey writes the Set-ItemProperty commands, which restore the values of the cerberus registry key.
+func writePSRegKey(line func(format string, args ...interface{}), path string) error {
+	key, err := registry.OpenKey(swRegRoot, path, registry.QUERY_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	names, err := key.ReadValueNames(-1)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	psPath := psQuote(psRegRootName() + `:\` + path)
+	line("New-Item -Path %v -Force | Out-Null", psPath)
+	for _, name := range names {
+		if isRuntimeValue(name) {
+			continue
+		}
+
+		var value, typ string
+		switch _, t, _ := key.GetValue(name, nil); t {
+		case registry.SZ, registry.EXPAND_SZ:
+			s, _, err := key.GetStringValue(name)
+			if err != nil {
+				return err
+			}
+			value, typ = psQuote(s), "String"
+			if t == registry.EXPAND_SZ {
+				typ = "ExpandString"
+			}
+		case registry.DWORD:
+			n, _, err := key.GetIntegerValue(name)
+			if err != nil {
+				return err
+			}
+			value, typ = fmt.Sprintf("([int32]%v)", int32(uint32(n))), "DWord"
+		case registry.QWORD:
+			n, _, err := key.GetIntegerValue(name)
+			if err != nil {
+				return err
+			}
+			value, typ = fmt.Sprintf("([int64]%v)", int64(n)), "QWord"
+		case registry.MULTI_SZ:
+			strs, _, err := key.GetStringsValue(name)
+			if err != nil {
+				return err
+			}
+			value, typ = "@("+psList(strs)+")", "MultiString"
+		default:
+			data, _, err := key.GetBinaryValue(name)
+			if err != nil {
+				return err
+			}
+			parts := make([]string, len(data))
+			for i, c := range data {
+				parts[i] = fmt.Sprintf("0x%02x", c)
+			}
+			value, typ = "([byte[]]@("+strings.Join(parts, ",")+"))", "Binary"
+		}
+		line("Set-ItemProperty -Path %v -Name %v -Value %v -Type %v", psPath, psQuote(name), value, typ)
+	}
+	return nil
+}
+
+func isRuntimeValue(name string) bool {
+	for _, v := range runtimeValues {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+func psRegRootName() string {
+	if swRegRoot == registry.CURRENT_USER {
+		return "HKCU"
+	}
+	return "HKLM"
+}
+
+// psQuote quotes the value as single quoted PowerShell string, which isn't expanded.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func psList(items []string) string {
+	quoted := make([]string, len(items))
+	for i := range items {
+		quoted[i] = psQuote(items[i])
+	}
+	return strings.Join(quoted, ",")
+}
+
+// batchQuote quotes the value as argument of a batch script, inner quotes are escaped for sc.exe.
+func batchQuote(s string) string {
+	return `"` + batchEscape(strings.ReplaceAll(s, `"`, `\"`)) + `"`
+}
+
+// batchEscape escapes the percent signs, which would be expanded as variables.
+func batchEscape(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
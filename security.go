@@ -0,0 +1,226 @@
+package cerberus
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+var (
+	netapi32 = windows.NewLazySystemDLL("netapi32.dll")
+
+	procDsGetDcNameW        = netapi32.NewProc("DsGetDcNameW")
+	procNetIsServiceAccount = netapi32.NewProc("NetIsServiceAccount")
+)
+
+// KnownPrivileges are the privileges which can be required by a service, see SvcConfig.RequiredPrivileges.
+// Account rights like SeServiceLogonRight aren't privileges and can't be required.
+var KnownPrivileges = []string{
+	"SeAssignPrimaryTokenPrivilege",
+	"SeAuditPrivilege",
+	"SeBackupPrivilege",
+	"SeChangeNotifyPrivilege",
+	"SeCreateGlobalPrivilege",
+	"SeCreatePagefilePrivilege",
+	"SeCreatePermanentPrivilege",
+	"SeCreateSymbolicLinkPrivilege",
+	"SeCreateTokenPrivilege",
+	"SeDebugPrivilege",
+	"SeDelegateSessionUserImpersonatePrivilege",
+	"SeEnableDelegationPrivilege",
+	"SeImpersonatePrivilege",
+	"SeIncreaseBasePriorityPrivilege",
+	"SeIncreaseQuotaPrivilege",
+	"SeIncreaseWorkingSetPrivilege",
+	"SeLoadDriverPrivilege",
+	"SeLockMemoryPrivilege",
+	"SeMachineAccountPrivilege",
+	"SeManageVolumePrivilege",
+	"SeProfileSingleProcessPrivilege",
+	"SeRelabelPrivilege",
+	"SeRemoteShutdownPrivilege",
+	"SeRestorePrivilege",
+	"SeSecurityPrivilege",
+	"SeShutdownPrivilege",
+	"SeSyncAgentPrivilege",
+	"SeSystemEnvironmentPrivilege",
+	"SeSystemProfilePrivilege",
+	"SeSystemtimePrivilege",
+	"SeTakeOwnershipPrivilege",
+	"SeTcbPrivilege",
+	"SeTimeZonePrivilege",
+	"SeTrustedCredManAccessPrivilege",
+	"SeUndockPrivilege",
+}
+
+// serviceRequiredPrivilegesInfo mirrors the SERVICE_REQUIRED_PRIVILEGES_INFO structure.
+type serviceRequiredPrivilegesInfo struct {
+	RequiredPrivileges *uint16
+}
+
+// canonicalPrivilege returns the privilege name as listed in KnownPrivileges,
+// privilege names are case-insensitive. Returns false if the privilege is unknown.
+func canonicalPrivilege(name string) (string, bool) {
+	for _, p := range KnownPrivileges {
+		if strings.EqualFold(p, name) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// isLocalSystem reports whether the service user is the local system account.
+func isLocalSystem(user string) bool {
+	return user == "" || strings.EqualFold(user, "LocalSystem") || strings.EqualFold(user, `NT AUTHORITY\SYSTEM`)
+}
+
+// VirtualAccountName returns the name of the virtual account of the service.
+func VirtualAccountName(name string) string {
+	return `NT SERVICE\` + name
+}
+
+// supportsVirtualAccounts reports whether the system supports virtual accounts,
+// they were introduced with Windows 7 and Windows Server 2008 R2 (6.1).
+func supportsVirtualAccounts() bool {
+	v := windows.RtlGetVersion()
+	return v.MajorVersion > 6 || (v.MajorVersion == 6 && v.MinorVersion >= 1)
+}
+
+// validateGMSA checks that the service user is a group managed service account, which can be
+// used on this system. Problems which might be temporary, like an unreachable domain controller,
+// are only logged as warning.
+func validateGMSA(cfg *SvcConfig) error {
+	if !strings.HasSuffix(cfg.ServiceUser, "$") {
+		return newError(ErrInvalidConfiguration, "group managed service account '%v' must end with '$'", cfg.ServiceUser)
+	}
+	if cfg.UseVirtualAccount || cfg.UseCredentialManager {
+		return newError(ErrInvalidConfiguration, "the password of a group managed service account is managed by the active directory")
+	}
+
+	var domain *uint16
+	var status uint32
+	if err := windows.NetGetJoinInformation(nil, &domain, &status); err != nil {
+		return newErrorW(ErrInvalidConfiguration, "failed to get domain join information", err)
+	}
+	defer windows.NetApiBufferFree((*byte)(unsafe.Pointer(domain)))
+	if status != windows.NetSetupDomainName {
+		return newError(ErrInvalidConfiguration, "group managed service accounts require a domain-joined system")
+	}
+
+	var dcInfo *byte
+	if r, _, _ := procDsGetDcNameW.Call(0, uintptr(unsafe.Pointer(domain)), 0, 0, 0, uintptr(unsafe.Pointer(&dcInfo))); r != 0 {
+		Logf(Logger, "Warning: domain controller of %v isn't reachable (%v), the service can't start until it is.\n",
+			Field("domain", windows.UTF16PtrToString(domain)), Field("error", windows.Errno(r)), Field("service", cfg.Name))
+	} else {
+		windows.NetApiBufferFree(dcInfo)
+	}
+
+	// The computer must be allowed to retrieve the password, which is done in the active directory.
+	account, err := windows.UTF16PtrFromString(cfg.ServiceUser)
+	if err != nil {
+		return newErrorW(ErrInvalidConfiguration, "invalid service user %v", err, cfg.ServiceUser)
+	}
+	var isService int32
+	if r, _, _ := procNetIsServiceAccount.Call(0, uintptr(unsafe.Pointer(account)), uintptr(unsafe.Pointer(&isService))); r == 0 && isService == 0 {
+		Logf(Logger, "Warning: %v isn't installed on this computer, add the computer to the group allowed to retrieve its password and run Install-ADServiceAccount.\n", Field("user", cfg.ServiceUser), Field("service", cfg.Name))
+	}
+	return nil
+}
+
+// setRequiredPrivileges sets the privileges the service process is restricted to,
+// an empty list removes the restriction.
+func setRequiredPrivileges(s *mgr.Service, privileges []string) error {
+	// The privileges are passed as double null terminated string list.
+	var buf []uint16
+	for _, p := range privileges {
+		buf = append(buf, utf16.Encode([]rune(p))...)
+		buf = append(buf, 0)
+	}
+	buf = append(buf, 0)
+	if len(privileges) == 0 {
+		buf = append(buf, 0)
+	}
+
+	info := serviceRequiredPrivilegesInfo{RequiredPrivileges: &buf[0]}
+	if err := windows.ChangeServiceConfig2(s.Handle, windows.SERVICE_CONFIG_REQUIRED_PRIVILEGES_INFO, (*byte)(unsafe.Pointer(&info))); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set required privileges of service %v", err, s.Name)
+	}
+	return nil
+}
+
+// queryRequiredPrivileges returns the privileges the service process is restricted to.
+func queryRequiredPrivileges(s *mgr.Service) ([]string, error) {
+	n := uint32(1024)
+	for {
+		b := make([]byte, n)
+		err := windows.QueryServiceConfig2(s.Handle, windows.SERVICE_CONFIG_REQUIRED_PRIVILEGES_INFO, &b[0], n, &n)
+		if err == windows.ERROR_INSUFFICIENT_BUFFER {
+			continue
+		}
+		if err != nil {
+			return nil, newErrorW(ErrLoadServiceCfg, "failed to query required privileges of service %v", err, s.Name)
+		}
+
+		info := (*serviceRequiredPrivilegesInfo)(unsafe.Pointer(&b[0]))
+		return multiSzToStrings(info.RequiredPrivileges), nil
+	}
+}
+
+// multiSzToStrings converts a double null terminated string list.
+func multiSzToStrings(p *uint16) []string {
+	if p == nil {
+		return nil
+	}
+
+	var strs []string
+	for start := unsafe.Pointer(p); ; {
+		n := 0
+		for *(*uint16)(unsafe.Add(start, n*2)) != 0 {
+			n++
+		}
+		if n == 0 {
+			return strs
+		}
+		strs = append(strs, string(utf16.Decode(unsafe.Slice((*uint16)(start), n))))
+		start = unsafe.Add(start, (n+1)*2)
+	}
+}
+
+// parseServiceACL parses the SDDL string and returns the DACL of the security descriptor.
+func parseServiceACL(sddl string) (*windows.ACL, error) {
+	sd, err := windows.SecurityDescriptorFromString(sddl)
+	if err != nil {
+		return nil, newErrorW(ErrInvalidConfiguration, "invalid service ACL %v", err, sddl)
+	}
+
+	dacl, _, err := sd.DACL()
+	if err != nil || dacl == nil {
+		return nil, newErrorW(ErrInvalidConfiguration, "service ACL %v doesn't contain a DACL", err, sddl)
+	}
+	return dacl, nil
+}
+
+// queryServiceACL returns the DACL of the service as SDDL string.
+func queryServiceACL(s *mgr.Service) (string, error) {
+	sd, err := windows.GetSecurityInfo(s.Handle, windows.SE_SERVICE, windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return "", newErrorW(ErrLoadServiceCfg, "failed to query security of service %v", err, s.Name)
+	}
+	return sd.String(), nil
+}
+
+// setServiceACL replaces the DACL of the service with the DACL of the SDDL string.
+func setServiceACL(s *mgr.Service, sddl string) error {
+	dacl, err := parseServiceACL(sddl)
+	if err != nil {
+		return err
+	}
+
+	if err := windows.SetSecurityInfo(s.Handle, windows.SE_SERVICE, windows.DACL_SECURITY_INFORMATION, nil, nil, dacl, nil); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set security of service %v", err, s.Name)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package cerberus
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// ServiceStats contains the operational metrics of a service.
+type ServiceStats struct {
+	Name  string
+	State ServiceState
+
+	// Persistent metadata recorded by the service host.
+	RestartCount uint64
+	LastRestart  time.Time
+	FirstStart   time.Time
+	LastStart    time.Time
+	// TotalRuntime is the time the service was running over all runs including the current one.
+	TotalRuntime time.Duration
+
+	// Metrics of the executable, only set if the service is running.
+	PID            uint32
+	Uptime         time.Duration
+	CPUTime        time.Duration
+	PeakWorkingSet uint64
+}
+
+// ProcessMetrics are the live metrics of the executable of a running service.
+type ProcessMetrics struct {
+	// PID is zero if the service isn't running, all other metrics are empty then.
+	PID            uint32
+	StartTime      time.Time
+	UserTime       time.Duration
+	KernelTime     time.Duration
+	WorkingSet     uint64
+	PeakWorkingSet uint64
+	HandleCount    uint32
+}
+
+// Running reports whether the metrics are of a running process.
+func (m ProcessMetrics) Running() bool {
+	return m.PID != 0
+}
+
+// CPUTime returns the user and kernel time of the process.
+func (m ProcessMetrics) CPUTime() time.Duration {
+	return m.UserTime + m.KernelTime
+}
+
+// GetProcessMetrics returns the live metrics of the executable of the service with the given name.
+// If the service isn't running, empty metrics are returned instead of an error.
+func GetProcessMetrics(name string) (ProcessMetrics, error) {
+	pid, err := GetServicePID(name)
+	if err != nil || pid == 0 {
+		return ProcessMetrics{}, err
+	}
+
+	// The service process is the cerberus host, the metrics of the executable are of interest.
+	if exePID := executablePID(name); exePID != 0 {
+		pid = exePID
+	}
+
+	m, err := processMetrics(pid)
+	if err != nil {
+		// The process may have exited since the service was queried.
+		DebugLogger.Println("failed to get process metrics:", err)
+		return ProcessMetrics{}, nil
+	}
+	return m, nil
+}
+
+// executablePID returns the process id of the executable recorded by the service host.
+func executablePID(name string) uint32 {
+	key, err := registry.OpenKey(swRegRoot, swRegBaseKey+"\\"+name, registry.QUERY_VALUE)
+	if err != nil {
+		return 0
+	}
+	defer key.Close()
+
+	pid, _, _ := key.GetIntegerValue("ProcessId")
+	return uint32(pid)
+}
+
+// GetServiceStats returns the operational metrics of the service with the given name.
+func GetServiceStats(name string) (ServiceStats, error) {
+	stats := ServiceStats{Name: name}
+	if _, err := ConfigStorage.Load(name); err != nil {
+		return stats, err
+	}
+
+	// The statistics are always kept in the registry, independent of the configured storage.
+	key, err := registry.OpenKey(swRegRoot, swRegBaseKey+"\\"+name, registry.QUERY_VALUE)
+	if err != nil {
+		stats.State, err = GetServiceStatus(name)
+		return stats, err
+	}
+	defer key.Close()
+
+	stats.RestartCount, _, _ = key.GetIntegerValue("RestartCount")
+	lastRestart, _, _ := key.GetStringValue("LastRestartTime")
+	stats.LastRestart, _ = time.Parse(time.RFC3339, lastRestart)
+	firstStart, _, _ := key.GetStringValue("FirstStartTime")
+	stats.FirstStart, _ = time.Parse(time.RFC3339, firstStart)
+	lastStart, _, _ := key.GetStringValue("LastStartTime")
+	stats.LastStart, _ = time.Parse(time.RFC3339, lastStart)
+	stats.TotalRuntime = totalRuntime(key)
+
+	if stats.State, err = GetServiceStatus(name); err != nil {
+		return stats, err
+	}
+	if stats.State != RunningState {
+		return stats, nil
+	}
+
+	if !stats.LastStart.IsZero() {
+		stats.TotalRuntime += time.Since(stats.LastStart)
+	}
+
+	pid, _, err := key.GetIntegerValue("ProcessId")
+	if err != nil || pid == 0 {
+		return stats, nil
+	}
+
+	stats.PID = uint32(pid)
+	m, err := processMetrics(stats.PID)
+	if err != nil {
+		DebugLogger.Println("failed to get process metrics:", err)
+		return stats, nil
+	}
+	stats.Uptime = time.Since(m.StartTime)
+	stats.CPUTime = m.CPUTime()
+	stats.PeakWorkingSet = m.PeakWorkingSet
+
+	return stats, nil
+}
+
+// statsValues are the registry values of the persistent statistics of a service.
+var statsValues = []string{"RestartCount", "LastRestartTime", "FirstStartTime", "LastStartTime", "TotalRuntime"}
+
+// StatsHeartbeatInterval is the interval the service host records that the service is still running.
+// If the service host crashes, the runtime of the run is accounted up to the last heartbeat.
+const StatsHeartbeatInterval = time.Minute
+
+// loadServiceStats reads the statistics of all runs of the service into the configuration.
+func loadServiceStats(cfg *SvcConfig) {
+	key, err := registry.OpenKey(swRegRoot, swRegBaseKey+"\\"+cfg.Name, registry.QUERY_VALUE)
+	if err != nil {
+		return
+	}
+	defer key.Close()
+
+	count, _, _ := key.GetIntegerValue("RestartCount")
+	cfg.CumulativeRestarts = int(count)
+	lastRestart, _, _ := key.GetStringValue("LastRestartTime")
+	cfg.LastRestart, _ = time.Parse(time.RFC3339, lastRestart)
+	firstStart, _, _ := key.GetStringValue("FirstStartTime")
+	cfg.FirstStart, _ = time.Parse(time.RFC3339, firstStart)
+	lastStart, _, _ := key.GetStringValue("LastStartTime")
+	cfg.LastStart, _ = time.Parse(time.RFC3339, lastStart)
+	cfg.TotalRuntime = totalRuntime(key)
+}
+
+func totalRuntime(key registry.Key) time.Duration {
+	value, _, _ := key.GetStringValue("TotalRuntime")
+	runtime, _ := time.ParseDuration(value)
+	return runtime
+}
+
+// addRuntime adds the duration to the total runtime of the service.
+func addRuntime(key registry.Key, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	return key.SetStringValue("TotalRuntime", (totalRuntime(key) + d).Round(time.Second).String())
+}
+
+// recordRunning records the start of a run. A heartbeat is only present if the previous
+// run didn't stop cleanly, its runtime is added up to the last heartbeat.
+func recordRunning(name string, started time.Time) error {
+	key, _, err := registry.CreateKey(swRegRoot, swRegBaseKey+"\\"+name, registry.QUERY_VALUE|registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	if heartbeat, _, err := key.GetStringValue("LastHeartbeat"); err == nil {
+		lastStart, _, _ := key.GetStringValue("LastStartTime")
+		hb, errHb := time.Parse(time.RFC3339, heartbeat)
+		start, errStart := time.Parse(time.RFC3339, lastStart)
+		if errHb == nil && errStart == nil {
+			if err := addRuntime(key, hb.Sub(start)); err != nil {
+				return err
+			}
+		}
+	}
+
+	now := started.Format(time.RFC3339)
+	if err := key.SetStringValue("LastStartTime", now); err != nil {
+		return err
+	}
+	return key.SetStringValue("LastHeartbeat", now)
+}
+
+// recordHeartbeat records that the service is still running.
+func recordHeartbeat(name string) error {
+	key, err := registry.OpenKey(swRegRoot, swRegBaseKey+"\\"+name, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	return key.SetStringValue("LastHeartbeat", time.Now().Format(time.RFC3339))
+}
+
+// recordStopped adds the runtime of the run to the total runtime and removes the heartbeat,
+// which marks the run as cleanly stopped.
+func recordStopped(name string, started time.Time) error {
+	key, err := registry.OpenKey(swRegRoot, swRegBaseKey+"\\"+name, registry.QUERY_VALUE|registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	if err := addRuntime(key, time.Since(started)); err != nil {
+		return err
+	}
+	if err := key.DeleteValue("LastHeartbeat"); err != nil && err != registry.ErrNotExist {
+		return err
+	}
+	return nil
+}
+
+// ResetServiceStats resets the persistent statistics of the service with the given name,
+// like the cumulative restart count.
+func ResetServiceStats(name string) error {
+	key, err := registry.OpenKey(swRegRoot, swRegBaseKey+"\\"+name, registry.SET_VALUE)
+	if err == registry.ErrNotExist {
+		return nil
+	}
+	if err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to reset statistics of service %v", err, name)
+	}
+	defer key.Close()
+
+	for _, v := range statsValues {
+		if err := key.DeleteValue(v); err != nil && err != registry.ErrNotExist {
+			return newErrorW(ErrSaveServiceCfg, "failed to reset statistics of service %v", err, name)
+		}
+	}
+	return nil
+}
+
+// recordStart saves the process id of the executable and the first start time of the service.
+func recordStart(name string, pid uint32) error {
+	key, _, err := registry.CreateKey(swRegRoot, swRegBaseKey+"\\"+name, registry.QUERY_VALUE|registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	if firstStart, _, _ := key.GetStringValue("FirstStartTime"); firstStart == "" {
+		if err := key.SetStringValue("FirstStartTime", time.Now().Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+
+	return key.SetDWordValue("ProcessId", pid)
+}
+
+// recordRestart increments the cumulative restart count of the service.
+func recordRestart(name string) error {
+	key, _, err := registry.CreateKey(swRegRoot, swRegBaseKey+"\\"+name, registry.QUERY_VALUE|registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	count, _, _ := key.GetIntegerValue("RestartCount")
+	if err := key.SetDWordValue("RestartCount", uint32(count+1)); err != nil {
+		return err
+	}
+
+	return key.SetStringValue("LastRestartTime", time.Now().Format(time.RFC3339))
+}
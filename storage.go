@@ -0,0 +1,212 @@
+package cerberus
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// Storage persists the cerberus specific part of the service configurations,
+// the SCM properties are always stored by the SCM itself.
+type Storage interface {
+	Save(cfg SvcConfig) error
+	Load(name string) (*SvcConfig, error)
+	List() ([]string, error)
+	Delete(name string) error
+}
+
+// ConfigStorage is the storage used for all service configurations. Per default it is configured
+// by the CERBERUS_STORAGE environment variable, either "registry" (default) or "file:<dir>".
+var ConfigStorage = storageFromEnv()
+
+func storageFromEnv() Storage {
+	value := os.Getenv("CERBERUS_STORAGE")
+	switch {
+	case value == "" || value == "registry":
+		return RegistryStorage{}
+	case strings.HasPrefix(value, "file:") && len(value) > len("file:"):
+		return FileStorage{Dir: value[len("file:"):]}
+	default:
+		Logf(Logger, "Invalid CERBERUS_STORAGE '%v', using the registry...\n", Field("value", value), Field("variable", "CERBERUS_STORAGE"))
+		return RegistryStorage{}
+	}
+}
+
+// RegistryStorage stores the configurations in the windows registry.
+type RegistryStorage struct{}
+
+// Save implements the Storage interface.
+func (RegistryStorage) Save(cfg SvcConfig) error {
+	return saveSvcCfgRegistry(cfg)
+}
+
+// Load implements the Storage interface.
+func (RegistryStorage) Load(name string) (*SvcConfig, error) {
+	return loadSvcCfgRegistry(name)
+}
+
+// List implements the Storage interface.
+func (RegistryStorage) List() ([]string, error) {
+	return loadServiceNames()
+}
+
+// Delete implements the Storage interface.
+func (RegistryStorage) Delete(name string) error {
+	deleteRegistryKey(swRegBaseKey + "\\" + name + pendingKeySuffix)
+	deleteRegistryKey(swRegBaseKey + "\\" + name + prevKeySuffix)
+	if err := registry.DeleteKey(swRegRoot, swRegBaseKey+"\\"+name); err != nil {
+		return newErrorW(ErrGeneric, "failed to remove service entry for service '%v'", err, name)
+	}
+	return nil
+}
+
+// FileStorage stores every configuration as JSON file in a directory.
+type FileStorage struct {
+	Dir string
+}
+
+func (f FileStorage) path(name string) string {
+	return filepath.Join(f.Dir, name+".json")
+}
+
+// Save implements the Storage interface.
+func (f FileStorage) Save(cfg SvcConfig) error {
+	data, err := ExportConfig(&cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(f.Dir, 0755); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to create storage directory", err)
+	}
+
+	// Write to a temporary file first, so a crash never leaves a partial configuration.
+	tmp := f.path(cfg.Name) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to write configuration file", err)
+	}
+	if err := os.Rename(tmp, f.path(cfg.Name)); err != nil {
+		os.Remove(tmp)
+		return newErrorW(ErrSaveServiceCfg, "failed to write configuration file", err)
+	}
+	return nil
+}
+
+// Load implements the Storage interface.
+func (f FileStorage) Load(name string) (*SvcConfig, error) {
+	data, err := ioutil.ReadFile(f.path(name))
+	if err != nil {
+		return nil, newError(ErrLoadServiceCfg, "couldn't find service '%v'", name)
+	}
+
+	var cfg SvcConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to read configuration of service '%v'", err, name)
+	}
+	if cfg.Labels == nil {
+		cfg.Labels = map[string]string{}
+	}
+	return &cfg, nil
+}
+
+// List implements the Storage interface.
+func (f FileStorage) List() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(f.Dir, "*.json"))
+	if err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to read services", err)
+	}
+
+	services := make([]string, len(files))
+	for i := range files {
+		services[i] = strings.TrimSuffix(filepath.Base(files[i]), ".json")
+	}
+	return services, nil
+}
+
+// Delete implements the Storage interface.
+func (f FileStorage) Delete(name string) error {
+	if err := os.Remove(f.path(name)); err != nil {
+		return newErrorW(ErrGeneric, "failed to remove service entry for service '%v'", err, name)
+	}
+	return nil
+}
+
+// svcConfigVersion is the version of the registry layout, keys written
+// before the atomic saves were introduced don't have this value.
+const svcConfigVersion = 1
+
+// Suffixes of the registry keys used by the atomic saves.
+const (
+	pendingKeySuffix = "_pending"
+	prevKeySuffix    = "_prev"
+)
+
+var procRegCopyTreeW = advapi32.NewProc("RegCopyTreeW")
+
+// saveSvcCfgRegistry saves the cerberus specific properties in the registry. All values are written
+// to <name>_pending first, which then replaces the current key. The current key is kept as <name>_prev
+// until the next successful save, so a failed swap can be rolled back.
+func saveSvcCfgRegistry(config SvcConfig) error {
+	current := swRegBaseKey + "\\" + config.Name
+	pending, prev := current+pendingKeySuffix, current+prevKeySuffix
+
+	deleteRegistryKey(pending)
+	// Start with a copy of the current key, it contains runtime values like the restart statistics.
+	if err := copyRegistryKey(current, pending); err != nil && err != registry.ErrNotExist {
+		return newErrorW(ErrSaveServiceCfg, "failed to create registry entry", err)
+	}
+
+	key, _, err := registry.CreateKey(swRegRoot, pending, registry.CREATE_SUB_KEY|registry.WRITE)
+	if err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to create registry entry", err)
+	}
+	err = writeSvcCfgRegistry(key, config)
+	key.Close()
+	if err != nil {
+		deleteRegistryKey(pending)
+		return err
+	}
+
+	deleteRegistryKey(prev)
+	hasPrev := copyRegistryKey(current, prev) == nil
+	deleteRegistryKey(current)
+	if err := copyRegistryKey(pending, current); err != nil {
+		if hasPrev {
+			deleteRegistryKey(current)
+			copyRegistryKey(prev, current)
+		}
+		return newErrorW(ErrSaveServiceCfg, "failed to replace registry entry", err)
+	}
+
+	deleteRegistryKey(pending)
+	return nil
+}
+
+// copyRegistryKey copies all values and sub keys of src to dst, both are relative to swRegRoot.
+func copyRegistryKey(src, dst string) error {
+	s, err := registry.OpenKey(swRegRoot, src, registry.READ)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	d, _, err := registry.CreateKey(swRegRoot, dst, registry.ALL_ACCESS)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if r, _, _ := procRegCopyTreeW.Call(uintptr(s), 0, uintptr(d)); r != 0 {
+		return syscall.Errno(r)
+	}
+	return nil
+}
+
+func deleteRegistryKey(path string) {
+	registry.DeleteKey(swRegRoot, path)
+}
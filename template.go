@@ -0,0 +1,151 @@
+package cerberus
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const swRegTemplateKey = "SOFTWARE\\go-sharp\\cerberus\\templates"
+
+// templateVarRe matches {{variable}} placeholders.
+var templateVarRe = regexp.MustCompile(`\{\{\s*([\w.-]+)\s*\}\}`)
+
+// SaveTemplate saves the configuration of the given service as template with the given name.
+// The name and the display name of the service aren't part of the template.
+func SaveTemplate(template string, service string) error {
+	if template == "" {
+		return newError(ErrSaveServiceCfg, "empty template name is not allowed")
+	}
+
+	cfg, err := LoadServiceCfg(service)
+	if err != nil {
+		return err
+	}
+
+	if cfg.DisplayName == cfg.Name {
+		cfg.DisplayName = ""
+	}
+	cfg.Name = ""
+	cfg.PreviousStartType = 0
+
+	data, err := ExportConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, swRegTemplateKey+"\\"+template, registry.CREATE_SUB_KEY|registry.WRITE)
+	if err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to create registry entry", err)
+	}
+	defer key.Close()
+
+	if err := key.SetStringValue("Config", string(data)); err != nil {
+		return newErrorW(ErrSaveServiceCfg, "failed to set template configuration", err)
+	}
+	return nil
+}
+
+// ListTemplates returns the names of all saved templates.
+func ListTemplates() ([]string, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, swRegTemplateKey, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
+	if err == registry.ErrNotExist {
+		return nil, nil
+	} else if err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to open templates", err)
+	}
+	defer key.Close()
+
+	templates, err := key.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to read templates", err)
+	}
+
+	sort.Strings(templates)
+	return templates, nil
+}
+
+// LoadTemplate returns the unresolved configuration of the template with the given name.
+func LoadTemplate(template string) (string, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, swRegTemplateKey+"\\"+template, registry.QUERY_VALUE)
+	if err != nil {
+		return "", newError(ErrLoadServiceCfg, "couldn't find template '%v'", template)
+	}
+	defer key.Close()
+
+	data, _, err := key.GetStringValue("Config")
+	if err != nil {
+		return "", newErrorW(ErrLoadServiceCfg, "failed to read template '%v'", err, template)
+	}
+	return data, nil
+}
+
+// RemoveTemplate removes the template with the given name.
+func RemoveTemplate(template string) error {
+	if template == "" {
+		return newError(ErrGeneric, "empty template name is not allowed")
+	}
+
+	if err := registry.DeleteKey(registry.LOCAL_MACHINE, swRegTemplateKey+"\\"+template); err != nil {
+		return newErrorW(ErrGeneric, "failed to remove template '%v'", err, template)
+	}
+	return nil
+}
+
+// ApplyTemplate installs a service with the given name from a template. All {{variable}} placeholders
+// in string fields are replaced by the given variables, {{name}} defaults to the service name.
+// The modify function, if not nil, can change the configuration before it is installed.
+func ApplyTemplate(template, service string, vars map[string]string, modify func(cfg *SvcConfig)) (*SvcConfig, error) {
+	data, err := LoadTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := vars["name"]; !ok {
+		vars = copyVars(vars)
+		vars["name"] = service
+	}
+
+	var missing []string
+	data = templateVarRe.ReplaceAllStringFunc(data, func(m string) string {
+		name := templateVarRe.FindStringSubmatch(m)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+			return m
+		}
+		// The template is JSON, so the value has to be escaped.
+		escaped, _ := json.Marshal(value)
+		return string(escaped[1 : len(escaped)-1])
+	})
+	if len(missing) > 0 {
+		return nil, newError(ErrInvalidConfiguration, "missing template variables: %v", strings.Join(missing, ", "))
+	}
+
+	var cfg SvcConfig
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to parse template '%v'", err, template)
+	}
+
+	cfg.Name = service
+	if modify != nil {
+		modify(&cfg)
+	}
+
+	if err := InstallService(cfg); err != nil {
+		return nil, err
+	}
+
+	return LoadServiceCfg(service)
+}
+
+func copyVars(vars map[string]string) map[string]string {
+	c := make(map[string]string, len(vars)+1)
+	for k, v := range vars {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,10 @@
+package cerberus
+
+import "context"
+
+// traceOperation is called when an operation on the service with the given name starts. It returns
+// the context to run the operation with and the function to call with the result of the operation.
+// Operations are only traced if built with the cerberus_otel build tag, see otel.go.
+var traceOperation = func(ctx context.Context, operation, name string) (context.Context, func(err error)) {
+	return ctx, func(error) {}
+}
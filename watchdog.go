@@ -0,0 +1,92 @@
+package cerberus
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultWatchdogFailThreshold is used if no fail threshold is configured for the watchdog.
+const DefaultWatchdogFailThreshold = 3
+
+// WatchdogExitCode is the exit code recovery actions are looked up with, if the executable
+// was stopped by the watchdog. If there is no action for it, the AnyExitCode action applies.
+const WatchdogExitCode = -2
+
+// errWatchdog replaces the exit error of an executable stopped by the watchdog.
+var errWatchdog = fmt.Errorf("stopped by the watchdog, the process didn't respond")
+
+func (c SvcConfig) watchdogFailThreshold() int {
+	if c.WatchdogFailThreshold <= 0 {
+		return DefaultWatchdogFailThreshold
+	}
+	return c.WatchdogFailThreshold
+}
+
+// watchdog checks periodically if the process still responds. If the check fails too often
+// in a row, the process is stopped with the configured stop signals and the exit is handled
+// like a crash. The check calls the watchdog url if configured and, if the cpu check is enabled,
+// the process is considered hung if it hasn't used any cpu time since the last check.
+func (c *cerberusSvc) watchdog(p *os.Process, exited <-chan struct{}) {
+	ticker := time.NewTicker(c.cfg.WatchdogInterval)
+	defer ticker.Stop()
+
+	client := &http.Client{Timeout: c.cfg.WatchdogInterval}
+	var lastCPU time.Duration
+	failures := 0
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+		}
+
+		var err error
+		if c.cfg.WatchdogURL != "" {
+			err = checkWatchdogURL(client, c.cfg.WatchdogURL)
+		}
+		if err == nil && c.cfg.WatchdogCPU {
+			var cpu time.Duration
+			if _, cpu, err = processTimes(uint32(p.Pid)); err == nil && cpu == lastCPU {
+				err = fmt.Errorf("no cpu time used since %v", c.cfg.WatchdogInterval)
+			}
+			lastCPU = cpu
+		}
+
+		if err == nil {
+			failures = 0
+			continue
+		}
+
+		failures++
+		c.log.Warning(4, fmt.Sprintf("Watchdog check failed (%v/%v): %v", failures, c.cfg.watchdogFailThreshold(), err))
+		if failures < c.cfg.watchdogFailThreshold() {
+			continue
+		}
+
+		c.log.Error(3, fmt.Sprintf("Executable '%v' doesn't respond, stopping it...", c.cfg.ExePath))
+		atomic.StoreInt32(&c.watchdogTripped, 1)
+		c.sendStopSignals()
+		select {
+		case <-exited:
+		case <-time.After(c.cfg.stopTimeout()):
+			p.Kill()
+		}
+		return
+	}
+}
+
+func checkWatchdogURL(client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("watchdog url returned status %v", resp.Status)
+	}
+	return nil
+}
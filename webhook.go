@@ -0,0 +1,49 @@
+package cerberus
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultWebhookTimeout is used if no webhook timeout is configured.
+const DefaultWebhookTimeout = 10 * time.Second
+
+type webhookPayload struct {
+	Service      string `json:"service"`
+	ExitCode     int    `json:"exit_code"`
+	RestartCount int    `json:"restart_count"`
+	Timestamp    string `json:"timestamp"`
+}
+
+// sendWebhook posts the recovery event to the webhook url of the action.
+func sendWebhook(action SvcRecoveryAction, payload webhookPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	timeout := action.WebhookTimeout
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+
+	client := &http.Client{Timeout: timeout}
+	if action.WebhookInsecure {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+
+	resp, err := client.Post(action.WebhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %v", resp.Status)
+	}
+	return nil
+}
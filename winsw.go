@@ -0,0 +1,202 @@
+package cerberus
+
+import (
+	"encoding/xml"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// winswConfig is the part of the WinSW xml configuration which can be mapped to cerberus.
+type winswConfig struct {
+	ID               string   `xml:"id"`
+	Name             string   `xml:"name"`
+	Description      string   `xml:"description"`
+	Executable       string   `xml:"executable"`
+	Arguments        string   `xml:"arguments"`
+	Argument         []string `xml:"argument"`
+	WorkingDirectory string   `xml:"workingdirectory"`
+	Env              []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"env"`
+	StartMode        string   `xml:"startmode"`
+	StartModeCamel   string   `xml:"startMode"`
+	DelayedAutoStart bool     `xml:"delayedAutoStart"`
+	Depend           []string `xml:"depend"`
+	LogPath          string   `xml:"logpath"`
+	Log              struct {
+		Mode string `xml:"mode,attr"`
+	} `xml:"log"`
+	StopTimeout    string `xml:"stoptimeout"`
+	ServiceAccount struct {
+		Domain   string `xml:"domain"`
+		User     string `xml:"user"`
+		Username string `xml:"username"`
+		Password string `xml:"password"`
+	} `xml:"serviceaccount"`
+	OnFailure []struct {
+		Action string `xml:"action,attr"`
+		Delay  string `xml:"delay,attr"`
+	} `xml:"onfailure"`
+	ResetFailure string `xml:"resetfailure"`
+
+	// Unknown elements, they are reported as unsupported.
+	Other []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+// ImportFromWinSW parses a WinSW xml configuration and returns it as cerberus configuration, which can be
+// passed to InstallService. Elements without an equivalent in cerberus (ex. download) are logged as
+// warnings. Variables like %BASE% aren't expanded, as the location of the configuration isn't known.
+func ImportFromWinSW(r io.Reader) (*SvcConfig, error) {
+	var w winswConfig
+	if err := xml.NewDecoder(r).Decode(&w); err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to parse WinSW configuration", err)
+	}
+	if w.ID == "" || w.Executable == "" {
+		return nil, newError(ErrLoadServiceCfg, "WinSW configuration requires an id and an executable")
+	}
+
+	var warnings []Warning
+	cfg := &SvcConfig{
+		Name:         w.ID,
+		DisplayName:  w.Name,
+		Desc:         w.Description,
+		ExePath:      w.Executable,
+		WorkDir:      w.WorkingDirectory,
+		Dependencies: w.Depend,
+	}
+
+	args, err := splitCommandLine(w.Arguments)
+	if err != nil {
+		return nil, newErrorW(ErrLoadServiceCfg, "failed to parse arguments of WinSW service %v", err, w.ID)
+	}
+	cfg.Args = append(args, w.Argument...)
+
+	for _, e := range w.Env {
+		cfg.Env = append(cfg.Env, e.Name+"="+e.Value)
+	}
+
+	startMode := w.StartMode
+	if startMode == "" {
+		startMode = w.StartModeCamel
+	}
+	switch strings.ToLower(startMode) {
+	case "", "automatic":
+		cfg.StartType = AutoStartType
+		if w.DelayedAutoStart {
+			cfg.StartType = AutoDelayedStartType
+		}
+	case "manual":
+		cfg.StartType = ManualStartType
+	case "disabled":
+		cfg.StartType = DisabledStartType
+	default:
+		warnings = append(warnings, newWarning(ErrLoadServiceCfg, "unsupported start mode '%v', using manual start", startMode))
+		cfg.StartType = ManualStartType
+	}
+
+	// WinSW writes the output to <logpath>\<id>.out.log and <logpath>\<id>.err.log.
+	if !strings.EqualFold(w.Log.Mode, "none") {
+		logPath := w.LogPath
+		if logPath == "" {
+			logPath = cfg.WorkDir
+		}
+		if logPath != "" {
+			cfg.StdoutLog = filepath.Join(logPath, w.ID+".out.log")
+			cfg.StderrLog = filepath.Join(logPath, w.ID+".err.log")
+		}
+	}
+
+	if w.StopTimeout != "" {
+		if cfg.StopTimeout, err = parseWinSWDuration(w.StopTimeout); err != nil {
+			warnings = append(warnings, newWarningW(ErrLoadServiceCfg, "ignoring invalid stop timeout '%v'", err, w.StopTimeout))
+		}
+	}
+
+	if user := w.ServiceAccount.User + w.ServiceAccount.Username; user != "" {
+		if w.ServiceAccount.Domain != "" && w.ServiceAccount.Domain != "." {
+			user = w.ServiceAccount.Domain + `\` + user
+		}
+		cfg.ServiceUser = user
+		if w.ServiceAccount.Password != "" {
+			password := w.ServiceAccount.Password
+			cfg.Password = &password
+		}
+		cfg.UseGMSA = strings.HasSuffix(user, "$")
+	}
+
+	// WinSW applies the failure actions to successive failures, cerberus uses the first one for all failures.
+	if len(w.OnFailure) > 0 {
+		action, warning := winswRecoveryAction(w.OnFailure[0].Action, w.OnFailure[0].Delay)
+		if warning != nil {
+			warnings = append(warnings, *warning)
+		}
+		if action.Action == RestartAction && w.ResetFailure != "" {
+			if action.ResetAfter, err = parseWinSWDuration(w.ResetFailure); err != nil {
+				warnings = append(warnings, newWarningW(ErrLoadServiceCfg, "ignoring invalid reset failure '%v'", err, w.ResetFailure))
+			}
+		}
+		cfg.RecoveryActions = map[int]SvcRecoveryAction{AnyExitCode: action}
+		if len(w.OnFailure) > 1 {
+			warnings = append(warnings, newWarning(ErrLoadServiceCfg, "only the first onfailure action is imported, it applies to all failures"))
+		}
+	}
+
+	for _, o := range w.Other {
+		warnings = append(warnings, newWarning(ErrLoadServiceCfg, "element <%v> is not supported and ignored", o.XMLName.Local))
+	}
+
+	logWarnings(warnings)
+	return cfg, nil
+}
+
+func winswRecoveryAction(action, delay string) (SvcRecoveryAction, *Warning) {
+	switch strings.ToLower(action) {
+	case "restart":
+		d, err := parseWinSWDuration(delay)
+		if err != nil && delay != "" {
+			w := newWarningW(ErrLoadServiceCfg, "ignoring invalid restart delay '%v'", err, delay)
+			return SvcRecoveryAction{ExitCode: AnyExitCode, Action: RestartAction}, &w
+		}
+		return SvcRecoveryAction{ExitCode: AnyExitCode, Action: RestartAction, Delay: int(d.Round(time.Second) / time.Second)}, nil
+	case "none":
+		return SvcRecoveryAction{ExitCode: AnyExitCode, Action: NoAction}, nil
+	default:
+		w := newWarning(ErrLoadServiceCfg, "onfailure action '%v' is not supported, the service is stopped instead", action)
+		return SvcRecoveryAction{ExitCode: AnyExitCode, Action: NoAction}, &w
+	}
+}
+
+// winswUnits are the duration units of WinSW (ex. "10 sec").
+var winswUnits = map[string]time.Duration{
+	"ms": time.Millisecond, "sec": time.Second, "secs": time.Second,
+	"min": time.Minute, "mins": time.Minute, "hour": time.Hour, "hours": time.Hour,
+	"day": 24 * time.Hour, "days": 24 * time.Hour,
+}
+
+// parseWinSWDuration parses a WinSW duration, a number without unit is in milliseconds.
+func parseWinSWDuration(s string) (time.Duration, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, newError(ErrLoadServiceCfg, "invalid duration '%v'", s)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, newErrorW(ErrLoadServiceCfg, "invalid duration '%v'", err, s)
+	}
+
+	unit := time.Millisecond
+	if len(fields) == 2 {
+		var ok bool
+		if unit, ok = winswUnits[strings.ToLower(fields[1])]; !ok {
+			return 0, newError(ErrLoadServiceCfg, "invalid duration unit '%v'", fields[1])
+		}
+	}
+	return time.Duration(value * float64(unit)), nil
+}